@@ -2,39 +2,66 @@ package api
 
 import (
 	"encoding/json"
-	"errors"
 	"net/http"
+	"path"
 	"strings"
+	"sync"
 
 	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/audit"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/lease"
 	"github.com/project-safari/zebra/query"
 	"github.com/project-safari/zebra/store"
+	"github.com/project-safari/zebra/watch"
+	"github.com/project-safari/zebra/webhook"
 )
 
 type ResourceAPI struct {
 	factory    zebra.ResourceFactory
 	resStore   *store.FileStore
 	queryStore *query.QueryStore
+	store      *syncStore
+	leases     *lease.Manager
+	signer     *auth.Signer
+	cipher     *store.Cipher
+	audit      *audit.Log
+	events     *watch.Hub
+	webhooks   *webhook.Dispatcher
 }
 
-var ErrNumArgs = errors.New("wrong number of args")
-
 func NewResourceAPI(factory zebra.ResourceFactory) *ResourceAPI {
 	return &ResourceAPI{
 		factory:    factory,
 		resStore:   nil,
 		queryStore: nil,
+		store:      nil,
+		leases:     nil,
+		signer:     nil,
+		cipher:     nil,
+		audit:      nil,
+		events:     nil,
+		webhooks:   nil,
 	}
 }
 
-// Set up store and query store given storage root.
+// Set up store, query store, audit log, event hub, webhook dispatcher and lease
+// manager given storage root.
 func (api *ResourceAPI) Initialize(storageRoot string) error {
 	api.resStore = store.NewFileStore(storageRoot, api.factory)
+	api.resStore.SetCipher(api.cipher)
 
 	if err := api.resStore.Initialize(); err != nil {
 		return err
 	}
 
+	auditLog, err := audit.Open(path.Join(storageRoot, AuditFile))
+	if err != nil {
+		return err
+	}
+
+	api.audit = auditLog
+
 	resMap, err := api.resStore.Load()
 	if err != nil {
 		return err
@@ -46,125 +73,122 @@ func (api *ResourceAPI) Initialize(storageRoot string) error {
 		return err
 	}
 
-	return nil
-}
-
-func (api *ResourceAPI) GetResources(w http.ResponseWriter, req *http.Request) {
-	results := api.queryStore.Query()
-
-	bytes, err := json.Marshal(results)
-	if err != nil {
-		panic(err)
+	api.events = watch.NewHub(watchHistory)
+	lock := new(sync.Mutex)
+	api.store = &syncStore{
+		lock: lock, fileStore: api.resStore, queryStore: api.queryStore, audit: api.audit, events: api.events, user: "",
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(bytes) // nolint:errcheck
-}
-
-func (api *ResourceAPI) GetResourcesByID(w http.ResponseWriter, req *http.Request) {
-	uuids := strings.Split(req.URL.Query().Get("id"), ",")
-
-	results := api.queryStore.QueryUUID(uuids)
-
-	bytes, err := json.Marshal(results)
-	if err != nil {
-		panic(err)
+	// Lease writes are audited as lease events rather than as plain writes.
+	leaseStore := &syncStore{
+		lock: lock, fileStore: api.resStore, queryStore: api.queryStore, audit: nil, events: api.events, user: "",
 	}
+	api.webhooks = webhook.NewDispatcher(api.events, api.store, api.queryStore)
+	api.leases = lease.NewManager(leaseStore, api.queryStore)
+	api.leases.SetRecorder(&leaseRecorder{log: api.audit})
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(bytes) // nolint:errcheck
+	return api.leases.Initialize()
 }
 
-func (api *ResourceAPI) GetResourcesByType(w http.ResponseWriter, req *http.Request) {
-	resTypes := strings.Split(req.URL.Query().Get("type"), ",")
-
-	results := api.queryStore.QueryType(resTypes)
-
-	bytes, err := json.Marshal(results)
-	if err != nil {
-		panic(err)
-	}
+// SetCipher sets the cipher that credential keys are encrypted with in the
+// store. It must be called before Initialize.
+func (api *ResourceAPI) SetCipher(c *store.Cipher) {
+	api.cipher = c
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(bytes) // nolint:errcheck
+// Leases returns the lease manager, which is set up by Initialize.
+func (api *ResourceAPI) Leases() *lease.Manager {
+	return api.leases
 }
 
-func (api *ResourceAPI) GetResourcesByProperty(w http.ResponseWriter, req *http.Request) {
-	query, err := buildQuery(req.URL.Query().Get("property"), true)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+// Webhooks returns the webhook dispatcher, which is set up by Initialize.
+func (api *ResourceAPI) Webhooks() *webhook.Dispatcher {
+	return api.webhooks
+}
 
+// GetResources returns the resources that pass every filter given in the
+// query parameters: "id" and "type", comma separated lists of IDs and types,
+// and "label" and "property", selectors on labels and properties. The user's
+// role must permit reading the given types; without types, only resources of
+// the types it may read are returned. If a single ID is given, the response
+// carries the ETag of its resource.
+func (api *ResourceAPI) GetResources(w http.ResponseWriter, req *http.Request) {
+	claims := authenticated(w, req)
+	if claims == nil {
 		return
 	}
 
-	results, err := api.queryStore.QueryProperty(query)
+	filter, err := resourceFilter(req)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, http.StatusBadRequest, err)
 
 		return
 	}
 
-	bytes, err := json.Marshal(results)
-	if err != nil {
-		panic(err)
-	}
+	if err := claims.Authorize(auth.VerbRead, filter.Types...); err != nil {
+		writeError(w, http.StatusForbidden, err)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(bytes) // nolint:errcheck
-}
+		return
+	}
 
-func (api *ResourceAPI) GetResourcesByLabel(w http.ResponseWriter, req *http.Request) {
-	query, err := buildQuery(req.URL.Query().Get("label"), false)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+	results := readable(claims, api.queryStore.QueryFilter(filter))
 
-		return
+	// A single resource asked for by ID carries its version.
+	if len(filter.IDs) == 1 {
+		if res := api.find(filter.IDs[0]); res != nil && results.Resources[res.GetType()] != nil {
+			w.Header().Set("ETag", etag(res))
+		}
 	}
 
-	results, err := api.queryStore.QueryLabel(query)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+	writeResources(w, req, results)
+}
 
-		return
+// Return the filter given by the query parameters of a resource request.
+func resourceFilter(req *http.Request) (query.Filter, error) {
+	params := req.URL.Query()
+	filter := query.Filter{IDs: commaList(params.Get("id")), Types: commaList(params.Get("type")), Selector: nil}
+	selectors := query.And{}
+
+	for _, p := range []struct {
+		param string
+		kind  query.Kind
+	}{{"label", query.KindLabel}, {"property", query.KindProperty}} {
+		if value := params.Get(p.param); value != "" {
+			sel, err := query.ParseSelector(value, p.kind)
+			if err != nil {
+				return filter, badParam(p.param, err)
+			}
+
+			selectors = append(selectors, sel)
+		}
 	}
 
-	bytes, err := json.Marshal(results)
-	if err != nil {
-		panic(err)
+	if len(selectors) > 0 {
+		filter.Selector = selectors
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(bytes) // nolint:errcheck
+	return filter, nil
 }
 
-func buildQuery(url string, isProperty bool) (query.Query, error) {
-	params := strings.Split(url, "-")
-
-	if len(params) != 3 { //nolint:gomnd
-		return query.Query{}, ErrNumArgs
+// Split a comma separated list, which may be empty.
+func commaList(value string) []string {
+	if value == "" {
+		return nil
 	}
 
-	key := params[0]
+	return strings.Split(value, ",")
+}
 
-	var operator query.Operator
+// Write v as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
 
-	switch params[1] {
-	case "equal":
-		operator = query.MatchEqual
-	case "notequal":
-		operator = query.MatchNotEqual
-	case "in":
-		operator = query.MatchIn
-	case "notin":
-		operator = query.MatchNotIn
+		return
 	}
 
-	values := strings.Split(params[2], ",")
-
-	return query.Query{Op: operator, Key: key, Values: values}, nil
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(bytes) // nolint:errcheck
 }
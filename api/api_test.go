@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"testing"
 	"time"
 
 	"github.com/project-safari/zebra"
 	"github.com/project-safari/zebra/api"
+	"github.com/project-safari/zebra/auth"
 	"github.com/project-safari/zebra/network"
 	"github.com/stretchr/testify/assert"
 	"gojini.dev/web"
@@ -18,15 +20,17 @@ import (
 //nolint:gochecknoglobals
 var (
 	resource1 = `{"VLANPool":[{"id":"0100000001","type":"VLANPool","labels":{"owner":"shravya"},` +
-		`"rangeStart":0,"rangeEnd":10}]}`
+		`"version":1,"rangeStart":0,"rangeEnd":10}]}`
 	resource2 = `{"VLANPool":[{"id":"0100000002","type":"VLANPool","labels":{"owner":"nandyala"},` +
-		`"rangeStart":1,"rangeEnd":5}]}`
+		`"version":1,"rangeStart":1,"rangeEnd":5}]}`
 	resources = `{"VLANPool":[{"id":"0100000001","type":"VLANPool","labels":{"owner":"shravya"},` +
-		`"rangeStart":0,"rangeEnd":10},{"id":"0100000002","type":"VLANPool","labels":{"owner":"nandyala"},` +
-		`"rangeStart":1,"rangeEnd":5}]}`
+		`"version":1,"rangeStart":0,"rangeEnd":10},` +
+		`{"id":"0100000002","type":"VLANPool","labels":{"owner":"nandyala"},` +
+		`"version":1,"rangeStart":1,"rangeEnd":5}]}`
 	otherResources = `{"VLANPool":[{"id":"0100000002","type":"VLANPool","labels":{"owner":"nandyala"},` +
-		`"rangeStart":1,"rangeEnd":5},{"id":"0100000001","type":"VLANPool","labels":{"owner":"shravya"},` +
-		`"rangeStart":0,"rangeEnd":10}]}`
+		`"version":1,"rangeStart":1,"rangeEnd":5},` +
+		`{"id":"0100000001","type":"VLANPool","labels":{"owner":"shravya"},` +
+		`"version":1,"rangeStart":0,"rangeEnd":10}]}`
 	noResources = "{}"
 )
 
@@ -61,7 +65,7 @@ func TestGetResources(t *testing.T) {
 		TLS:     nil,
 	}
 
-	server := web.NewServer(cfg, http.HandlerFunc(myAPI.GetResources))
+	server := web.NewServer(cfg, asAdmin(myAPI.GetResources))
 	assert.NotNil(server)
 
 	ctx := context.Background()
@@ -96,7 +100,7 @@ func TestGetResourcesByID(t *testing.T) {
 		TLS:     nil,
 	}
 
-	server := web.NewServer(cfg, http.HandlerFunc(myAPI.GetResourcesByID))
+	server := web.NewServer(cfg, asAdmin(myAPI.GetResources))
 	assert.NotNil(server)
 
 	ctx := context.Background()
@@ -152,7 +156,7 @@ func TestGetResourcesByType(t *testing.T) {
 		TLS:     nil,
 	}
 
-	server := web.NewServer(cfg, http.HandlerFunc(myAPI.GetResourcesByType))
+	server := web.NewServer(cfg, asAdmin(myAPI.GetResources))
 	assert.NotNil(server)
 
 	ctx := context.Background()
@@ -197,7 +201,7 @@ func TestGetResourcesByProperty(t *testing.T) { // nolint:funlen
 		Address: web.NewAddress("127.0.0.1:9996"),
 		TLS:     nil,
 	}
-	server := web.NewServer(cfg, http.HandlerFunc(myAPI.GetResourcesByProperty))
+	server := web.NewServer(cfg, asAdmin(myAPI.GetResources))
 
 	assert.NotNil(server)
 
@@ -208,7 +212,8 @@ func TestGetResourcesByProperty(t *testing.T) { // nolint:funlen
 	}()
 	time.Sleep(time.Second)
 
-	resp, err := http.Get(fmt.Sprintf("http://%s?property=Type-in-VLANPool,IPAddressPool", cfg.Address))
+	resp, err := http.Get(fmt.Sprintf("http://%s?property=%s", cfg.Address,
+		url.QueryEscape("Type in (VLANPool,IPAddressPool)")))
 	assert.True(err == nil && resp != nil)
 
 	body, err := ioutil.ReadAll(resp.Body)
@@ -217,7 +222,8 @@ func TestGetResourcesByProperty(t *testing.T) { // nolint:funlen
 	assert.True(string(body) == resources || string(body) == otherResources)
 	assert.Nil(resp.Body.Close())
 
-	resp, err = http.Get(fmt.Sprintf("http://%s?property=Type-notin-VLANPool,IPAddressPool", cfg.Address))
+	resp, err = http.Get(fmt.Sprintf("http://%s?property=%s", cfg.Address,
+		url.QueryEscape("Type notin (VLANPool,IPAddressPool)")))
 	assert.True(err == nil && resp != nil)
 
 	body, err = ioutil.ReadAll(resp.Body)
@@ -226,7 +232,7 @@ func TestGetResourcesByProperty(t *testing.T) { // nolint:funlen
 	assert.Equal(noResources, string(body))
 	assert.Nil(resp.Body.Close())
 
-	resp, err = http.Get(fmt.Sprintf("http://%s?property=Type-equal-VLANPool", cfg.Address))
+	resp, err = http.Get(fmt.Sprintf("http://%s?property=%s", cfg.Address, url.QueryEscape("Type = VLANPool")))
 	assert.True(err == nil && resp != nil)
 
 	body, err = ioutil.ReadAll(resp.Body)
@@ -235,7 +241,7 @@ func TestGetResourcesByProperty(t *testing.T) { // nolint:funlen
 	assert.True(string(body) == resources || string(body) == otherResources)
 	assert.Nil(resp.Body.Close())
 
-	resp, err = http.Get(fmt.Sprintf("http://%s?property=Type-notequal-VLANPool", cfg.Address))
+	resp, err = http.Get(fmt.Sprintf("http://%s?property=%s", cfg.Address, url.QueryEscape("Type != VLANPool")))
 	assert.True(err == nil && resp != nil)
 
 	body, err = ioutil.ReadAll(resp.Body)
@@ -244,7 +250,7 @@ func TestGetResourcesByProperty(t *testing.T) { // nolint:funlen
 	assert.Equal(noResources, string(body))
 	assert.Nil(resp.Body.Close())
 
-	resp, err = http.Get(fmt.Sprintf("http://%s?property=Type-notequal", cfg.Address))
+	resp, err = http.Get(fmt.Sprintf("http://%s?property=%s", cfg.Address, url.QueryEscape("Type !=")))
 	assert.True(err == nil && resp != nil)
 	assert.True(resp.StatusCode == 400)
 	assert.Nil(server.Stop(ctx, nil))
@@ -262,7 +268,7 @@ func TestGetResourcesByLabel(t *testing.T) { // nolint:funlen
 		Address: web.NewAddress("127.0.0.1:9995"),
 		TLS:     nil,
 	}
-	server := web.NewServer(cfg, http.HandlerFunc(myAPI.GetResourcesByLabel))
+	server := web.NewServer(cfg, asAdmin(myAPI.GetResources))
 	assert.NotNil(server)
 
 	ctx := context.Background()
@@ -272,7 +278,7 @@ func TestGetResourcesByLabel(t *testing.T) { // nolint:funlen
 	}()
 	time.Sleep(time.Second)
 
-	resp, err := http.Get(fmt.Sprintf("http://%s?label=owner-in-shravya,nandyala", cfg.Address))
+	resp, err := http.Get(fmt.Sprintf("http://%s?label=%s", cfg.Address, url.QueryEscape("owner in (shravya, nandyala)")))
 	assert.Nil(err)
 	assert.NotNil(resp)
 
@@ -282,7 +288,7 @@ func TestGetResourcesByLabel(t *testing.T) { // nolint:funlen
 	assert.True(string(body) == resources || string(body) == otherResources)
 	assert.Nil(resp.Body.Close())
 
-	resp, err = http.Get(fmt.Sprintf("http://%s?label=owner-notin-shravya,nandyala", cfg.Address))
+	resp, err = http.Get(fmt.Sprintf("http://%s?label=%s", cfg.Address, url.QueryEscape("owner notin (shravya,nandyala)")))
 	assert.True(err == nil && resp != nil)
 
 	body, err = ioutil.ReadAll(resp.Body)
@@ -291,7 +297,7 @@ func TestGetResourcesByLabel(t *testing.T) { // nolint:funlen
 	assert.Equal(noResources, string(body))
 	assert.Nil(resp.Body.Close())
 
-	resp, err = http.Get(fmt.Sprintf("http://%s?label=owner-equal-shravya", cfg.Address))
+	resp, err = http.Get(fmt.Sprintf("http://%s?label=%s", cfg.Address, url.QueryEscape("owner = shravya")))
 	assert.True(err == nil && resp != nil)
 
 	body, err = ioutil.ReadAll(resp.Body)
@@ -300,7 +306,7 @@ func TestGetResourcesByLabel(t *testing.T) { // nolint:funlen
 	assert.Equal(resource1, string(body))
 	assert.Nil(resp.Body.Close())
 
-	resp, err = http.Get(fmt.Sprintf("http://%s?label=owner-notequal-shravya", cfg.Address))
+	resp, err = http.Get(fmt.Sprintf("http://%s?label=%s", cfg.Address, url.QueryEscape("owner != shravya")))
 	assert.True(err == nil && resp != nil)
 
 	body, err = ioutil.ReadAll(resp.Body)
@@ -309,8 +315,53 @@ func TestGetResourcesByLabel(t *testing.T) { // nolint:funlen
 	assert.Equal(resource2, string(body))
 	assert.Nil(resp.Body.Close())
 
-	resp, err = http.Get(fmt.Sprintf("http://%s?label=owner-notequal", cfg.Address))
+	resp, err = http.Get(fmt.Sprintf("http://%s?label=%s", cfg.Address, url.QueryEscape("owner !=")))
 	assert.True(err == nil && resp != nil)
 	assert.True(resp.StatusCode == 400)
 	assert.Nil(server.Stop(ctx, nil))
 }
+
+func TestGetResourcesFilters(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	myAPI := newLeaseAPI(t, "filterstore1", map[string]zebra.Labels{
+		"0100000001": {"owner": "shravya", "pool": "perf"},
+		"0100000002": {"owner": "shravya", "pool": "gpu"},
+		"0100000003": {"owner": "nandyala", "pool": "perf"},
+	})
+
+	get := func(query string) string {
+		rec := serve(myAPI.GetResources, http.MethodGet, "/api/v1/resources?"+query, "")
+		assert.Equal(http.StatusOK, rec.Code, query)
+
+		return rec.Body.String()
+	}
+
+	// Every filter given applies.
+	body := get("type=VLANPool&label=" + url.QueryEscape("owner = shravya"))
+	assert.Contains(body, "0100000001")
+	assert.Contains(body, "0100000002")
+	assert.NotContains(body, "0100000003")
+
+	body = get("label=" + url.QueryEscape("owner = shravya") + "&property=" + url.QueryEscape("ID != 0100000001"))
+	assert.NotContains(body, "0100000001")
+	assert.Contains(body, "0100000002")
+	assert.NotContains(body, "0100000003")
+
+	body = get("id=0100000001,0100000003&label=" + url.QueryEscape("pool = perf") + "&type=VLANPool")
+	assert.Contains(body, "0100000001")
+	assert.Contains(body, "0100000003")
+	assert.NotContains(body, "0100000002")
+
+	body = get("id=0100000002&label=" + url.QueryEscape("pool = perf"))
+	assert.NotContains(body, "01000000")
+
+	body = get("type=IPAddressPool&label=" + url.QueryEscape("pool = perf"))
+	assert.NotContains(body, "01000000")
+
+	// Readers must be allowed to read the types they ask for.
+	rec := serve(as("shravya", auth.RoleDeveloper, myAPI.GetResources), http.MethodGet,
+		"/api/v1/resources?type=VLANPool,User&label="+url.QueryEscape("owner = shravya"), "")
+	assert.Equal(http.StatusForbidden, rec.Code)
+}
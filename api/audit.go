@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/audit"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/lease"
+)
+
+// AuditFile is the name of the audit log file in the storage root.
+const AuditFile = "audit.jsonl"
+
+// GetAudit returns the audit records, oldest first. The "user", "resource"
+// and "type" parameters select the records of changes made by the given user,
+// to the resource with the given ID or leases holding it, or to resources of
+// the given type. The
+// "from" and "to" parameters, RFC 3339 times, select the records of changes
+// made from the one time up to the other.
+func (api *ResourceAPI) GetAudit(w http.ResponseWriter, req *http.Request) {
+	if authorize(w, req, auth.VerbRead, audit.Type) == nil {
+		return
+	}
+
+	filter, err := auditFilter(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	records, err := api.audit.Query(filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, records)
+}
+
+// Return the filter given by the query parameters of the audit request.
+func auditFilter(req *http.Request) (audit.Filter, error) {
+	params := req.URL.Query()
+	filter := audit.Filter{
+		User:  params.Get("user"),
+		ID:    params.Get("resource"),
+		Type:  params.Get("type"),
+		Since: time.Time{},
+		Until: time.Time{},
+	}
+
+	for param, t := range map[string]*time.Time{"from": &filter.Since, "to": &filter.Until} {
+		if value := params.Get(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, badParam(param, err)
+			}
+
+			*t = parsed
+		}
+	}
+
+	return filter, nil
+}
+
+// Append a record of the change from before to after, made by the given
+// user, to the log. Changes without a user are recorded for audit.System.
+func appendRecord(log *audit.Log, user string, action string, before zebra.Resource, after zebra.Resource) error {
+	changes, err := audit.Diff(before, after)
+	if err != nil {
+		return err
+	}
+
+	res := after
+	if res == nil {
+		res = before
+	}
+
+	if user == "" {
+		user = audit.System
+	}
+
+	return log.Append(audit.Record{
+		Time:      time.Now(),
+		User:      user,
+		Action:    action,
+		ID:        res.GetID(),
+		Type:      res.GetType(),
+		Resources: heldResources(res),
+		Changes:   changes,
+	})
+}
+
+// Return the IDs of the resources that the resource holds if it is a lease,
+// so that the records of the lease are found by the resources too.
+func heldResources(res zebra.Resource) []string {
+	if l, ok := res.(*lease.Lease); ok {
+		return l.Resources
+	}
+
+	return nil
+}
+
+// leaseRecorder records the changes made by the lease manager in the audit
+// log, attributing each to the user whose request made it.
+type leaseRecorder struct {
+	log *audit.Log
+}
+
+func (r *leaseRecorder) Record(ctx context.Context, action string, before zebra.Resource, after zebra.Resource) {
+	user := ""
+	if claims := auth.FromContext(ctx); claims != nil {
+		user = claims.Subject
+	}
+
+	if err := appendRecord(r.log, user, action, before, after); err != nil {
+		logr.FromContextOrDiscard(ctx).Error(err, "failed to record lease change", "action", action)
+	}
+}
@@ -0,0 +1,76 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/audit"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/lease"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudit(t *testing.T) { // nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	myAPI := newLeaseAPI(t, "auditstore1", map[string]zebra.Labels{"0100000001": nil})
+	start := time.Now().Add(-time.Second)
+
+	rec := serve(as("shravya", auth.RoleDeveloper, myAPI.CreateLease), http.MethodPost, "/api/v1/leases",
+		`{"owner":"shravya","resources":["0100000001"],"duration":"1h"}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	l := new(lease.Lease)
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), l))
+
+	rec = serve(as("nandyala", auth.RoleAdmin, myAPI.DeleteLease), http.MethodDelete, "/api/v1/leases?id="+l.ID, "")
+	assert.Equal(http.StatusNoContent, rec.Code)
+
+	query := func(params string) []*audit.Record {
+		rec := serve(myAPI.GetAudit, http.MethodGet, "/api/v1/audit?"+params, "")
+		assert.Equal(http.StatusOK, rec.Code)
+
+		records := []*audit.Record{}
+		assert.Nil(json.Unmarshal(rec.Body.Bytes(), &records))
+
+		return records
+	}
+
+	records := query("resource=" + l.ID)
+	assert.Len(records, 2)
+	assert.Equal("shravya", records[0].User)
+	assert.Equal(lease.ActionAcquire, records[0].Action)
+	assert.Equal(lease.Type, records[0].Type)
+	assert.Contains(records[0].Changes, audit.Change{Path: "owner", Before: nil, After: "shravya"})
+	assert.Equal("nandyala", records[1].User)
+	assert.Equal(lease.ActionRelease, records[1].Action)
+
+	// Lease records are found by the resources they hold as well.
+	records = query("resource=0100000001")
+	assert.Len(records, 2)
+	assert.Equal(l.ID, records[0].ID)
+	assert.Equal([]string{"0100000001"}, records[0].Resources)
+	assert.Equal(lease.ActionRelease, records[1].Action)
+
+	records = query("user=nandyala&type=" + lease.Type)
+	assert.Len(records, 1)
+	assert.Equal(lease.ActionRelease, records[0].Action)
+
+	records = query("from=" + url.QueryEscape(start.Format(time.RFC3339)))
+	assert.Len(records, 2)
+
+	records = query("to=" + url.QueryEscape(start.Format(time.RFC3339)))
+	assert.Empty(records)
+
+	rec = serve(myAPI.GetAudit, http.MethodGet, "/api/v1/audit?from=yesterday", "")
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	// Only admins may read the audit log.
+	rec = serve(as("shravya", auth.RoleDeveloper, myAPI.GetAudit), http.MethodGet, "/api/v1/audit", "")
+	assert.Equal(http.StatusForbidden, rec.Code)
+}
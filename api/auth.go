@@ -0,0 +1,206 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+)
+
+var ErrLoginFailed = errors.New("user name or password is incorrect")
+
+var ErrUnauthenticated = errors.New("request is missing a bearer token")
+
+var ErrAuthDisabled = errors.New("token authentication is not configured")
+
+// Path of the login endpoint, which is the only one that may be used without
+// a token.
+const LoginPath = "/api/v1/login"
+
+// Path of the lease calendar, which also accepts calendar tokens in its
+// "token" query parameter.
+const CalendarPath = "/api/v1/leases.ics"
+
+// A loginRequest holds the credentials a user logs in with.
+type loginRequest struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+// A loginResponse holds the token issued to a user and when it expires.
+type loginResponse struct {
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+// SetSigner sets the signer used to issue tokens at login and to verify them
+// in RequireAuth.
+func (api *ResourceAPI) SetSigner(signer *auth.Signer) {
+	api.signer = signer
+}
+
+// Login checks the name and password in the request body against the stored
+// users and returns a bearer token for the user.
+func (api *ResourceAPI) Login(w http.ResponseWriter, req *http.Request) {
+	if api.signer == nil {
+		writeError(w, http.StatusServiceUnavailable, ErrAuthDisabled)
+
+		return
+	}
+
+	login := new(loginRequest)
+	if err := json.NewDecoder(req.Body).Decode(login); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	user := api.findUser(login.Name)
+	if user == nil || !user.CheckPassword(login.Password) {
+		writeError(w, http.StatusUnauthorized, ErrLoginFailed)
+
+		return
+	}
+
+	token, claims, err := api.signer.Issue(user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, loginResponse{Token: token, Expires: time.Unix(claims.Expires, 0)})
+}
+
+// RequireAuth returns a handler that rejects requests to next without a valid
+// bearer token in the Authorization header, except for the login endpoint.
+// Requests for the lease calendar may instead carry a calendar token in the
+// "token" query parameter, as calendar clients cannot send headers; scoped
+// tokens are accepted nowhere else. Tokens of users that no longer exist or
+// have changed their password since are rejected, as checked by
+// auth.Signer.Check. The claims of the token, with the user's current role
+// and groups, are added to the request context.
+func (api *ResourceAPI) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == LoginPath {
+			next.ServeHTTP(w, req)
+
+			return
+		}
+
+		if api.signer == nil {
+			writeError(w, http.StatusServiceUnavailable, ErrAuthDisabled)
+
+			return
+		}
+
+		scope := ""
+		header := req.Header.Get("Authorization")
+		token := strings.TrimPrefix(header, "Bearer ")
+
+		if param := req.URL.Query().Get("token"); param != "" && req.URL.Path == CalendarPath {
+			scope = auth.ScopeCalendar
+			header = ""
+			token = param
+		}
+
+		if token == "" || token == header {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="zebra"`)
+			writeError(w, http.StatusUnauthorized, ErrUnauthenticated)
+
+			return
+		}
+
+		claims, err := api.signer.Verify(token)
+		if err == nil && claims.Scope != scope {
+			err = auth.ErrTokenScope
+		}
+
+		if err == nil {
+			err = api.signer.Check(claims, api.findUser(claims.Subject))
+		}
+
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="zebra", error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, err)
+
+			return
+		}
+
+		next.ServeHTTP(w, req.WithContext(auth.NewContext(req.Context(), claims)))
+	})
+}
+
+// Return the stored user with the given name, or nil if there is none.
+func (api *ResourceAPI) findUser(name string) *zebra.User {
+	if name == "" {
+		return nil
+	}
+
+	for _, list := range api.queryStore.QueryType([]string{userType}).Resources {
+		for _, res := range list.Resources {
+			if user, ok := res.(*zebra.User); ok && user.Name == name {
+				return user
+			}
+		}
+	}
+
+	return nil
+}
+
+// Return the claims of the user making req, or write a 401 error and return
+// nil if the request is not authenticated.
+func authenticated(w http.ResponseWriter, req *http.Request) *auth.Claims {
+	claims := auth.FromContext(req.Context())
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, ErrUnauthenticated)
+	}
+
+	return claims
+}
+
+// Return the claims of the user making req if their role permits verb on
+// every one of the given types. Otherwise write a 401 or 403 error and return
+// nil.
+func authorize(w http.ResponseWriter, req *http.Request, verb auth.Verb, types ...string) *auth.Claims {
+	claims := authenticated(w, req)
+	if claims == nil {
+		return nil
+	}
+
+	if err := claims.Authorize(verb, types...); err != nil {
+		writeError(w, http.StatusForbidden, err)
+
+		return nil
+	}
+
+	return claims
+}
+
+// Return ErrForbidden unless the user in claims is the given owner or their
+// role permits verb on resType.
+func mayManage(claims *auth.Claims, owner string, verb auth.Verb, resType string) error {
+	if owner == claims.Subject {
+		return nil
+	}
+
+	return claims.Authorize(verb, resType)
+}
+
+// Return a copy of resMap holding only the resource types that the role in
+// claims may read.
+func readable(claims *auth.Claims, resMap *zebra.ResourceMap) *zebra.ResourceMap {
+	filtered := zebra.NewResourceMap(resMap.GetFactory())
+
+	for resType, list := range resMap.Resources {
+		if auth.Allowed(claims.Role, auth.VerbRead, resType) {
+			filtered.Resources[resType] = list
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,258 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/api"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// Return a handler that calls h as the user with the given name and role.
+func as(name string, role string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		claims := &auth.Claims{Subject: name, Role: role}
+		h(w, req.WithContext(auth.NewContext(req.Context(), claims)))
+	}
+}
+
+func asAdmin(h http.HandlerFunc) http.HandlerFunc {
+	return as("admin", auth.RoleAdmin, h)
+}
+
+func TestLogin(t *testing.T) { // nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "authstore1"
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	factory := zebra.Factory().Add("User", func() zebra.Resource { return new(zebra.User) })
+
+	fs := store.NewFileStore(root, factory)
+	assert.Nil(fs.Initialize())
+
+	user := new(zebra.User)
+	user.ID = "0100000001"
+	user.Type = "User"
+	user.Name = "shravya"
+	user.Role = "developer"
+	assert.Nil(user.SetPassword("Riddikulus!42"))
+	assert.Nil(fs.Create(user))
+
+	myAPI := api.NewResourceAPI(factory)
+	assert.Nil(myAPI.Initialize(root))
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		claims := auth.FromContext(req.Context())
+		w.Write([]byte(claims.Subject + " " + claims.Role)) // nolint:errcheck
+	})
+	handler := myAPI.RequireAuth(next)
+
+	// Not configured yet.
+	rec := serve(myAPI.Login, http.MethodPost, api.LoginPath, `{"name":"shravya","password":"Riddikulus!42"}`)
+	assert.Equal(http.StatusServiceUnavailable, rec.Code)
+
+	signer, err := auth.NewSigner([]byte("0123456789abcdef0123456789abcdef"), time.Hour)
+	assert.Nil(err)
+	myAPI.SetSigner(signer)
+
+	rec = serve(myAPI.Login, http.MethodPost, api.LoginPath, `{"name":"shravya","password":"wrong"}`)
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+
+	rec = serve(myAPI.Login, http.MethodPost, api.LoginPath, `{"name":"nobody","password":"Riddikulus!42"}`)
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+
+	rec = serve(myAPI.Login, http.MethodPost, api.LoginPath, `{"name":`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = serve(myAPI.Login, http.MethodPost, api.LoginPath, `{"name":"shravya","password":"Riddikulus!42"}`)
+	assert.Equal(http.StatusOK, rec.Code)
+
+	login := struct {
+		Token   string    `json:"token"`
+		Expires time.Time `json:"expires"`
+	}{}
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), &login))
+	assert.NotEmpty(login.Token)
+	assert.True(login.Expires.After(time.Now()))
+
+	// No token, a malformed header and a bad token are rejected.
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/leases", nil))
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+	assert.NotEmpty(rec.Header().Get("WWW-Authenticate"))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/leases", nil)
+	req.Header.Set("Authorization", login.Token)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/leases", nil)
+	req.Header.Set("Authorization", "Bearer "+strings.ToUpper(login.Token))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/leases", nil)
+	req.Header.Set("Authorization", "Bearer "+login.Token)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("shravya developer", rec.Body.String())
+
+	// Calendar tokens are only accepted in the URL of the calendar, which is
+	// the only place tokens are accepted in the URL.
+	rec = serve(as("shravya", auth.RoleDeveloper, myAPI.CreateCalendarToken), http.MethodPost,
+		api.CalendarPath+"/token", "")
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	calendar := struct {
+		Token string `json:"token"`
+		URL   string `json:"url"`
+	}{}
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), &calendar))
+	assert.Equal(api.CalendarPath+"?token="+calendar.Token, calendar.URL)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, calendar.URL+"&owner=shravya", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("shravya developer", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/leases?token="+calendar.Token, nil))
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/leases", nil)
+	req.Header.Set("Authorization", "Bearer "+calendar.Token)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, api.CalendarPath+"?token="+login.Token, nil))
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+
+	// The login endpoint itself needs no token.
+	loginHandler := myAPI.RequireAuth(http.HandlerFunc(myAPI.Login))
+	rec = httptest.NewRecorder()
+	loginHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, api.LoginPath,
+		strings.NewReader(`{"name":"shravya","password":"Riddikulus!42"}`)))
+	assert.Equal(http.StatusOK, rec.Code)
+
+	withToken := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/leases", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	// Tokens carry the user's role as it is stored now.
+	rec = serve(myAPI.UpdateResource, http.MethodPut, "/api/v1/resources",
+		`{"id":"0100000001","type":"User","name":"shravya","role":"read-only"}`)
+	assert.Equal(http.StatusOK, rec.Code)
+
+	rec = withToken(login.Token)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("shravya read-only", rec.Body.String())
+
+	// Changing the password revokes the tokens issued before.
+	rec = serve(myAPI.SetPassword, http.MethodPost, "/api/v1/users/password",
+		`{"name":"shravya","password":"Expecto!Patronum9"}`)
+	assert.Equal(http.StatusNoContent, rec.Code)
+
+	rec = withToken(login.Token)
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+	assert.Equal(auth.ErrTokenRevoked.Error(), responseError(t, rec).Message)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, calendar.URL, nil))
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+
+	rec = serve(myAPI.Login, http.MethodPost, api.LoginPath, `{"name":"shravya","password":"Expecto!Patronum9"}`)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), &login))
+	assert.Equal(http.StatusOK, withToken(login.Token).Code)
+
+	// So does deleting the user.
+	rec = serve(myAPI.DeleteResource, http.MethodDelete, "/api/v1/resources?id=0100000001", "")
+	assert.Equal(http.StatusNoContent, rec.Code)
+	assert.Equal(http.StatusUnauthorized, withToken(login.Token).Code)
+}
+
+func TestAuthorization(t *testing.T) { // nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	myAPI := newLeaseAPI(t, "authstore2", map[string]zebra.Labels{"0100000001": nil, "0100000002": nil})
+
+	// Not authenticated.
+	rec := httptest.NewRecorder()
+	myAPI.GetLeases(rec, httptest.NewRequest(http.MethodGet, "/api/v1/leases", nil))
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+
+	// Anyone may read, but read-only users and clients may not lease a
+	// VLANPool.
+	rec = serve(as("eve", auth.RoleReadOnly, myAPI.GetLeases), http.MethodGet, "/api/v1/leases", "")
+	assert.Equal(http.StatusOK, rec.Code)
+
+	rec = serve(as("eve", auth.RoleReadOnly, myAPI.CreateLease), http.MethodPost, "/api/v1/leases",
+		`{"resources":["0100000001"],"duration":"1h"}`)
+	assert.Equal(http.StatusForbidden, rec.Code)
+	assert.Contains(rec.Body.String(), auth.ErrForbidden.Error())
+
+	rec = serve(as("carol", auth.RoleClient, myAPI.CreateLease), http.MethodPost, "/api/v1/leases",
+		`{"selector":{"type":"VLANPool","count":1},"duration":"1h"}`)
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	// Developers may, but only for themselves.
+	rec = serve(as("shravya", auth.RoleDeveloper, myAPI.CreateLease), http.MethodPost, "/api/v1/leases",
+		`{"owner":"nandyala","resources":["0100000001"],"duration":"1h"}`)
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	rec = serve(as("shravya", auth.RoleDeveloper, myAPI.CreateLease), http.MethodPost, "/api/v1/leases",
+		`{"resources":["0100000001"],"duration":"1h"}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	l := new(lease.Lease)
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), l))
+	assert.Equal("shravya", l.Owner)
+
+	// Only the owner or an admin may renew or release it.
+	rec = serve(as("nandyala", auth.RoleDeveloper, myAPI.RenewLease), http.MethodPost,
+		"/api/v1/leases/renew?id="+l.ID+"&extend=1h", "")
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	rec = serve(as("shravya", auth.RoleDeveloper, myAPI.RenewLease), http.MethodPost,
+		"/api/v1/leases/renew?id="+l.ID+"&extend=1h", "")
+	assert.Equal(http.StatusOK, rec.Code)
+
+	rec = serve(as("nandyala", auth.RoleDeveloper, myAPI.DeleteLease), http.MethodDelete,
+		"/api/v1/leases?id="+l.ID, "")
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	rec = serve(myAPI.DeleteLease, http.MethodDelete, "/api/v1/leases?id="+l.ID, "")
+	assert.Equal(http.StatusNoContent, rec.Code)
+
+	// Users and credentials are hidden from everyone but admins.
+	rec = serve(as("shravya", auth.RoleDeveloper, myAPI.GetResources), http.MethodGet,
+		"/api/v1/resources?type=VLANPool,User", "")
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	rec = serve(as("shravya", auth.RoleDeveloper, myAPI.GetResources), http.MethodGet,
+		"/api/v1/resources?type=VLANPool", "")
+	assert.Equal(http.StatusOK, rec.Code)
+}
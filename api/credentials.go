@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+)
+
+var ErrNotLeased = errors.New("resource is not held by a lease of the user")
+
+// GetCredentials returns the resource given in the "id" query parameter with
+// the values of its credential keys, which all other responses redact.
+// Password hashes are left out all the same. The user must be permitted to
+// reveal them, as checked by mayReveal. Each reveal is logged.
+func (api *ResourceAPI) GetCredentials(w http.ResponseWriter, req *http.Request) {
+	claims := authenticated(w, req)
+	if claims == nil {
+		return
+	}
+
+	id := req.URL.Query().Get("id")
+
+	res := api.find(id)
+	if res == nil {
+		writeError(w, http.StatusNotFound, badParam("id", ErrResourceNotFound))
+
+		return
+	}
+
+	if err := api.mayReveal(claims, res); err != nil {
+		writeError(w, http.StatusForbidden, err)
+
+		return
+	}
+
+	logr.FromContextOrDiscard(req.Context()).Info("credentials revealed",
+		"user", claims.Subject, "id", id, "type", res.GetType())
+
+	writeMarshaled(w, http.StatusOK, res, zebra.MarshalRevealed)
+}
+
+// Return an error unless the user may reveal the credentials of the resource.
+// Their role must permit revealing the credentials of resources of its type,
+// or of those that they lease, in which case one of their leases must hold
+// the resource now.
+func (api *ResourceAPI) mayReveal(claims *auth.Claims, res zebra.Resource) error {
+	if claims.Authorize(auth.VerbReveal, res.GetType()) == nil {
+		return nil
+	}
+
+	if err := claims.Authorize(auth.VerbRevealLeased, res.GetType()); err != nil {
+		return err
+	}
+
+	if l := api.leases.Get(api.leases.HeldBy(res.GetID())); l == nil || l.Owner != claims.Subject {
+		return ErrNotLeased
+	}
+
+	return nil
+}
+
+// Return the resource with the given ID, or nil if there is none.
+func (api *ResourceAPI) find(id string) zebra.Resource {
+	return api.store.get(id)
+}
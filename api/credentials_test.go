@@ -0,0 +1,130 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/api"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/compute"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentials(t *testing.T) { // nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "credstore1"
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	factory := zebra.Factory().
+		Add("VM", func() zebra.Resource { return new(compute.VM) }).
+		Add("Switch", func() zebra.Resource { return new(network.Switch) })
+
+	fs := store.NewFileStore(root, factory)
+	assert.Nil(fs.Initialize())
+
+	vm := new(compute.VM)
+	vm.ID = "0100000001"
+	vm.Type = "VM"
+	vm.Name = "build-vm"
+	vm.ESXID = "0200000001"
+	vm.VCenterID = "0300000001"
+	vm.ManagementIP = net.ParseIP("10.0.0.2")
+	vm.Credentials.ID = "0100000002"
+	vm.Credentials.Type = "Credentials"
+	vm.Credentials.Name = "root"
+	vm.Credentials.Keys = map[string]string{"password": "properPass123$"}
+	assert.Nil(fs.Create(vm))
+
+	sw := new(network.Switch)
+	sw.ID = "0100000003"
+	sw.Type = "Switch"
+	sw.ManagementIP = net.ParseIP("10.0.0.1")
+	sw.SerialNumber = "FDO1234"
+	sw.Model = "N9K"
+	sw.NumPorts = 48
+	sw.Credentials.ID = "0100000004"
+	sw.Credentials.Type = "Credentials"
+	sw.Credentials.Name = "admin"
+	sw.Credentials.Keys = map[string]string{"password": "switchPass123$"}
+	assert.Nil(fs.Create(sw))
+
+	myAPI := api.NewResourceAPI(factory)
+	assert.Nil(myAPI.Initialize(root))
+
+	// Secrets are redacted everywhere.
+	for _, target := range []string{"", "?id=0100000001,0100000003", "?type=VM,Switch"} {
+		rec := serve(myAPI.GetResources, http.MethodGet, "/api/v1/resources"+target, "")
+		assert.Equal(http.StatusOK, rec.Code)
+		assert.NotContains(rec.Body.String(), "properPass123$")
+		assert.NotContains(rec.Body.String(), "switchPass123$")
+		assert.Contains(rec.Body.String(), `"password":"********"`)
+	}
+
+	// Revealing is allowed by role and logged.
+	var logs bytes.Buffer
+
+	logger := funcr.New(func(prefix, args string) { logs.WriteString(args) }, funcr.Options{})
+
+	reveal := func(name string, role string, id string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/resources/credentials?id="+id, nil)
+		ctx := logr.NewContext(req.Context(), logger)
+		ctx = auth.NewContext(ctx, &auth.Claims{Subject: name, Role: role})
+		myAPI.GetCredentials(rec, req.WithContext(ctx))
+
+		return rec
+	}
+
+	rec := reveal("eve", auth.RoleReadOnly, "0100000001")
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	rec = reveal("carol", auth.RoleClient, "0100000003")
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	rec = reveal("carol", auth.RoleClient, "0100000009")
+	assert.Equal(http.StatusNotFound, rec.Code)
+
+	// Clients and developers may only reveal what they lease.
+	rec = reveal("carol", auth.RoleClient, "0100000001")
+	assert.Equal(http.StatusForbidden, rec.Code)
+	assert.Contains(rec.Body.String(), api.ErrNotLeased.Error())
+	assert.Empty(logs.String())
+
+	rec = serve(as("carol", auth.RoleClient, myAPI.CreateLease), http.MethodPost, "/api/v1/leases",
+		`{"resources":["0100000001"],"duration":"1h"}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	rec = reveal("shravya", auth.RoleDeveloper, "0100000001")
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	rec = reveal("shravya", auth.RoleDeveloper, "0100000003")
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	rec = reveal("alice", auth.RoleAdmin, "0100000003")
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), "switchPass123$")
+
+	rec = reveal("carol", auth.RoleClient, "0100000001")
+	assert.Equal(http.StatusOK, rec.Code)
+
+	revealed := new(compute.VM)
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), revealed))
+	assert.Equal("properPass123$", revealed.Credentials.Keys["password"])
+	assert.Contains(logs.String(), `"msg"="credentials revealed" "user"="carol" "id"="0100000001" "type"="VM"`)
+
+	rec = httptest.NewRecorder()
+	myAPI.GetCredentials(rec, httptest.NewRequest(http.MethodGet, "/api/v1/resources/credentials?id=0100000001", nil))
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+}
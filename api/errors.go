@@ -0,0 +1,120 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/go-logr/logr"
+)
+
+var ErrInternal = errors.New("internal server error")
+
+var ErrRouteNotFound = errors.New("no such endpoint")
+
+var ErrMethodNotAllowed = errors.New("method not allowed for this endpoint")
+
+// Error is the body of every error response, within an "error" object. Code
+// tells clients what kind of error it is without parsing Message, and Param
+// names the query parameter that caused it, if any.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Param   string `json:"param,omitempty"`
+}
+
+type errorResponse struct {
+	Error Error `json:"error"`
+}
+
+// Codes of errors by their HTTP status.
+var codes = map[int]string{ //nolint:gochecknoglobals
+	http.StatusBadRequest:            "invalid_request",
+	http.StatusUnauthorized:          "unauthenticated",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusGone:                  "gone",
+	http.StatusPreconditionFailed:    "precondition_failed",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusServiceUnavailable:    "unavailable",
+	http.StatusRequestEntityTooLarge: "too_large",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+}
+
+// A paramError is an error caused by the value of a query parameter.
+type paramError struct {
+	param string
+	err   error
+}
+
+func (e *paramError) Error() string {
+	return e.err.Error()
+}
+
+func (e *paramError) Unwrap() error {
+	return e.err
+}
+
+// Return err as caused by the value of the given query parameter.
+func badParam(param string, err error) error {
+	return &paramError{param: param, err: err}
+}
+
+// Return the Error describing err for a response with the given status code.
+func newError(status int, err error) Error {
+	e := Error{Code: codes[status], Message: err.Error(), Param: ""}
+	if e.Code == "" {
+		e.Code = "error"
+	}
+
+	var pe *paramError
+	if errors.As(err, &pe) {
+		e.Param = pe.param
+	}
+
+	return e
+}
+
+// Write err as a JSON error response with the given status code.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: newError(status, err)})
+}
+
+// Recover returns a handler that turns a panic in next into a 500 error
+// response and logs it, so that one bad request cannot crash the server.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+
+			// Let net/http abort the response as intended.
+			if v == http.ErrAbortHandler { //nolint:goerr113,errorlint
+				panic(v)
+			}
+
+			logr.FromContextOrDiscard(req.Context()).Error(fmt.Errorf("%v", v), "request panicked", //nolint:goerr113
+				"method", req.Method, "path", req.URL.Path, "stack", string(debug.Stack()))
+
+			writeError(w, http.StatusInternalServerError, ErrInternal)
+		}()
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// NotFound writes an error response for requests to unknown endpoints.
+func NotFound(w http.ResponseWriter, req *http.Request) {
+	writeError(w, http.StatusNotFound, ErrRouteNotFound)
+}
+
+// MethodNotAllowed writes an error response for requests to known endpoints
+// with methods they do not support.
+func MethodNotAllowed(w http.ResponseWriter, req *http.Request) {
+	writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+}
@@ -0,0 +1,96 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// Return the error in the body of an error response.
+func responseError(t *testing.T, rec *httptest.ResponseRecorder) api.Error {
+	t.Helper()
+
+	body := struct {
+		Error api.Error `json:"error"`
+	}{Error: api.Error{Code: "", Message: "", Param: ""}}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &body))
+
+	return body.Error
+}
+
+func TestErrors(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	myAPI := newLeaseAPI(t, "errorstore1", map[string]zebra.Labels{"0100000001": {"owner": "shravya"}})
+
+	rec := serve(myAPI.GetResources, http.MethodGet, "/api/v1/resources?label=owner%3D", "")
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	assert.Equal(api.Error{Code: "invalid_request", Message: "expected value, found end of selector at position 6",
+		Param: "label"}, responseError(t, rec))
+
+	rec = serve(myAPI.GetResources, http.MethodGet, "/api/v1/resources?property=Type+in+VLANPool", "")
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	assert.Equal("property", responseError(t, rec).Param)
+
+	rec = serve(myAPI.GetResources, http.MethodGet, "/api/v1/resources?limit=0", "")
+	assert.Equal("limit", responseError(t, rec).Param)
+
+	rec = serve(myAPI.DeleteResource, http.MethodDelete, "/api/v1/resources?id=0100000009", "")
+	assert.Equal(api.Error{Code: "not_found", Message: api.ErrResourceNotFound.Error(), Param: "id"},
+		responseError(t, rec))
+
+	rec = httptest.NewRecorder()
+	myAPI.GetResources(rec, httptest.NewRequest(http.MethodGet, "/api/v1/resources", nil))
+	assert.Equal(api.Error{Code: "unauthenticated", Message: api.ErrUnauthenticated.Error(), Param: ""},
+		responseError(t, rec))
+
+	rec = httptest.NewRecorder()
+	api.NotFound(rec, httptest.NewRequest(http.MethodGet, "/api/v2", nil))
+	assert.Equal(http.StatusNotFound, rec.Code)
+	assert.Equal("not_found", responseError(t, rec).Code)
+
+	rec = httptest.NewRecorder()
+	api.MethodNotAllowed(rec, httptest.NewRequest(http.MethodPatch, "/api/v1/leases", nil))
+	assert.Equal(http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal("method_not_allowed", responseError(t, rec).Code)
+}
+
+func TestRecover(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	var logs bytes.Buffer
+
+	logger := funcr.New(func(prefix, args string) { logs.WriteString(args) }, funcr.Options{})
+
+	h := api.Recover(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		panic("bad request")
+	}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/resources", nil)
+	h.ServeHTTP(rec, req.WithContext(logr.NewContext(req.Context(), logger)))
+
+	assert.Equal(http.StatusInternalServerError, rec.Code)
+	assert.Equal(api.Error{Code: "internal_error", Message: api.ErrInternal.Error(), Param: ""},
+		responseError(t, rec))
+	assert.Contains(logs.String(), `"msg"="request panicked" "error"="bad request" "method"="GET"`)
+
+	// Aborted responses are left to net/http.
+	h = api.Recover(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	assert.PanicsWithValue(http.ErrAbortHandler, func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sort"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/store"
+)
+
+// An importFailure is the response to an import that stored nothing because
+// some of its resources could not be imported.
+type importFailure struct {
+	Error    Error             `json:"error"`
+	Failures store.ImportError `json:"failures"`
+}
+
+// ImportResources stores all resources in the request body, a resource map
+// as returned by GetResources, or none of them. Users are given their
+// password in a "password" field, as when they are created. The user's role
+// must permit creating resources of every type in the map. If any resource is
+// invalid or its ID is taken, nothing is stored and the response lists every
+// such resource.
+func (api *ResourceAPI) ImportResources(w http.ResponseWriter, req *http.Request) {
+	claims := authenticated(w, req)
+	if claims == nil {
+		return
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	resMap := zebra.NewResourceMap(api.factory)
+	if err := json.Unmarshal(body, resMap); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	// The resources as sent, in the same order, for the fields that they do
+	// not keep.
+	sent := map[string][]json.RawMessage{}
+	if err := json.Unmarshal(body, &sent); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	types := make([]string, 0, len(resMap.Resources))
+	for resType := range resMap.Resources {
+		types = append(types, resType)
+	}
+
+	if err := claims.Authorize(auth.VerbCreate, types...); err != nil {
+		writeError(w, http.StatusForbidden, err)
+
+		return
+	}
+
+	if failures := api.checkImport(resMap, sent); len(failures) > 0 {
+		writeJSON(w, http.StatusBadRequest, importFailure{
+			Error:    newError(http.StatusBadRequest, failures),
+			Failures: failures,
+		})
+
+		return
+	}
+
+	err = api.store.as(claims.Subject).Import(resMap)
+
+	var failures store.ImportError
+
+	switch {
+	case errors.As(err, &failures):
+		status := importStatus(failures)
+		writeJSON(w, status, importFailure{Error: newError(status, failures), Failures: failures})
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		api.grantRequests(req.Context())
+		writeRedacted(w, http.StatusCreated, resMap)
+	}
+}
+
+// Return the resources in the map that may not be written through the API
+// at all, sorted by ID, and set the passwords of the users in it from the
+// resources as sent.
+func (api *ResourceAPI) checkImport(resMap *zebra.ResourceMap, sent map[string][]json.RawMessage) store.ImportError {
+	failures := store.ImportError{}
+
+	for resType, list := range resMap.Resources {
+		for i, res := range list.Resources {
+			err := writable(res)
+			if err == nil {
+				err = api.setUserPassword(res, sent[resType][i])
+			}
+
+			if err != nil {
+				failures = append(failures, store.Failure{ID: res.GetID(), Type: resType, Err: err})
+			}
+		}
+	}
+
+	sort.SliceStable(failures, func(i, j int) bool {
+		return failures[i].ID < failures[j].ID
+	})
+
+	return failures
+}
+
+// Return an error if the resource may not be written through the API, as
+// leases and credentials set to the redacted value may not.
+func writable(res zebra.Resource) error {
+	if isLeaseType(res.GetType()) {
+		return ErrLeaseWrite
+	}
+
+	contents, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	return checkRedacted(contents)
+}
+
+// Return the HTTP status code for a failed import: 409 if it only failed
+// because resources or user names exist, and 400 otherwise.
+func importStatus(failures store.ImportError) int {
+	for _, f := range failures {
+		if !errors.Is(f.Err, store.ErrFileExists) && !errors.Is(f.Err, ErrUserNameTaken) {
+			return http.StatusBadRequest
+		}
+	}
+
+	return http.StatusConflict
+}
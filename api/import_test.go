@@ -0,0 +1,88 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/api"
+	"github.com/project-safari/zebra/audit"
+	"github.com/project-safari/zebra/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportResources(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	myAPI := newLeaseAPI(t, "importstore1", nil)
+
+	// Nothing is stored if any resource fails.
+	rec := serve(myAPI.ImportResources, http.MethodPost, "/api/v1/resources/import", `{"VLANPool":[
+		{"id":"0100000001","type":"VLANPool","rangeEnd":10},
+		{"id":"0100000002","type":"VLANPool","rangeStart":20,"rangeEnd":10}]}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	assert.Contains(rec.Body.String(),
+		`{"error":"range bounds are invalid, start is greater than end","id":"0100000002","type":"VLANPool"}`)
+
+	rec = serve(myAPI.GetResources, http.MethodGet, "/api/v1/resources", "")
+	assert.NotContains(rec.Body.String(), "0100000001")
+
+	body := `{"VLANPool":[{"id":"0100000001","type":"VLANPool","rangeEnd":10},
+		{"id":"0100000002","type":"VLANPool","rangeEnd":10}]}`
+
+	rec = serve(as("shravya", auth.RoleDeveloper, myAPI.ImportResources), http.MethodPost,
+		"/api/v1/resources/import", body)
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	rec = serve(myAPI.ImportResources, http.MethodPost, "/api/v1/resources/import", body)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	rec = serve(myAPI.GetResources, http.MethodGet, "/api/v1/resources?id=0100000001,0100000002", "")
+	assert.Contains(rec.Body.String(), "0100000001")
+	assert.Contains(rec.Body.String(), "0100000002")
+
+	// Importing again only collides.
+	rec = serve(myAPI.ImportResources, http.MethodPost, "/api/v1/resources/import", body)
+	assert.Equal(http.StatusConflict, rec.Code)
+
+	rec = serve(myAPI.ImportResources, http.MethodPost, "/api/v1/resources/import",
+		`{"Lease":[{"id":"0100000003","type":"Lease","owner":"shravya","resources":["0100000001"],"duration":1}]}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = serve(myAPI.ImportResources, http.MethodPost, "/api/v1/resources/import", `{"Unknown":[{"type":"Unknown"}]}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = serve(myAPI.GetAudit, http.MethodGet, "/api/v1/audit?user=admin", "")
+	records := []*audit.Record{}
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), &records))
+	assert.Len(records, 2)
+
+	// Users are imported with their passwords, never with password hashes.
+	shravya := `{"id":"0200000001","type":"User","name":"shravya","role":"developer","password":"Riddikulus!42"}`
+
+	rec = serve(myAPI.ImportResources, http.MethodPost, "/api/v1/resources/import",
+		`{"User":[{"id":"0200000001","type":"User","name":"shravya","role":"developer"}]}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	assert.Contains(rec.Body.String(), zebra.ErrPasswordHashEmpty.Error())
+
+	rec = serve(myAPI.ImportResources, http.MethodPost, "/api/v1/resources/import",
+		`{"User":[{"id":"0200000001","type":"User","name":"shravya","role":"developer","passwordHash":"x"}]}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	assert.Contains(rec.Body.String(), api.ErrPasswordHashSet.Error())
+
+	rec = serve(myAPI.ImportResources, http.MethodPost, "/api/v1/resources/import",
+		`{"User":[`+shravya+`,`+strings.Replace(shravya, "0200000001", "0200000002", 1)+`]}`)
+	assert.Equal(http.StatusConflict, rec.Code)
+	assert.Contains(rec.Body.String(), api.ErrUserNameTaken.Error())
+
+	rec = serve(myAPI.ImportResources, http.MethodPost, "/api/v1/resources/import", `{"User":[`+shravya+`]}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+	assert.NotContains(rec.Body.String(), "Riddikulus!42")
+	assert.NotContains(rec.Body.String(), "passwordHash")
+
+	rec = serve(myAPI.GetResources, http.MethodGet, "/api/v1/resources?type=User", "")
+	assert.Contains(rec.Body.String(), "shravya")
+}
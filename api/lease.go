@@ -0,0 +1,528 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/query"
+)
+
+var ErrResourceNotFound = errors.New("resource does not exist")
+
+var ErrSelectorStart = errors.New("selector leases cannot start in the future")
+
+// Longest time a client may long-poll a lease request.
+const maxWait = time.Minute
+
+// Lifetime of calendar tokens. Calendar clients poll a subscription for as
+// long as it exists, so these outlive the tokens issued at login.
+const calendarTokenTTL = 90 * 24 * time.Hour
+
+// A calendarToken is a token that may only read the lease calendar, and the
+// calendar URL carrying it, for calendar clients to subscribe to.
+type calendarToken struct {
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+	URL     string    `json:"url"`
+}
+
+// A leaseRequest names either the resources to lease or a selector that the
+// server uses to pick free resources. Leases of named resources may start in
+// the future, booking the resources from then on. The duration is a string
+// such as "2h", like the extension of a renewal.
+type leaseRequest struct {
+	Owner     string          `json:"owner"`
+	Resources []string        `json:"resources,omitempty"`
+	Selector  *lease.Selector `json:"selector,omitempty"`
+	Start     *time.Time      `json:"start,omitempty"`
+	Duration  zebra.Duration  `json:"duration"`
+}
+
+// GetLeases returns all current and future leases in start time order,
+// selected as described in filterLeases.
+func (api *ResourceAPI) GetLeases(w http.ResponseWriter, req *http.Request) {
+	if authorize(w, req, auth.VerbRead, lease.Type) == nil {
+		return
+	}
+
+	leases, err := api.filterLeases(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, leases)
+}
+
+// GetCalendar returns the current and future leases as an iCalendar feed
+// that calendar clients can subscribe to, selected as described in
+// filterLeases.
+func (api *ResourceAPI) GetCalendar(w http.ResponseWriter, req *http.Request) {
+	if authorize(w, req, auth.VerbRead, lease.Type) == nil {
+		return
+	}
+
+	leases, err := api.filterLeases(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	lease.WriteCalendar(w, "zebra reservations", leases) // nolint:errcheck
+}
+
+// CreateCalendarToken returns a calendar token for the user making the
+// request, which may be sent in the "token" query parameter of the lease
+// calendar and for nothing else. The user's role must permit reading leases.
+func (api *ResourceAPI) CreateCalendarToken(w http.ResponseWriter, req *http.Request) {
+	claims := authorize(w, req, auth.VerbRead, lease.Type)
+	if claims == nil {
+		return
+	}
+
+	if api.signer == nil {
+		writeError(w, http.StatusServiceUnavailable, ErrAuthDisabled)
+
+		return
+	}
+
+	user := api.findUser(claims.Subject)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, auth.ErrTokenRevoked)
+
+		return
+	}
+
+	token, issued, err := api.signer.IssueScoped(user, auth.ScopeCalendar, calendarTokenTTL)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, calendarToken{
+		Token:   token,
+		Expires: time.Unix(issued.Expires, 0),
+		URL:     CalendarPath + "?" + url.Values{"token": {token}}.Encode(),
+	})
+}
+
+// CreateLease leases the resources listed in the request body, or the free
+// resources matching its selector. The request is rejected if any listed
+// resource does not exist, is listed twice, is itself a lease or lease
+// request, or is leased or booked for an overlapping time.
+// If not enough resources match the selector, the request is queued and
+// returned with status 202. The lease is owned by the user making the
+// request unless another owner is given, which requires permission to update
+// leases. The user's role must permit leasing resources of the requested
+// types and limits the lease duration.
+func (api *ResourceAPI) CreateLease(w http.ResponseWriter, req *http.Request) {
+	claims := authenticated(w, req)
+	if claims == nil {
+		return
+	}
+
+	leaseReq := new(leaseRequest)
+	if err := json.NewDecoder(req.Body).Decode(leaseReq); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	if leaseReq.Owner == "" {
+		leaseReq.Owner = claims.Subject
+	}
+
+	if err := mayManage(claims, leaseReq.Owner, auth.VerbUpdate, lease.Type); err != nil {
+		writeError(w, http.StatusForbidden, err)
+
+		return
+	}
+
+	if err := api.leases.CheckDuration(claims.Role, leaseReq.Duration.Duration); err != nil {
+		writeError(w, leaseStatus(err), err)
+
+		return
+	}
+
+	if leaseReq.Selector != nil {
+		if leaseReq.Start != nil {
+			writeError(w, http.StatusBadRequest, ErrSelectorStart)
+
+			return
+		}
+
+		if err := claims.Authorize(auth.VerbLease, leaseReq.Selector.Type); err != nil {
+			writeError(w, http.StatusForbidden, err)
+
+			return
+		}
+
+		l, queued, err := api.leases.AcquireOrEnqueue(req.Context(), leaseReq.Owner, leaseReq.Selector,
+			leaseReq.Duration.Duration)
+		if err != nil {
+			writeError(w, leaseStatus(err), err)
+
+			return
+		}
+
+		if queued != nil {
+			writeJSON(w, http.StatusAccepted, queued)
+
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, l)
+
+		return
+	}
+
+	l := lease.NewLease(leaseReq.Owner, leaseReq.Resources, leaseReq.Duration.Duration)
+
+	if leaseReq.Start != nil {
+		if leaseReq.Start.Before(l.Start) {
+			writeError(w, http.StatusBadRequest, lease.ErrStartPast)
+
+			return
+		}
+
+		l.Start = *leaseReq.Start
+	}
+
+	if err := l.Validate(req.Context()); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	if !api.exist(l.Resources) {
+		writeError(w, http.StatusNotFound, ErrResourceNotFound)
+
+		return
+	}
+
+	types := api.types(l.Resources)
+
+	for _, t := range types {
+		if !lease.Leasable(t) {
+			writeError(w, http.StatusBadRequest, lease.ErrNotLeasable)
+
+			return
+		}
+	}
+
+	if err := claims.Authorize(auth.VerbLease, types...); err != nil {
+		writeError(w, http.StatusForbidden, err)
+
+		return
+	}
+
+	if err := api.leases.Acquire(req.Context(), l); err != nil {
+		writeError(w, leaseStatus(err), err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, l)
+}
+
+// DeleteLease releases the lease given in the "id" query parameter. Only
+// its owner, or a user whose role permits deleting leases, may release it.
+func (api *ResourceAPI) DeleteLease(w http.ResponseWriter, req *http.Request) {
+	claims := authenticated(w, req)
+	if claims == nil {
+		return
+	}
+
+	id := req.URL.Query().Get("id")
+
+	l := api.leases.Get(id)
+	if l == nil {
+		writeError(w, http.StatusNotFound, badParam("id", lease.ErrLeaseNotFound))
+
+		return
+	}
+
+	if err := mayManage(claims, l.Owner, auth.VerbDelete, lease.Type); err != nil {
+		writeError(w, http.StatusForbidden, err)
+
+		return
+	}
+
+	if err := api.leases.Release(req.Context(), id); err != nil {
+		writeError(w, leaseStatus(err), err)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RenewLease extends the lease given in the "id" query parameter by the
+// duration given in the "extend" query parameter, such as "2h". Only its
+// owner, or a user whose role permits updating leases, may renew it, and the
+// total duration is limited by the role of the user renewing it.
+func (api *ResourceAPI) RenewLease(w http.ResponseWriter, req *http.Request) {
+	claims := authenticated(w, req)
+	if claims == nil {
+		return
+	}
+
+	extension, err := time.ParseDuration(req.URL.Query().Get("extend"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, badParam("extend", err))
+
+		return
+	}
+
+	id := req.URL.Query().Get("id")
+
+	l := api.leases.Get(id)
+	if l == nil {
+		writeError(w, http.StatusNotFound, badParam("id", lease.ErrLeaseNotFound))
+
+		return
+	}
+
+	if err := mayManage(claims, l.Owner, auth.VerbUpdate, lease.Type); err != nil {
+		writeError(w, http.StatusForbidden, err)
+
+		return
+	}
+
+	l, err = api.leases.Renew(req.Context(), id, extension, claims.Role)
+	if err != nil {
+		writeError(w, leaseStatus(err), err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, l)
+}
+
+// GetLeaseRequests returns all queued and granted lease requests in queue
+// order. If the "id" query parameter is given, only that request is returned.
+// If "wait" is also given, as a duration such as "30s", the response is held
+// until the request is granted or the wait times out.
+func (api *ResourceAPI) GetLeaseRequests(w http.ResponseWriter, req *http.Request) {
+	if authorize(w, req, auth.VerbRead, lease.RequestType) == nil {
+		return
+	}
+
+	id := req.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusOK, api.leases.Requests())
+
+		return
+	}
+
+	wait := time.Duration(0)
+
+	if param := req.URL.Query().Get("wait"); param != "" {
+		d, err := time.ParseDuration(param)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, badParam("wait", err))
+
+			return
+		}
+
+		wait = d
+	}
+
+	if wait > maxWait {
+		wait = maxWait
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), wait)
+	defer cancel()
+
+	r, err := api.leases.Wait(ctx, id)
+	if err != nil {
+		writeError(w, leaseStatus(err), err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, r)
+}
+
+// DeleteLeaseRequest removes the lease request given in the "id" query
+// parameter from the queue. Only its owner, or a user whose role permits
+// deleting lease requests, may cancel it.
+func (api *ResourceAPI) DeleteLeaseRequest(w http.ResponseWriter, req *http.Request) {
+	claims := authenticated(w, req)
+	if claims == nil {
+		return
+	}
+
+	id := req.URL.Query().Get("id")
+
+	r := api.leases.GetRequest(id)
+	if r == nil {
+		writeError(w, http.StatusNotFound, badParam("id", lease.ErrRequestNotFound))
+
+		return
+	}
+
+	if err := mayManage(claims, r.Owner, auth.VerbDelete, lease.RequestType); err != nil {
+		writeError(w, http.StatusForbidden, err)
+
+		return
+	}
+
+	if err := api.leases.Cancel(req.Context(), id); err != nil {
+		writeError(w, leaseStatus(err), err)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Return the leases selected by the query parameters of req, in start time
+// order. The "owner" and "resource" parameters select the leases of the given
+// owner or on the given resource, and the "group" parameter the leases owned
+// by members of the given group. The "label" parameter, a label selector such
+// as "owner=shravya", selects the leases holding at least one resource
+// whose labels match it.
+func (api *ResourceAPI) filterLeases(req *http.Request) ([]*lease.Lease, error) {
+	owner := req.URL.Query().Get("owner")
+	resID := req.URL.Query().Get("resource")
+
+	var members map[string]bool
+
+	if group := req.URL.Query().Get("group"); group != "" {
+		members = api.groupMembers(group)
+	}
+
+	var labelled map[string]bool
+
+	if label := req.URL.Query().Get("label"); label != "" {
+		sel, err := query.ParseSelector(label, query.KindLabel)
+		if err != nil {
+			return nil, badParam("label", err)
+		}
+
+		results := api.queryStore.QuerySelector(sel)
+
+		labelled = map[string]bool{}
+
+		for _, list := range results.Resources {
+			for _, res := range list.Resources {
+				labelled[res.GetID()] = true
+			}
+		}
+	}
+
+	leases := []*lease.Lease{}
+
+	for _, l := range api.leases.Leases() {
+		if (owner == "" || l.Owner == owner) && (resID == "" || isIn(resID, l.Resources)) &&
+			(members == nil || members[l.Owner]) && (labelled == nil || holdsAny(l, labelled)) {
+			leases = append(leases, l)
+		}
+	}
+
+	return leases, nil
+}
+
+// Return the names of the users in the given group.
+func (api *ResourceAPI) groupMembers(group string) map[string]bool {
+	members := map[string]bool{}
+
+	for _, list := range api.queryStore.QueryType([]string{userType}).Resources {
+		for _, res := range list.Resources {
+			if user, ok := res.(*zebra.User); ok && isIn(group, user.Groups) {
+				members[user.Name] = true
+			}
+		}
+	}
+
+	return members
+}
+
+// Return true if the lease holds any of the given resources.
+func holdsAny(l *lease.Lease, resIDs map[string]bool) bool {
+	for _, id := range l.Resources {
+		if resIDs[id] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return true if all of the given resource IDs, which must be distinct, are
+// known to the query store.
+func (api *ResourceAPI) exist(ids []string) bool {
+	found := 0
+
+	for _, list := range api.queryStore.QueryUUID(ids).Resources {
+		found += len(list.Resources)
+	}
+
+	return found == len(ids)
+}
+
+// Return the types of the resources with the given IDs.
+func (api *ResourceAPI) types(ids []string) []string {
+	types := []string{}
+
+	for resType, list := range api.queryStore.QueryUUID(ids).Resources {
+		if len(list.Resources) > 0 {
+			types = append(types, resType)
+		}
+	}
+
+	return types
+}
+
+// Grant the queued lease requests that written resources may now satisfy. The
+// write has been made by then, so a failure is only logged.
+func (api *ResourceAPI) grantRequests(ctx context.Context) {
+	if err := api.leases.Grant(); err != nil {
+		logr.FromContextOrDiscard(ctx).Error(err, "failed to grant lease requests")
+	}
+}
+
+// Return the HTTP status code for an error returned by the lease manager.
+func leaseStatus(err error) int {
+	switch {
+	case errors.Is(err, lease.ErrLeaseNotFound), errors.Is(err, lease.ErrRequestNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, lease.ErrLeased), errors.Is(err, lease.ErrBooked), errors.Is(err, lease.ErrUnavailable),
+		errors.Is(err, lease.ErrClaimed):
+		return http.StatusConflict
+	case errors.Is(err, lease.ErrMaxDuration):
+		return http.StatusForbidden
+	case errors.Is(err, lease.ErrOwnerEmpty), errors.Is(err, lease.ErrDurationInvalid),
+		errors.Is(err, lease.ErrSelectorType), errors.Is(err, lease.ErrSelectorCount),
+		errors.Is(err, lease.ErrNotLeasable):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Return if val is in string list.
+func isIn(val string, list []string) bool {
+	for _, v := range list {
+		if val == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,352 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/api"
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func leaseFactory() zebra.ResourceFactory {
+	return zebra.Factory().
+		Add("VLANPool", func() zebra.Resource { return new(network.VLANPool) }).
+		Add("User", func() zebra.Resource { return new(zebra.User) }).
+		Add(lease.Type, func() zebra.Resource { return new(lease.Lease) }).
+		Add(lease.RequestType, func() zebra.Resource { return new(lease.Request) })
+}
+
+// Create a store at root holding VLANPool resources with the given IDs and
+// labels, and return an API initialized on it.
+func newLeaseAPI(t *testing.T, root string, labels map[string]zebra.Labels) *api.ResourceAPI {
+	t.Helper()
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	fs := store.NewFileStore(root, leaseFactory())
+	assert.Nil(t, fs.Initialize())
+
+	for id, l := range labels {
+		res := new(network.VLANPool)
+		res.ID = id
+		res.Type = "VLANPool"
+		res.Labels = l
+		res.RangeEnd = 10
+		assert.Nil(t, fs.Create(res))
+	}
+
+	myAPI := api.NewResourceAPI(leaseFactory())
+	assert.Nil(t, myAPI.Initialize(root))
+
+	return myAPI
+}
+
+// Serve a request to h made by an admin, unless h sets another user with as.
+func serve(h http.HandlerFunc, method string, target string, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	asAdmin(h)(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+
+	return rec
+}
+
+func TestLeases(t *testing.T) { // nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	myAPI := newLeaseAPI(t, "leasestore1", map[string]zebra.Labels{"0100000001": nil, "0100000002": nil})
+
+	rec := serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"shravya","resources":["0100000001"],"duration":"1h"}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	// Durations are returned the way they are sent.
+	assert.Contains(rec.Body.String(), `"duration":"1h0m0s"`)
+
+	l := new(lease.Lease)
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), l))
+	assert.Equal("shravya", l.Owner)
+
+	// Already leased.
+	rec = serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"nandyala","resources":["0100000002","0100000001"],"duration":"1h"}`)
+	assert.Equal(http.StatusConflict, rec.Code)
+
+	// Unknown resource.
+	rec = serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"nandyala","resources":["0300000001"],"duration":"1h"}`)
+	assert.Equal(http.StatusNotFound, rec.Code)
+
+	// Invalid lease.
+	rec = serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"nandyala","resources":["0100000002"]}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"nandyala","resources":["0100000002","0100000002"],"duration":"1h"}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	assert.Contains(rec.Body.String(), lease.ErrResourcesDuplicate.Error())
+
+	// Leases cannot be leased.
+	rec = serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"nandyala","resources":["`+l.ID+`"],"duration":"1h"}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	assert.Contains(rec.Body.String(), lease.ErrNotLeasable.Error())
+
+	rec = serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"nandyala","selector":{"type":"Lease","count":1},"duration":"1h"}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases", `{`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	// Durations are strings, as when renewing.
+	rec = serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"nandyala","resources":["0100000002"],"duration":3600000000000}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"nandyala","resources":["0100000002"],"duration":"1h"}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	leases := []*lease.Lease{}
+	rec = serve(myAPI.GetLeases, http.MethodGet, "/api/v1/leases?owner=shravya", "")
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), &leases))
+	assert.Len(leases, 1)
+	assert.Equal(l.ID, leases[0].ID)
+
+	rec = serve(myAPI.GetLeases, http.MethodGet, "/api/v1/leases", "")
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), &leases))
+	assert.Len(leases, 2)
+
+	rec = serve(myAPI.DeleteLease, http.MethodDelete, "/api/v1/leases?id="+l.ID, "")
+	assert.Equal(http.StatusNoContent, rec.Code)
+
+	rec = serve(myAPI.DeleteLease, http.MethodDelete, "/api/v1/leases?id="+l.ID, "")
+	assert.Equal(http.StatusNotFound, rec.Code)
+
+	// Leases are resources and can be queried like any other.
+	rec = serve(myAPI.GetResources, http.MethodGet, "/api/v1/resources?type=Lease", "")
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), "nandyala")
+	assert.NotContains(rec.Body.String(), "shravya")
+}
+
+func TestLeaseSelector(t *testing.T) { // nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	myAPI := newLeaseAPI(t, "leasestore2", map[string]zebra.Labels{
+		"0100000001": {"pool": "perf"},
+		"0100000002": {"pool": "perf"},
+		"0100000003": {"pool": "func"},
+	})
+
+	rec := serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"shravya","selector":{"type":"VLANPool","labels":{"pool":"perf"},"count":2},"duration":"1m"}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	l := new(lease.Lease)
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), l))
+	assert.Equal([]string{"0100000001", "0100000002"}, l.Resources)
+
+	// Not enough free resources, the request is queued.
+	rec = serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"nandyala","selector":{"type":"VLANPool","labels":{"pool":"perf"},"count":1},"duration":"1m"}`)
+	assert.Equal(http.StatusAccepted, rec.Code)
+
+	r := new(lease.Request)
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), r))
+	assert.Equal(lease.StateWaiting, r.State)
+
+	rec = serve(myAPI.GetLeaseRequests, http.MethodGet, "/api/v1/leases/requests?id="+r.ID+"&wait=10ms", "")
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), lease.StateWaiting)
+
+	rec = serve(myAPI.GetLeaseRequests, http.MethodGet, "/api/v1/leases/requests?id="+r.ID+"&wait=soon", "")
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	// Long-poll while the first lease is released.
+	done := make(chan *httptest.ResponseRecorder)
+
+	go func() {
+		done <- serve(myAPI.GetLeaseRequests, http.MethodGet, "/api/v1/leases/requests?id="+r.ID+"&wait=10s", "")
+	}()
+
+	rec = serve(myAPI.DeleteLease, http.MethodDelete, "/api/v1/leases?id="+l.ID, "")
+	assert.Equal(http.StatusNoContent, rec.Code)
+
+	rec = <-done
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), r))
+	assert.Equal(lease.StateGranted, r.State)
+	assert.NotEmpty(r.Lease)
+
+	requests := []*lease.Request{}
+	rec = serve(myAPI.GetLeaseRequests, http.MethodGet, "/api/v1/leases/requests", "")
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), &requests))
+	assert.Len(requests, 1)
+
+	rec = serve(myAPI.DeleteLeaseRequest, http.MethodDelete, "/api/v1/leases/requests?id="+r.ID, "")
+	assert.Equal(http.StatusNoContent, rec.Code)
+
+	rec = serve(myAPI.GetLeaseRequests, http.MethodGet, "/api/v1/leases/requests?id="+r.ID, "")
+	assert.Equal(http.StatusNotFound, rec.Code)
+
+	rec = serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"nandyala","selector":{"type":"VLANPool","count":0},"duration":"1m"}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	// Requests are granted once matching resources are created.
+	rec = serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"nandyala","selector":{"type":"VLANPool","labels":{"pool":"func"},"count":2},"duration":"1m"}`)
+	assert.Equal(http.StatusAccepted, rec.Code)
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), r))
+
+	rec = serve(myAPI.CreateResource, http.MethodPost, "/api/v1/resources",
+		`{"id":"0100000004","type":"VLANPool","labels":{"pool":"func"},"rangeEnd":10}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	rec = serve(myAPI.GetLeaseRequests, http.MethodGet, "/api/v1/leases/requests?id="+r.ID, "")
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), r))
+	assert.Equal(lease.StateGranted, r.State)
+	assert.Equal([]string{"0100000003", "0100000004"}, myAPI.Leases().Get(r.Lease).Resources)
+}
+
+func TestRenewLease(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	myAPI := newLeaseAPI(t, "leasestore3", map[string]zebra.Labels{"0100000001": nil})
+	assert.Nil(myAPI.Leases().Configure(lease.Config{
+		Grace:       zebra.Duration{Duration: time.Minute},
+		Interval:    zebra.Duration{Duration: time.Minute},
+		MaxDuration: map[string]zebra.Duration{lease.DefaultRole: {Duration: 2 * time.Hour}},
+	}))
+
+	rec := serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"shravya","resources":["0100000001"],"duration":"3h"}`)
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	rec = serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"shravya","resources":["0100000001"],"duration":"1h"}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	l := new(lease.Lease)
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), l))
+
+	rec = serve(myAPI.RenewLease, http.MethodPost, "/api/v1/leases/renew?id="+l.ID+"&extend=30m", "")
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), l))
+	assert.Equal(90*time.Minute, l.Duration.Duration)
+
+	rec = serve(myAPI.RenewLease, http.MethodPost, "/api/v1/leases/renew?id="+l.ID+"&extend=1h", "")
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	rec = serve(myAPI.RenewLease, http.MethodPost, "/api/v1/leases/renew?id="+l.ID+"&extend=later", "")
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = serve(myAPI.RenewLease, http.MethodPost, "/api/v1/leases/renew?id=0000000000&extend=1m", "")
+	assert.Equal(http.StatusNotFound, rec.Code)
+}
+
+func TestBookLease(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	myAPI := newLeaseAPI(t, "leasestore4", map[string]zebra.Labels{"0100000001": nil, "0100000002": nil})
+
+	start := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+
+	rec := serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"shravya","resources":["0100000001"],"start":"`+start+`","duration":"1h"}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	rec = serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"nandyala","resources":["0100000001"],"duration":"24h"}`)
+	assert.Equal(http.StatusConflict, rec.Code)
+
+	rec = serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"nandyala","resources":["0100000001"],"start":"2020-01-01T00:00:00Z","duration":"1m"}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"nandyala","selector":{"type":"VLANPool","count":1},"start":"`+start+`","duration":"1m"}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"nandyala","resources":["0100000001","0100000002"],"duration":"1h"}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	leases := []*lease.Lease{}
+	rec = serve(myAPI.GetLeases, http.MethodGet, "/api/v1/leases?resource=0100000001", "")
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), &leases))
+	assert.Len(leases, 2)
+	assert.Equal("nandyala", leases[0].Owner)
+	assert.Equal("shravya", leases[1].Owner)
+
+	rec = serve(myAPI.GetLeases, http.MethodGet, "/api/v1/leases?resource=0100000002", "")
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), &leases))
+	assert.Len(leases, 1)
+}
+
+func TestGetCalendar(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	myAPI := newLeaseAPI(t, "leasestore5", map[string]zebra.Labels{
+		"0100000001": {"pool": "perf"},
+		"0100000002": {"pool": "func"},
+	})
+
+	rec := serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"shravya","resources":["0100000001"],"duration":"1h"}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	rec = serve(myAPI.CreateLease, http.MethodPost, "/api/v1/leases",
+		`{"owner":"nandyala","resources":["0100000002"],"duration":"1h"}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	rec = serve(myAPI.GetCalendar, http.MethodGet, "/api/v1/leases.ics", "")
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("text/calendar; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(2, strings.Count(rec.Body.String(), "BEGIN:VEVENT"))
+
+	rec = serve(myAPI.GetCalendar, http.MethodGet, "/api/v1/leases.ics?owner=shravya", "")
+	assert.Equal(1, strings.Count(rec.Body.String(), "BEGIN:VEVENT"))
+	assert.Contains(rec.Body.String(), "SUMMARY:shravya")
+
+	rec = serve(myAPI.GetCalendar, http.MethodGet, "/api/v1/leases.ics?resource=0100000002", "")
+	assert.Equal(1, strings.Count(rec.Body.String(), "BEGIN:VEVENT"))
+	assert.Contains(rec.Body.String(), "SUMMARY:nandyala")
+
+	rec = serve(myAPI.CreateResource, http.MethodPost, "/api/v1/resources",
+		`{"id":"0200000001","type":"User","name":"nandyala","role":"developer","groups":["infra"],`+
+			`"password":"Riddikulus!42"}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	rec = serve(myAPI.GetCalendar, http.MethodGet, "/api/v1/leases.ics?group=infra", "")
+	assert.Equal(1, strings.Count(rec.Body.String(), "BEGIN:VEVENT"))
+	assert.Contains(rec.Body.String(), "SUMMARY:nandyala")
+
+	rec = serve(myAPI.GetCalendar, http.MethodGet, "/api/v1/leases.ics?group=sales", "")
+	assert.Equal(0, strings.Count(rec.Body.String(), "BEGIN:VEVENT"))
+
+	rec = serve(myAPI.GetCalendar, http.MethodGet, "/api/v1/leases.ics?label=pool+in+(perf,gpu)", "")
+	assert.Equal(1, strings.Count(rec.Body.String(), "BEGIN:VEVENT"))
+	assert.Contains(rec.Body.String(), "SUMMARY:shravya")
+
+	rec = serve(myAPI.GetCalendar, http.MethodGet, "/api/v1/leases.ics?label=pool+in+(gpu)", "")
+	assert.Equal(0, strings.Count(rec.Body.String(), "BEGIN:VEVENT"))
+
+	rec = serve(myAPI.GetCalendar, http.MethodGet, "/api/v1/leases.ics?label=pool+in", "")
+	assert.Equal(http.StatusBadRequest, rec.Code)
+}
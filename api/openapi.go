@@ -0,0 +1,224 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/schema"
+)
+
+// Version of the OpenAPI specification that the document follows. Its schema
+// objects are JSON Schemas, as generated by the schema package.
+const openAPIVersion = "3.1.0"
+
+// Prefix of references to the schemas in the components of the document.
+const schemaRef = "#/components/schemas/"
+
+// Names of the component schemas that are not resource types. They are
+// namespaced so that they cannot clash with the names of resource types.
+const (
+	errorSchema       = "zebra.Error"
+	resourceSchema    = "zebra.Resource"
+	resourceMapSchema = "zebra.ResourceMap"
+)
+
+type openAPI struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       openAPIInfo                      `json:"info"`
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components components                       `json:"components"`
+	Security   []map[string][]string            `json:"security"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// An operation describes a route. Security is set only for routes that need
+// no token or accept another kind of token.
+type operation struct {
+	OperationID string                 `json:"operationId"`
+	Summary     string                 `json:"summary"`
+	Parameters  []parameter            `json:"parameters,omitempty"`
+	RequestBody *requestBody           `json:"requestBody,omitempty"`
+	Responses   map[string]response    `json:"responses"`
+	Security    *[]map[string][]string `json:"security,omitempty"`
+}
+
+type parameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description"`
+	Schema      *schema.Schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema *schema.Schema `json:"schema"`
+}
+
+type components struct {
+	Schemas         map[string]*schema.Schema `json:"schemas"`
+	SecuritySchemes map[string]securityScheme `json:"securitySchemes"`
+}
+
+type securityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// GetOpenAPI returns an OpenAPI document describing every route of the API,
+// with a schema for each resource type it knows.
+func (api *ResourceAPI) GetOpenAPI(w http.ResponseWriter, req *http.Request) {
+	if authenticated(w, req) == nil {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, api.openAPI())
+}
+
+// Return the OpenAPI document of the API, built from its routes.
+func (api *ResourceAPI) openAPI() *openAPI {
+	doc := &openAPI{
+		OpenAPI: openAPIVersion,
+		Info:    openAPIInfo{Title: "zebra", Version: "v1"},
+		Paths:   map[string]map[string]*operation{},
+		Components: components{
+			Schemas: api.schemas(),
+			SecuritySchemes: map[string]securityScheme{
+				"bearer":        {Type: "http", Scheme: "bearer", In: "", Name: ""},
+				"calendarToken": {Type: "apiKey", Scheme: "", In: "query", Name: "token"},
+			},
+		},
+		Security: []map[string][]string{{"bearer": {}}},
+	}
+
+	for _, r := range api.Routes() {
+		if doc.Paths[r.Path] == nil {
+			doc.Paths[r.Path] = map[string]*operation{}
+		}
+
+		doc.Paths[r.Path][strings.ToLower(r.Method)] = describe(r)
+	}
+
+	return doc
+}
+
+// Return the operation describing the route.
+func describe(r Route) *operation {
+	op := &operation{
+		OperationID: r.Name,
+		Summary:     r.Summary,
+		Parameters:  make([]parameter, 0, len(r.Params)),
+		RequestBody: nil,
+		Responses: map[string]response{
+			"default": {Description: "Error", Content: map[string]mediaType{"application/json": {Schema: ref(errorSchema)}}},
+		},
+		Security: nil,
+	}
+
+	for _, p := range r.Params {
+		op.Parameters = append(op.Parameters, parameter{
+			Name: p.Name, In: p.In, Description: p.Description, Schema: schema.Type(p.Type),
+		})
+	}
+
+	if r.Body != nil {
+		op.RequestBody = &requestBody{Required: true, Content: map[string]mediaType{}}
+
+		types := r.BodyTypes
+		if len(types) == 0 {
+			types = []string{"application/json"}
+		}
+
+		for _, t := range types {
+			op.RequestBody.Content[t] = mediaType{Schema: r.Body}
+		}
+	}
+
+	success := response{Description: http.StatusText(r.Status), Content: nil}
+
+	switch {
+	case r.ContentType != "":
+		success.Content = map[string]mediaType{r.ContentType: {Schema: schema.Type("string")}}
+	case r.Response != nil:
+		success.Content = map[string]mediaType{"application/json": {Schema: r.Response}}
+	}
+
+	op.Responses[strconv.Itoa(r.Status)] = success
+
+	if r.Accepted != nil {
+		op.Responses[strconv.Itoa(http.StatusAccepted)] = response{
+			Description: http.StatusText(http.StatusAccepted),
+			Content:     map[string]mediaType{"application/json": {Schema: r.Accepted}},
+		}
+	}
+
+	// Only the login route may be used without a token, and only the calendar
+	// accepts calendar tokens in its URL, as in RequireAuth.
+	switch r.Path {
+	case LoginPath:
+		op.Security = &[]map[string][]string{}
+	case CalendarPath:
+		op.Security = &[]map[string][]string{{"bearer": {}}, {"calendarToken": {}}}
+	}
+
+	return op
+}
+
+// Return the component schemas of the document: one for each resource type,
+// "zebra.Resource" for a resource of any type, "zebra.ResourceMap" for
+// resources listed by type, and "zebra.Error" for error responses.
+func (api *ResourceAPI) schemas() map[string]*schema.Schema {
+	schemas := map[string]*schema.Schema{
+		errorSchema: schemaOf(errorResponse{}),
+	}
+
+	// Lease routes return leases and lease requests whatever the factory.
+	schemas[lease.Type] = schema.Resource(lease.Type, new(lease.Lease))
+	schemas[lease.RequestType] = schema.Resource(lease.RequestType, new(lease.Request))
+
+	for _, t := range api.factory.Types() {
+		schemas[t] = schema.Resource(t, api.factory.New(t))
+	}
+
+	names := make([]string, 0, len(schemas))
+
+	for t := range schemas {
+		if t != errorSchema {
+			names = append(names, t)
+		}
+	}
+
+	sort.Strings(names)
+
+	types := make([]*schema.Schema, 0, len(names))
+	for _, t := range names {
+		types = append(types, ref(t))
+	}
+
+	schemas[resourceSchema] = schema.OneOf(types...)
+	schemas[resourceMapSchema] = schema.Map(schema.Array(ref(resourceSchema)))
+
+	return schemas
+}
+
+// Return a reference to the component schema with the given name.
+func ref(name string) *schema.Schema {
+	return schema.Ref(schemaRef + name)
+}
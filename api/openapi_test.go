@@ -0,0 +1,102 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/project-safari/zebra/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// Return the values of every "$ref" within the decoded JSON value.
+func refs(value interface{}) []string {
+	found := []string{}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if s, ok := child.(string); ok && key == "$ref" {
+				found = append(found, s)
+			}
+
+			found = append(found, refs(child)...)
+		}
+	case []interface{}:
+		for _, child := range v {
+			found = append(found, refs(child)...)
+		}
+	}
+
+	return found
+}
+
+func TestGetOpenAPI(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	myAPI := newLeaseAPI(t, "openapistore1", nil)
+
+	rec := serve(myAPI.GetOpenAPI, http.MethodGet, "/api/v1/openapi.json", "")
+	assert.Equal(http.StatusOK, rec.Code)
+
+	doc := map[string]interface{}{}
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal("3.1.0", doc["openapi"])
+
+	// Every route is described, once.
+	paths, _ := doc["paths"].(map[string]interface{})
+	names := map[string]bool{}
+
+	for _, route := range myAPI.Routes() {
+		op, _ := paths[route.Path].(map[string]interface{})[strings.ToLower(route.Method)].(map[string]interface{})
+		if !assert.NotNil(op, route.Method+" "+route.Path) {
+			continue
+		}
+
+		assert.Equal(route.Name, op["operationId"])
+		assert.False(names[route.Name], route.Name)
+		names[route.Name] = true
+	}
+
+	resources, _ := paths["/api/v1/resources"].(map[string]interface{})
+	params, _ := resources["get"].(map[string]interface{})["parameters"].([]interface{})
+	assert.Contains(params, map[string]interface{}{
+		"name": "label", "in": "query", "description": "Selector on resource labels.",
+		"schema": map[string]interface{}{"type": "string"},
+	})
+
+	login, _ := paths["/api/v1/login"].(map[string]interface{})["post"].(map[string]interface{})
+	assert.Equal([]interface{}{}, login["security"])
+
+	// The calendar also accepts calendar tokens in its URL.
+	calendar, _ := paths[api.CalendarPath].(map[string]interface{})["get"].(map[string]interface{})
+	assert.Equal([]interface{}{
+		map[string]interface{}{"bearer": []interface{}{}},
+		map[string]interface{}{"calendarToken": []interface{}{}},
+	}, calendar["security"])
+
+	components, _ := doc["components"].(map[string]interface{})
+	schemes, _ := components["securitySchemes"].(map[string]interface{})
+	assert.Equal(map[string]interface{}{"type": "apiKey", "in": "query", "name": "token"}, schemes["calendarToken"])
+
+	// Lease requests that cannot be granted yet are queued.
+	createLease, _ := paths["/api/v1/leases"].(map[string]interface{})["post"].(map[string]interface{})
+	responses, _ := createLease["responses"].(map[string]interface{})
+	assert.Contains(responses, "201")
+	assert.Contains(refs(responses["202"]), "#/components/schemas/LeaseRequest")
+
+	// Each resource type has a schema, and every reference resolves. The
+	// other schemas are namespaced, so that no resource type clashes with them.
+	schemas, _ := components["schemas"].(map[string]interface{})
+	for _, name := range []string{
+		"VLANPool", "Lease", "LeaseRequest", "zebra.Resource", "zebra.ResourceMap", "zebra.Error",
+	} {
+		assert.Contains(schemas, name)
+	}
+
+	for _, ref := range refs(doc) {
+		assert.Contains(schemas, strings.TrimPrefix(ref, "#/components/schemas/"), ref)
+	}
+}
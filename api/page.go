@@ -0,0 +1,72 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/query"
+)
+
+// Most resources returned in one page.
+const maxLimit = 1000
+
+// Resources returned in one page if the request sets no limit.
+const defaultLimit = 100
+
+var ErrLimitInvalid = fmt.Errorf("limit must be a number from 1 to %d", maxLimit)
+
+// Write the results as a JSON response with their secrets hidden,
+// paginated as given by the query parameters of the request. The "sort"
+// parameter names the property to sort by, prefixed with "-" for descending
+// order, and sorts by ID if empty. The "limit" parameter limits the number of
+// results, to defaultLimit if not given. If more results follow, the response carries a Link header to the
+// next page, whose "cursor" parameter marks where the page ended. Sorting
+// decides which results are in a page; the results of each type are listed in
+// sort order.
+func writeResources(w http.ResponseWriter, req *http.Request, results *zebra.ResourceMap) {
+	params := req.URL.Query()
+	order := query.ParseOrder(params.Get("sort"))
+	limit := defaultLimit
+
+	if value := params.Get("limit"); value != "" {
+		l, err := strconv.Atoi(value)
+		if err != nil || l < 1 || l > maxLimit {
+			writeError(w, http.StatusBadRequest, badParam("limit", ErrLimitInvalid))
+
+			return
+		}
+
+		limit = l
+	}
+
+	var after *query.Cursor
+
+	if token := params.Get("cursor"); token != "" {
+		c, err := query.ParseCursor(token)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, badParam("cursor", err))
+
+			return
+		}
+
+		after = c
+	}
+
+	page, next, err := query.Page(results, order, after, limit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, badParam("cursor", err))
+
+		return
+	}
+
+	if next != nil {
+		nextURL := *req.URL
+		params.Set("cursor", next.String())
+		nextURL.RawQuery = params.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, nextURL.RequestURI()))
+	}
+
+	writeRedacted(w, http.StatusOK, page)
+}
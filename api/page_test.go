@@ -0,0 +1,75 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPagination(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	myAPI := newLeaseAPI(t, "pagestore1", map[string]zebra.Labels{
+		"0100000001": {"pool": "perf"},
+		"0100000002": {"pool": "perf"},
+		"0100000003": {"pool": "perf"},
+	})
+
+	rec := serve(myAPI.GetResources, http.MethodGet, "/api/v1/resources?label=pool%3Dperf&limit=2", "")
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), "0100000001")
+	assert.Contains(rec.Body.String(), "0100000002")
+	assert.NotContains(rec.Body.String(), "0100000003")
+
+	// Follow the link to the next page.
+	link := rec.Header().Get("Link")
+	assert.True(strings.HasSuffix(link, `>; rel="next"`))
+
+	next, err := url.Parse(strings.TrimPrefix(strings.TrimSuffix(link, `>; rel="next"`), "<"))
+	assert.Nil(err)
+	assert.Equal("pool=perf", next.Query().Get("label"))
+
+	rec = serve(myAPI.GetResources, http.MethodGet, next.String(), "")
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), "0100000003")
+	assert.NotContains(rec.Body.String(), "0100000002")
+	assert.Empty(rec.Header().Get("Link"))
+
+	rec = serve(myAPI.GetResources, http.MethodGet, "/api/v1/resources?sort=-ID&limit=1", "")
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), "0100000003")
+	assert.NotContains(rec.Body.String(), "0100000001")
+
+	for _, target := range []string{
+		"/api/v1/resources?limit=0",
+		"/api/v1/resources?limit=1001",
+		"/api/v1/resources?limit=ten",
+		"/api/v1/resources?cursor=abc",
+		"/api/v1/resources?limit=1&cursor=abc",
+		// The cursor was returned for sorting by ID.
+		"/api/v1/resources?sort=-ID&limit=1&cursor=" + next.Query().Get("cursor"),
+	} {
+		rec = serve(myAPI.GetResources, http.MethodGet, target, "")
+		assert.Equal(http.StatusBadRequest, rec.Code, target)
+	}
+
+	// Without a limit, pages hold 100 resources.
+	labels := map[string]zebra.Labels{}
+	for i := 1; i <= 101; i++ {
+		labels[fmt.Sprintf("01%08d", i)] = nil
+	}
+
+	myAPI = newLeaseAPI(t, "pagestore2", labels)
+
+	rec = serve(myAPI.GetResources, http.MethodGet, "/api/v1/resources", "")
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), "0100000100")
+	assert.NotContains(rec.Body.String(), "0100000101")
+	assert.NotEmpty(rec.Header().Get("Link"))
+}
@@ -0,0 +1,462 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/patch"
+	"github.com/project-safari/zebra/query"
+	"github.com/project-safari/zebra/store"
+)
+
+var ErrTypeUnknown = errors.New("resource type is not known")
+
+var ErrTypeChanged = errors.New("resource type cannot be changed")
+
+var ErrLeaseWrite = errors.New("leases must be managed through /api/v1/leases")
+
+var ErrKeyRedacted = errors.New("credential keys must not be set to the redacted value")
+
+var ErrIfMatchInvalid = errors.New(`If-Match must be "*" or the ETag of a resource`)
+
+var ErrIDChanged = errors.New("resource id cannot be changed")
+
+var ErrResourceLeased = errors.New("resource is leased or booked and cannot be deleted")
+
+var ErrPatchType = fmt.Errorf("patches must be sent as %s or %s", patch.MergePatchType, patch.JSONPatchType)
+
+// CreateResource stores the resource in the request body, a JSON object whose
+// "type" field names one of the known resource types. The user's role must
+// permit creating resources of that type. Queued lease requests that the new
+// resource satisfies are then granted.
+func (api *ResourceAPI) CreateResource(w http.ResponseWriter, req *http.Request) {
+	claims := authenticated(w, req)
+	if claims == nil {
+		return
+	}
+
+	res, err := api.decodeResource(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	if err := claims.Authorize(auth.VerbCreate, res.GetType()); err != nil {
+		writeError(w, http.StatusForbidden, err)
+
+		return
+	}
+
+	if err := api.store.as(claims.Subject).Create(res); err != nil {
+		writeError(w, storeStatus(err), err)
+
+		return
+	}
+
+	api.grantRequests(req.Context())
+
+	w.Header().Set("ETag", etag(res))
+	writeRedacted(w, http.StatusCreated, res)
+}
+
+// UpdateResource replaces the stored resource with the resource in the
+// request body, which must have the same ID and type. The user's role must
+// permit updating resources of that type. If the request has an If-Match
+// header, the stored resource must still be at the version it names.
+func (api *ResourceAPI) UpdateResource(w http.ResponseWriter, req *http.Request) {
+	claims := authenticated(w, req)
+	if claims == nil {
+		return
+	}
+
+	version, err := ifMatch(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	res, err := api.decodeResource(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	if err := claims.Authorize(auth.VerbUpdate, res.GetType()); err != nil {
+		writeError(w, http.StatusForbidden, err)
+
+		return
+	}
+
+	if old := api.find(res.GetID()); old != nil && old.GetType() != res.GetType() {
+		writeError(w, http.StatusBadRequest, ErrTypeChanged)
+
+		return
+	}
+
+	if err := api.store.as(claims.Subject).UpdateIf(res, version); err != nil {
+		writeError(w, storeStatus(err), err)
+
+		return
+	}
+
+	api.grantRequests(req.Context())
+
+	w.Header().Set("ETag", etag(res))
+	writeRedacted(w, http.StatusOK, res)
+}
+
+// PatchResource patches the resource given in the "id" query parameter with
+// the patch in the request body, a JSON Merge Patch if it is sent as
+// application/merge-patch+json or a JSON Patch if it is sent as
+// application/json-patch+json. The patched resource must keep its ID and type
+// and is validated like any other. It is stored only if the resource has not
+// changed since it was patched and, if the request has an If-Match header, is
+// at the version it names. The user's role must permit updating resources of
+// its type, and JSON Patches that test, copy or move values of a resource with
+// credential keys also require permission to reveal them, since they could
+// otherwise be used to find the keys out.
+func (api *ResourceAPI) PatchResource(w http.ResponseWriter, req *http.Request) {
+	claims := authenticated(w, req)
+	if claims == nil {
+		return
+	}
+
+	version, err := ifMatch(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	res := api.find(req.URL.Query().Get("id"))
+	if res == nil {
+		writeError(w, http.StatusNotFound, badParam("id", ErrResourceNotFound))
+
+		return
+	}
+
+	if err := claims.Authorize(auth.VerbUpdate, res.GetType()); err != nil {
+		writeError(w, http.StatusForbidden, err)
+
+		return
+	}
+
+	if isLeaseType(res.GetType()) {
+		writeError(w, http.StatusBadRequest, ErrLeaseWrite)
+
+		return
+	}
+
+	patched, status, err := api.applyPatch(req, claims, res)
+	if err != nil {
+		if status == http.StatusUnsupportedMediaType {
+			w.Header().Set("Accept-Patch", patch.MergePatchType+", "+patch.JSONPatchType)
+		}
+
+		writeError(w, status, err)
+
+		return
+	}
+
+	newRes, err := api.unmarshalResource(req.Context(), patched)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	switch {
+	case newRes.GetType() != res.GetType():
+		writeError(w, http.StatusBadRequest, ErrTypeChanged)
+
+		return
+	case newRes.GetID() != res.GetID():
+		writeError(w, http.StatusBadRequest, ErrIDChanged)
+
+		return
+	}
+
+	// The patch was applied to this version, so it must still be current.
+	if version == 0 {
+		version = res.GetVersion()
+	}
+
+	if err := api.store.as(claims.Subject).UpdateIf(newRes, version); err != nil {
+		writeError(w, storeStatus(err), err)
+
+		return
+	}
+
+	api.grantRequests(req.Context())
+
+	w.Header().Set("ETag", etag(newRes))
+	writeRedacted(w, http.StatusOK, newRes)
+}
+
+// Return the resource with the patch in the request body applied, as JSON, or
+// the status code and error to respond with if the patch fails.
+func (api *ResourceAPI) applyPatch(req *http.Request, claims *auth.Claims, res zebra.Resource) ([]byte, int, error) {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType != patch.MergePatchType && mediaType != patch.JSONPatchType {
+		return nil, http.StatusUnsupportedMediaType, ErrPatchType
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	doc, err := json.Marshal(res)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if mediaType == patch.MergePatchType {
+		patched, err := patch.Merge(doc, body)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+
+		return patched, http.StatusOK, nil
+	}
+
+	ops, err := patch.ParseOperations(body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if _, hasKeys, _ := zebra.MapCredentialKeys(doc, keep); hasKeys && readsValues(ops) {
+		if err := api.mayReveal(claims, res); err != nil {
+			return nil, http.StatusForbidden, err
+		}
+	}
+
+	patched, err := patch.Apply(doc, ops)
+
+	switch {
+	case errors.Is(err, patch.ErrTestFailed), errors.Is(err, patch.ErrPathMissing):
+		return nil, http.StatusConflict, err
+	case err != nil:
+		return nil, http.StatusBadRequest, err
+	}
+
+	return patched, http.StatusOK, nil
+}
+
+// Return true if any of the JSON Patch operations reads values of the
+// document it is applied to.
+func readsValues(ops []patch.Operation) bool {
+	for _, op := range ops {
+		if op.Op == patch.OpTest || op.Op == patch.OpCopy || op.Op == patch.OpMove {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return the value unchanged, for finding credential keys without mapping
+// them.
+func keep(value string) (string, error) {
+	return value, nil
+}
+
+// DeleteResource deletes the resource given in the "id" query parameter. The
+// user's role must permit deleting resources of its type. Resources that are
+// leased or booked cannot be deleted until their leases are released. If the
+// request has an If-Match header, the stored resource must still be at the
+// version it names.
+func (api *ResourceAPI) DeleteResource(w http.ResponseWriter, req *http.Request) {
+	claims := authenticated(w, req)
+	if claims == nil {
+		return
+	}
+
+	version, err := ifMatch(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	res := api.find(req.URL.Query().Get("id"))
+	if res == nil {
+		writeError(w, http.StatusNotFound, badParam("id", ErrResourceNotFound))
+
+		return
+	}
+
+	if err := claims.Authorize(auth.VerbDelete, res.GetType()); err != nil {
+		writeError(w, http.StatusForbidden, err)
+
+		return
+	}
+
+	if isLeaseType(res.GetType()) {
+		writeError(w, http.StatusBadRequest, ErrLeaseWrite)
+
+		return
+	}
+
+	if api.leases.Leased(res.GetID()) {
+		writeError(w, http.StatusConflict, ErrResourceLeased)
+
+		return
+	}
+
+	if err := api.store.as(claims.Subject).DeleteIf(res, version); err != nil {
+		writeError(w, storeStatus(err), err)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Decode the resource in the request body into a resource of the type named
+// by its "type" field, and validate it.
+func (api *ResourceAPI) decodeResource(req *http.Request) (zebra.Resource, error) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return api.unmarshalResource(req.Context(), body)
+}
+
+// Unmarshal the JSON encoded resource into a resource of the type named by
+// its "type" field, set its password if it is a user, and validate it.
+func (api *ResourceAPI) unmarshalResource(ctx context.Context, body []byte) (zebra.Resource, error) {
+	object := struct {
+		Type string `json:"type"`
+	}{Type: ""}
+
+	if err := json.Unmarshal(body, &object); err != nil {
+		return nil, err
+	}
+
+	if object.Type == "" {
+		return nil, store.ErrNoType
+	}
+
+	if isLeaseType(object.Type) {
+		return nil, ErrLeaseWrite
+	}
+
+	res := api.factory.New(object.Type)
+	if res == nil {
+		return nil, ErrTypeUnknown
+	}
+
+	if err := json.Unmarshal(body, res); err != nil {
+		return nil, err
+	}
+
+	if err := checkRedacted(body); err != nil {
+		return nil, err
+	}
+
+	if err := api.setUserPassword(res, body); err != nil {
+		return nil, err
+	}
+
+	if err := res.Validate(ctx); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Return ErrKeyRedacted if any credential key in the JSON encoded resource is
+// set to the redacted value. A client that sends back a resource it was given
+// would otherwise overwrite its credentials with the redacted value.
+func checkRedacted(contents []byte) error {
+	_, _, err := zebra.MapCredentialKeys(contents, func(value string) (string, error) {
+		if value == zebra.Redacted {
+			return value, ErrKeyRedacted
+		}
+
+		return value, nil
+	})
+
+	return err
+}
+
+// Write v as a JSON response with the given status code and its secrets
+// hidden by zebra.MarshalRedacted.
+func writeRedacted(w http.ResponseWriter, status int, v interface{}) {
+	writeMarshaled(w, status, v, zebra.MarshalRedacted)
+}
+
+// Write v, encoded by marshal, as a JSON response with the given status code.
+func writeMarshaled(w http.ResponseWriter, status int, v interface{}, marshal func(interface{}) ([]byte, error)) {
+	bytes, err := marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(bytes) // nolint:errcheck
+}
+
+// Return the ETag of the resource, its quoted version.
+func etag(res zebra.Resource) string {
+	return fmt.Sprintf(`"%d"`, res.GetVersion())
+}
+
+// Return the version named by the If-Match header of the request, or 0 if it
+// has none or it is "*".
+func ifMatch(req *http.Request) (uint64, error) {
+	value := strings.TrimSpace(req.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+
+	if len(value) < 2 || !strings.HasPrefix(value, `"`) || !strings.HasSuffix(value, `"`) {
+		return 0, ErrIfMatchInvalid
+	}
+
+	version, err := strconv.ParseUint(value[1:len(value)-1], 10, 64)
+	if err != nil || version == 0 {
+		return 0, ErrIfMatchInvalid
+	}
+
+	return version, nil
+}
+
+// Return true if resources of the type are managed by the lease manager.
+func isLeaseType(resType string) bool {
+	return resType == lease.Type || resType == lease.RequestType
+}
+
+// Return the HTTP status code for an error returned by the store.
+func storeStatus(err error) int {
+	switch {
+	case errors.Is(err, store.ErrFileExists), errors.Is(err, ErrUserNameTaken):
+		return http.StatusConflict
+	case errors.Is(err, store.ErrFileDoesNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, store.ErrIDInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, store.ErrVersionConflict), errors.Is(err, query.ErrVersionConflict):
+		return http.StatusPreconditionFailed
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,378 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/api"
+	"github.com/project-safari/zebra/audit"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/compute"
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/network"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteResources(t *testing.T) { // nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "resourcestore1"
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	factory := leaseFactory().Add("Credentials", func() zebra.Resource { return new(zebra.Credentials) })
+
+	myAPI := api.NewResourceAPI(factory)
+	assert.Nil(myAPI.Initialize(root))
+
+	pool := `{"id":"0100000001","type":"VLANPool","rangeStart":1,"rangeEnd":10}`
+
+	rec := serve(myAPI.CreateResource, http.MethodPost, "/api/v1/resources", pool)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	created := new(network.VLANPool)
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), created))
+	assert.Equal(uint16(10), created.RangeEnd)
+
+	// Created resources can be queried.
+	rec = serve(myAPI.GetResources, http.MethodGet, "/api/v1/resources?id=0100000001", "")
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), `"rangeEnd":10`)
+
+	rec = serve(myAPI.CreateResource, http.MethodPost, "/api/v1/resources", pool)
+	assert.Equal(http.StatusConflict, rec.Code)
+
+	for _, body := range []string{
+		`{`,
+		`{"id":"0100000002","rangeEnd":10}`,
+		`{"id":"0100000002","type":"Unknown"}`,
+		`{"type":"VLANPool","rangeEnd":10}`,
+		`{"id":"01/../../0100000002","type":"VLANPool","rangeEnd":10}`,
+		`{"id":"0100000002","type":"Lease","owner":"shravya","resources":["0100000001"],"duration":1}`,
+	} {
+		rec = serve(myAPI.CreateResource, http.MethodPost, "/api/v1/resources", body)
+		assert.Equal(http.StatusBadRequest, rec.Code, body)
+	}
+
+	// Credential keys without a validator are rejected.
+	rec = serve(myAPI.CreateResource, http.MethodPost, "/api/v1/resources",
+		`{"id":"0100000002","type":"Credentials","name":"admin","Keys":{"enable":"properPass123$"}}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	assert.Contains(rec.Body.String(), zebra.ErrKeyUnknown.Error())
+
+	rec = serve(as("shravya", auth.RoleDeveloper, myAPI.CreateResource), http.MethodPost, "/api/v1/resources",
+		`{"id":"0100000002","type":"VLANPool","rangeEnd":10}`)
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	rec = serve(myAPI.UpdateResource, http.MethodPut, "/api/v1/resources",
+		`{"id":"0100000001","type":"VLANPool","rangeStart":1,"rangeEnd":20}`)
+	assert.Equal(http.StatusOK, rec.Code)
+
+	rec = serve(myAPI.GetResources, http.MethodGet, "/api/v1/resources?id=0100000001", "")
+	assert.Contains(rec.Body.String(), `"rangeEnd":20`)
+
+	rec = serve(myAPI.UpdateResource, http.MethodPut, "/api/v1/resources",
+		`{"id":"0100000002","type":"VLANPool","rangeEnd":20}`)
+	assert.Equal(http.StatusNotFound, rec.Code)
+
+	rec = serve(myAPI.UpdateResource, http.MethodPut, "/api/v1/resources",
+		`{"id":"0100000001","type":"Credentials","name":"root","Keys":{"password":"properPass123$"}}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	// Credentials are redacted in responses and cannot be set to the
+	// redacted value.
+	rec = serve(myAPI.CreateResource, http.MethodPost, "/api/v1/resources",
+		`{"id":"0100000003","type":"Credentials","name":"root","Keys":{"password":"properPass123$"}}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+	assert.NotContains(rec.Body.String(), "properPass123$")
+
+	rec = serve(myAPI.UpdateResource, http.MethodPut, "/api/v1/resources", rec.Body.String())
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = serve(as("shravya", auth.RoleDeveloper, myAPI.DeleteResource), http.MethodDelete,
+		"/api/v1/resources?id=0100000001", "")
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	rec = serve(myAPI.DeleteResource, http.MethodDelete, "/api/v1/resources?id=0100000001", "")
+	assert.Equal(http.StatusNoContent, rec.Code)
+
+	rec = serve(myAPI.DeleteResource, http.MethodDelete, "/api/v1/resources?id=0100000001", "")
+	assert.Equal(http.StatusNotFound, rec.Code)
+
+	// Leases are only released through the lease endpoints.
+	l := lease.NewLease("shravya", []string{"0100000003"}, time.Hour)
+	assert.Nil(myAPI.Leases().Acquire(context.Background(), l))
+
+	rec = serve(myAPI.DeleteResource, http.MethodDelete, "/api/v1/resources?id="+l.ID, "")
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	// Leased or booked resources cannot be deleted.
+	rec = serve(myAPI.DeleteResource, http.MethodDelete, "/api/v1/resources?id=0100000003", "")
+	assert.Equal(http.StatusConflict, rec.Code)
+	assert.Equal(api.ErrResourceLeased.Error(), responseError(t, rec).Message)
+
+	rec = serve(myAPI.CreateResource, http.MethodPost, "/api/v1/resources",
+		`{"id":"0100000004","type":"VLANPool","rangeStart":1,"rangeEnd":10}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	booking := lease.NewLease("shravya", []string{"0100000004"}, time.Hour)
+	booking.Start = booking.Start.Add(24 * time.Hour)
+	assert.Nil(myAPI.Leases().Acquire(context.Background(), booking))
+
+	rec = serve(myAPI.DeleteResource, http.MethodDelete, "/api/v1/resources?id=0100000004", "")
+	assert.Equal(http.StatusConflict, rec.Code)
+
+	assert.Nil(myAPI.Leases().Release(context.Background(), booking.ID))
+
+	rec = serve(myAPI.DeleteResource, http.MethodDelete, "/api/v1/resources?id=0100000004", "")
+	assert.Equal(http.StatusNoContent, rec.Code)
+
+	// Every write is audited.
+	rec = serve(myAPI.GetAudit, http.MethodGet, "/api/v1/audit?user=admin&resource=0100000001", "")
+	records := []*audit.Record{}
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), &records))
+	assert.Len(records, 3)
+	assert.Equal(audit.ActionCreate, records[0].Action)
+	assert.Equal(audit.ActionUpdate, records[1].Action)
+	assert.Equal([]audit.Change{
+		{Path: "rangeEnd", Before: 10.0, After: 20.0},
+		{Path: "version", Before: 1.0, After: 2.0},
+	}, records[1].Changes)
+	assert.Equal(audit.ActionDelete, records[2].Action)
+}
+
+func TestVersions(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "resourcestore2"
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	myAPI := api.NewResourceAPI(leaseFactory())
+	assert.Nil(myAPI.Initialize(root))
+
+	write := func(h http.HandlerFunc, method string, target string, ifMatch string,
+		body string,
+	) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+
+		asAdmin(h)(rec, req)
+
+		return rec
+	}
+
+	rec := serve(myAPI.CreateResource, http.MethodPost, "/api/v1/resources",
+		`{"id":"0100000001","type":"VLANPool","rangeEnd":10}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+	assert.Equal(`"1"`, rec.Header().Get("ETag"))
+
+	rec = serve(myAPI.GetResources, http.MethodGet, "/api/v1/resources?id=0100000001", "")
+	assert.Equal(`"1"`, rec.Header().Get("ETag"))
+	assert.Contains(rec.Body.String(), `"version":1`)
+
+	// The first of two writers based on the same version wins.
+	rec = write(myAPI.UpdateResource, http.MethodPut, "/api/v1/resources", `"1"`,
+		`{"id":"0100000001","type":"VLANPool","rangeEnd":20}`)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal(`"2"`, rec.Header().Get("ETag"))
+
+	rec = write(myAPI.UpdateResource, http.MethodPut, "/api/v1/resources", `"1"`,
+		`{"id":"0100000001","type":"VLANPool","rangeEnd":30}`)
+	assert.Equal(http.StatusPreconditionFailed, rec.Code)
+	assert.Equal("precondition_failed", responseError(t, rec).Code)
+
+	rec = write(myAPI.DeleteResource, http.MethodDelete, "/api/v1/resources?id=0100000001", `"1"`, "")
+	assert.Equal(http.StatusPreconditionFailed, rec.Code)
+
+	rec = serve(myAPI.GetResources, http.MethodGet, "/api/v1/resources?id=0100000001", "")
+	assert.Contains(rec.Body.String(), `"rangeEnd":20`)
+	assert.Equal(`"2"`, rec.Header().Get("ETag"))
+
+	for _, ifMatch := range []string{"2", `W/"2"`, `"0"`, `"two"`} {
+		rec = write(myAPI.DeleteResource, http.MethodDelete, "/api/v1/resources?id=0100000001", ifMatch, "")
+		assert.Equal(http.StatusBadRequest, rec.Code, ifMatch)
+	}
+
+	// Writers that do not ask for a version always win.
+	rec = write(myAPI.UpdateResource, http.MethodPut, "/api/v1/resources", "*",
+		`{"id":"0100000001","type":"VLANPool","rangeEnd":30}`)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal(`"3"`, rec.Header().Get("ETag"))
+
+	// Concurrent writers only fail if their write was not saved, so the
+	// version grows by the number of writers that succeeded.
+	codes := make(chan int, 16)
+	for i := 0; i < cap(codes); i++ {
+		ifMatch := `"3"`
+		if i%2 == 0 {
+			ifMatch = "*"
+		}
+
+		go func(ifMatch string, end int) {
+			codes <- write(myAPI.UpdateResource, http.MethodPut, "/api/v1/resources", ifMatch,
+				fmt.Sprintf(`{"id":"0100000001","type":"VLANPool","rangeEnd":%d}`, end)).Code
+		}(ifMatch, 40+i)
+	}
+
+	won := 0
+
+	for i := 0; i < cap(codes); i++ {
+		if code := <-codes; code == http.StatusOK {
+			won++
+		} else {
+			assert.Equal(http.StatusPreconditionFailed, code)
+		}
+	}
+
+	assert.GreaterOrEqual(won, cap(codes)/2)
+
+	etag := fmt.Sprintf(`"%d"`, 3+won)
+
+	rec = serve(myAPI.GetResources, http.MethodGet, "/api/v1/resources?id=0100000001", "")
+	assert.Equal(etag, rec.Header().Get("ETag"))
+
+	rec = write(myAPI.DeleteResource, http.MethodDelete, "/api/v1/resources?id=0100000001", etag, "")
+	assert.Equal(http.StatusNoContent, rec.Code)
+}
+
+func TestPatchResource(t *testing.T) { // nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "resourcestore3"
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	factory := leaseFactory().Add("VM", func() zebra.Resource { return new(compute.VM) })
+	myAPI := api.NewResourceAPI(factory)
+	assert.Nil(myAPI.Initialize(root))
+
+	patch := func(h http.HandlerFunc, id string, contentType string, ifMatch string,
+		body string,
+	) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/resources?id="+id, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+
+		h(rec, req)
+
+		return rec
+	}
+
+	merge := "application/merge-patch+json"
+	jsonPatch := "application/json-patch+json"
+
+	rec := serve(myAPI.CreateResource, http.MethodPost, "/api/v1/resources",
+		`{"id":"0100000001","type":"VLANPool","labels":{"pool":"perf","owner":"shravya"},"rangeEnd":10}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	rec = patch(asAdmin(myAPI.PatchResource), "0100000001", merge, "",
+		`{"labels":{"owner":null,"team":"func"},"rangeEnd":20}`)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal(`"2"`, rec.Header().Get("ETag"))
+
+	pool := new(network.VLANPool)
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), pool))
+	assert.Equal(zebra.Labels{"pool": "perf", "team": "func"}, pool.Labels)
+	assert.Equal(uint16(20), pool.RangeEnd)
+
+	rec = patch(asAdmin(myAPI.PatchResource), "0100000001", jsonPatch+"; charset=utf-8", `"2"`,
+		`[{"op":"test","path":"/rangeEnd","value":20},{"op":"replace","path":"/rangeStart","value":5}]`)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal(`"3"`, rec.Header().Get("ETag"))
+	assert.Contains(rec.Body.String(), `"rangeStart":5`)
+
+	// Patches based on an older version fail.
+	rec = patch(asAdmin(myAPI.PatchResource), "0100000001", jsonPatch, `"2"`,
+		`[{"op":"replace","path":"/rangeStart","value":6}]`)
+	assert.Equal(http.StatusPreconditionFailed, rec.Code)
+
+	tests := []struct {
+		id          string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"0100000001", jsonPatch, `[{"op":"test","path":"/rangeEnd","value":10}]`, http.StatusConflict},
+		{"0100000001", jsonPatch, `[{"op":"remove","path":"/labels/owner"}]`, http.StatusConflict},
+		{"0100000001", jsonPatch, `[{"op":"rename","path":"/rangeEnd"}]`, http.StatusBadRequest},
+		{"0100000001", merge, `{"rangeStart":50}`, http.StatusBadRequest},
+		{"0100000001", merge, `{"id":"0100000002"}`, http.StatusBadRequest},
+		{"0100000001", merge, `{"type":"VM"}`, http.StatusBadRequest},
+		{"0100000001", merge, `{"type":"Lease"}`, http.StatusBadRequest},
+		{"0100000002", merge, `{"rangeEnd":30}`, http.StatusNotFound},
+		{"0100000001", "application/json", `{"rangeEnd":30}`, http.StatusUnsupportedMediaType},
+	}
+
+	for _, test := range tests {
+		rec = patch(asAdmin(myAPI.PatchResource), test.id, test.contentType, "", test.body)
+		assert.Equal(test.status, rec.Code, test.body)
+	}
+
+	assert.Equal("application/merge-patch+json, application/json-patch+json", rec.Header().Get("Accept-Patch"))
+
+	rec = patch(as("shravya", auth.RoleDeveloper, myAPI.PatchResource), "0100000001", merge, "", `{"rangeEnd":30}`)
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	rec = serve(myAPI.GetResources, http.MethodGet, "/api/v1/resources?id=0100000001", "")
+	assert.Equal(`"3"`, rec.Header().Get("ETag"))
+
+	// Credential keys not in the patch are kept, and cannot be set to the
+	// redacted value.
+	rec = serve(myAPI.CreateResource, http.MethodPost, "/api/v1/resources",
+		`{"id":"0200000001","type":"VM","name":"build-vm","esxID":"0300000001","vCenterID":"0400000001",`+
+			`"managementIP":"10.0.0.2","credentials":{"id":"0200000002","type":"Credentials","name":"root",`+
+			`"Keys":{"password":"properPass123$"}}}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	rec = patch(asAdmin(myAPI.PatchResource), "0200000001", merge, "", `{"name":"test-vm"}`)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), `"password":"********"`)
+
+	rec = serve(myAPI.GetCredentials, http.MethodGet, "/api/v1/resources/credentials?id=0200000001", "")
+	assert.Contains(rec.Body.String(), `"name":"test-vm"`)
+	assert.Contains(rec.Body.String(), `"password":"properPass123$"`)
+
+	rec = patch(asAdmin(myAPI.PatchResource), "0200000001", merge, "",
+		`{"credentials":{"Keys":{"password":"********"}}}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	assert.Equal(api.ErrKeyRedacted.Error(), responseError(t, rec).Message)
+
+	// Operations that read credential keys need permission to reveal them,
+	// which developers only have for the resources they lease.
+	developer := as("shravya", auth.RoleDeveloper, myAPI.PatchResource)
+	testOp := `[{"op":"test","path":"/credentials/Keys/password","value":"properPass123$"}]`
+	moveOp := `[{"op":"move","from":"/credentials/Keys/password","path":"/credentials/Keys/ssh-key"}]`
+
+	for _, body := range []string{testOp, moveOp} {
+		rec = patch(developer, "0200000001", jsonPatch, "", body)
+		assert.Equal(http.StatusForbidden, rec.Code, body)
+		assert.Equal(api.ErrNotLeased.Error(), responseError(t, rec).Message, body)
+	}
+
+	rec = patch(developer, "0200000001", jsonPatch, "", `[{"op":"replace","path":"/name","value":"dev-vm"}]`)
+	assert.Equal(http.StatusOK, rec.Code)
+
+	rec = serve(as("shravya", auth.RoleDeveloper, myAPI.CreateLease), http.MethodPost, "/api/v1/leases",
+		`{"resources":["0200000001"],"duration":"1h"}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	rec = patch(developer, "0200000001", jsonPatch, "", testOp)
+	assert.Equal(http.StatusOK, rec.Code)
+}
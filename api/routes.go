@@ -0,0 +1,228 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/project-safari/zebra/audit"
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/patch"
+	"github.com/project-safari/zebra/schema"
+)
+
+// A Param is a query parameter or header that a route reads. In is "query"
+// or "header", and Type is the JSON Schema type of its value.
+type Param struct {
+	Name        string
+	In          string
+	Type        string
+	Description string
+}
+
+// A Route is an endpoint of the API. The server serves requests with Method
+// to Path with Handler, and the OpenAPI document describes the route with the
+// rest: Name identifies the operation, Body is the schema of the request
+// body, if any, sent as one of BodyTypes, or as JSON if none, and Response the
+// schema of the body of responses with Status, sent as ContentType, or as JSON
+// if empty. Accepted, if not nil, is the schema of the body of responses with
+// 202 Accepted, which routes that may queue a request rather than serve it
+// send.
+type Route struct {
+	Name        string
+	Method      string
+	Path        string
+	Handler     http.HandlerFunc
+	Summary     string
+	Params      []Param
+	Body        *schema.Schema
+	BodyTypes   []string
+	Status      int
+	Response    *schema.Schema
+	ContentType string
+	Accepted    *schema.Schema
+}
+
+// Parameters shared by several routes.
+var ( //nolint:gochecknoglobals
+	idParam = Param{Name: "id", In: "query", Type: "string", Description: "ID of the resource."}
+
+	filterParams = []Param{
+		{Name: "id", In: "query", Type: "string", Description: "Comma separated list of resource IDs."},
+		{Name: "type", In: "query", Type: "string", Description: "Comma separated list of resource types."},
+		{Name: "label", In: "query", Type: "string", Description: "Selector on resource labels."},
+		{Name: "property", In: "query", Type: "string", Description: "Selector on resource properties."},
+	}
+
+	pageParams = []Param{
+		{Name: "sort", In: "query", Type: "string", Description: "Property to sort by, prefixed with - to reverse."},
+		{Name: "limit", In: "query", Type: "integer", Description: "Most resources to return, up to 1000, 100 by default."},
+		{Name: "cursor", In: "query", Type: "string", Description: "Where the page starts, from the next Link."},
+	}
+
+	ifMatchParam = Param{
+		Name: "If-Match", In: "header", Type: "string", Description: "ETag of the version the change is based on.",
+	}
+
+	leaseFilterParams = []Param{
+		{Name: "owner", In: "query", Type: "string", Description: "Owner of the leases."},
+		{Name: "resource", In: "query", Type: "string", Description: "ID of a resource held by the leases."},
+		{Name: "group", In: "query", Type: "string", Description: "Group whose members own the leases."},
+		{Name: "label", In: "query", Type: "string", Description: "Selector on the labels of leased resources."},
+	}
+)
+
+// Routes returns every endpoint of the API.
+func (api *ResourceAPI) Routes() []Route { //nolint:funlen
+	return []Route{
+		{
+			Name: "login", Method: http.MethodPost, Path: LoginPath, Handler: api.Login,
+			Summary: "Log in and receive a bearer token.", Params: nil,
+			Body: schemaOf(loginRequest{}), BodyTypes: nil,
+			Status: http.StatusOK, Response: schemaOf(loginResponse{}), ContentType: "", Accepted: nil,
+		},
+		{
+			Name: "setPassword", Method: http.MethodPost, Path: "/api/v1/users/password", Handler: api.SetPassword,
+			Summary: "Set the password of a user.", Params: nil,
+			Body: schemaOf(passwordRequest{}), BodyTypes: nil,
+			Status: http.StatusNoContent, Response: nil, ContentType: "", Accepted: nil,
+		},
+		{
+			Name: "getResources", Method: http.MethodGet, Path: "/api/v1/resources", Handler: api.GetResources,
+			Summary: "List the resources that pass every filter.", Params: join(filterParams, pageParams),
+			Body: nil, BodyTypes: nil, Status: http.StatusOK, Response: ref(resourceMapSchema), ContentType: "", Accepted: nil,
+		},
+		{
+			Name: "createResource", Method: http.MethodPost, Path: "/api/v1/resources", Handler: api.CreateResource,
+			Summary: "Create a resource.", Params: nil,
+			Body: ref(resourceSchema), BodyTypes: nil, Status: http.StatusCreated, Response: ref(resourceSchema),
+			ContentType: "", Accepted: nil,
+		},
+		{
+			Name: "updateResource", Method: http.MethodPut, Path: "/api/v1/resources", Handler: api.UpdateResource,
+			Summary: "Replace a resource.", Params: []Param{ifMatchParam},
+			Body: ref(resourceSchema), BodyTypes: nil, Status: http.StatusOK, Response: ref(resourceSchema), ContentType: "",
+			Accepted: nil,
+		},
+		{
+			Name: "patchResource", Method: http.MethodPatch, Path: "/api/v1/resources", Handler: api.PatchResource,
+			Summary: "Patch a resource with a JSON Merge Patch or a JSON Patch.", Params: []Param{idParam, ifMatchParam},
+			Body: schema.OneOf(schema.Type("object"), schema.Array(schemaOf(patch.Operation{}))), Status: http.StatusOK,
+			BodyTypes: []string{patch.MergePatchType, patch.JSONPatchType}, Response: ref(resourceSchema), ContentType: "",
+			Accepted: nil,
+		},
+		{
+			Name: "deleteResource", Method: http.MethodDelete, Path: "/api/v1/resources", Handler: api.DeleteResource,
+			Summary: "Delete a resource.", Params: []Param{idParam, ifMatchParam},
+			Body: nil, BodyTypes: nil, Status: http.StatusNoContent, Response: nil, ContentType: "", Accepted: nil,
+		},
+		{
+			Name: "importResources", Method: http.MethodPost, Path: "/api/v1/resources/import",
+			Handler: api.ImportResources, Summary: "Create every resource in a resource map, or none.", Params: nil,
+			Body: ref(resourceMapSchema), BodyTypes: nil, Status: http.StatusCreated,
+			Response: ref(resourceMapSchema), ContentType: "", Accepted: nil,
+		},
+		{
+			Name: "getCredentials", Method: http.MethodGet, Path: "/api/v1/resources/credentials",
+			Handler: api.GetCredentials, Summary: "Read a resource with its credential keys.", Params: []Param{idParam},
+			Body: nil, BodyTypes: nil, Status: http.StatusOK, Response: ref(resourceSchema), ContentType: "", Accepted: nil,
+		},
+		{
+			Name: "getLeases", Method: http.MethodGet, Path: "/api/v1/leases", Handler: api.GetLeases,
+			Summary: "List the current and future leases.", Params: leaseFilterParams,
+			Body: nil, BodyTypes: nil, Status: http.StatusOK, Response: schema.Array(ref(lease.Type)), ContentType: "",
+			Accepted: nil,
+		},
+		{
+			Name: "createLease", Method: http.MethodPost, Path: "/api/v1/leases", Handler: api.CreateLease,
+			Summary: "Lease resources, or queue a request for them.", Params: nil,
+			Body: schemaOf(leaseRequest{}), BodyTypes: nil,
+			Status: http.StatusCreated, Response: ref(lease.Type), ContentType: "", Accepted: ref(lease.RequestType),
+		},
+		{
+			Name: "deleteLease", Method: http.MethodDelete, Path: "/api/v1/leases", Handler: api.DeleteLease,
+			Summary: "Release a lease.", Params: []Param{idParam},
+			Body: nil, BodyTypes: nil, Status: http.StatusNoContent, Response: nil, ContentType: "", Accepted: nil,
+		},
+		{
+			Name: "renewLease", Method: http.MethodPost, Path: "/api/v1/leases/renew", Handler: api.RenewLease,
+			Summary: "Extend a lease.", Params: []Param{
+				idParam, {Name: "extend", In: "query", Type: "string", Description: "Duration to extend by, such as 2h."},
+			},
+			Body: nil, BodyTypes: nil, Status: http.StatusOK, Response: ref(lease.Type), ContentType: "", Accepted: nil,
+		},
+		{
+			Name: "getCalendar", Method: http.MethodGet, Path: CalendarPath, Handler: api.GetCalendar,
+			Summary: "Subscribe to the leases as an iCalendar feed.", Params: join(leaseFilterParams, []Param{
+				{Name: "token", In: "query", Type: "string", Description: "Calendar token, instead of a bearer token."},
+			}),
+			Body: nil, BodyTypes: nil, Status: http.StatusOK, Response: nil, ContentType: "text/calendar", Accepted: nil,
+		},
+		{
+			Name: "createCalendarToken", Method: http.MethodPost, Path: CalendarPath + "/token",
+			Handler: api.CreateCalendarToken, Summary: "Get a token for subscribing to the lease calendar.", Params: nil,
+			Body: nil, BodyTypes: nil, Status: http.StatusCreated, Response: schemaOf(calendarToken{}), ContentType: "",
+			Accepted: nil,
+		},
+		{
+			Name: "getLeaseRequests", Method: http.MethodGet, Path: "/api/v1/leases/requests",
+			Handler: api.GetLeaseRequests, Summary: "List the queued lease requests, or wait for one.", Params: []Param{
+				idParam, {Name: "wait", In: "query", Type: "string", Description: "How long to wait, such as 30s."},
+			},
+			Body: nil, BodyTypes: nil, Status: http.StatusOK, ContentType: "", Accepted: nil,
+			Response: schema.OneOf(schema.Array(ref(lease.RequestType)), ref(lease.RequestType)),
+		},
+		{
+			Name: "deleteLeaseRequest", Method: http.MethodDelete, Path: "/api/v1/leases/requests",
+			Handler: api.DeleteLeaseRequest, Summary: "Cancel a queued lease request.", Params: []Param{idParam},
+			Body: nil, BodyTypes: nil, Status: http.StatusNoContent, Response: nil, ContentType: "", Accepted: nil,
+		},
+		{
+			Name: "getAudit", Method: http.MethodGet, Path: "/api/v1/audit", Handler: api.GetAudit,
+			Summary: "List the audit records.", Params: []Param{
+				{Name: "user", In: "query", Type: "string", Description: "User who made the changes."},
+				{Name: "resource", In: "query", Type: "string", Description: "ID of the changed resource."},
+				{Name: "type", In: "query", Type: "string", Description: "Type of the changed resources."},
+				{Name: "from", In: "query", Type: "string", Description: "RFC 3339 time of the first change."},
+				{Name: "to", In: "query", Type: "string", Description: "RFC 3339 time of the last change."},
+			},
+			Body: nil, BodyTypes: nil, Status: http.StatusOK, Response: schema.Array(schemaOf(audit.Record{})), ContentType: "",
+			Accepted: nil,
+		},
+		{
+			Name: "watch", Method: http.MethodGet, Path: "/api/v1/watch", Handler: api.Watch,
+			Summary: "Stream resource changes as Server-Sent Events.", Params: join(filterParams, []Param{
+				{Name: "revision", In: "query", Type: "string", Description: "ID of the event to resume after."},
+				{Name: "Last-Event-ID", In: "header", Type: "string", Description: "ID of the event to resume after."},
+			}),
+			Body: nil, BodyTypes: nil, Status: http.StatusOK, Response: nil, ContentType: "text/event-stream", Accepted: nil,
+		},
+		{
+			Name: "getTypes", Method: http.MethodGet, Path: "/api/v1/types", Handler: api.GetTypes,
+			Summary: "Describe resource types with JSON Schemas.", Params: []Param{
+				{Name: "type", In: "query", Type: "string", Description: "Comma separated list of resource types."},
+			},
+			Body: nil, BodyTypes: nil, Status: http.StatusOK, Response: schema.Map(schema.For(reflect.TypeOf(schema.Schema{}))),
+			ContentType: "", Accepted: nil,
+		},
+		{
+			Name: "getOpenAPI", Method: http.MethodGet, Path: "/api/v1/openapi.json", Handler: api.GetOpenAPI,
+			Summary: "Describe the API as an OpenAPI document.", Params: nil,
+			Body: nil, BodyTypes: nil, Status: http.StatusOK, Response: nil, ContentType: "", Accepted: nil,
+		},
+	}
+}
+
+// Return the parameters of all lists.
+func join(lists ...[]Param) []Param {
+	params := []Param{}
+	for _, list := range lists {
+		params = append(params, list...)
+	}
+
+	return params
+}
+
+// Return the schema of the JSON encoding of v.
+func schemaOf(v interface{}) *schema.Schema {
+	return schema.For(reflect.TypeOf(v))
+}
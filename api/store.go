@@ -0,0 +1,261 @@
+package api
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/audit"
+	"github.com/project-safari/zebra/query"
+	"github.com/project-safari/zebra/store"
+	"github.com/project-safari/zebra/watch"
+)
+
+// syncStore implements zebra.Store on top of the file store and the query
+// store, so that every write persisted by the API is also indexed for queries.
+// If it has an audit log, every write is recorded in it as made by its user.
+// If it has an event hub, every write is published to it once indexed. Each
+// write holds the lock, which all stores on the same file store share, until
+// it is done, so that no other write comes between checking the version in
+// the file store and indexing the result. The file store alone checks
+// versions, and the query store follows it.
+type syncStore struct {
+	lock       *sync.Mutex
+	fileStore  *store.FileStore
+	queryStore *query.QueryStore
+	audit      *audit.Log
+	events     *watch.Hub
+	user       string
+}
+
+// Return a copy of the store that records writes as made by the given user.
+func (s *syncStore) as(user string) *syncStore {
+	return &syncStore{
+		lock: s.lock, fileStore: s.fileStore, queryStore: s.queryStore, audit: s.audit, events: s.events, user: user,
+	}
+}
+
+func (s *syncStore) Initialize() error {
+	return s.fileStore.Initialize()
+}
+
+func (s *syncStore) Wipe() error {
+	if err := s.fileStore.Wipe(); err != nil {
+		return err
+	}
+
+	return s.queryStore.Wipe()
+}
+
+func (s *syncStore) Clear() error {
+	if err := s.fileStore.Clear(); err != nil {
+		return err
+	}
+
+	return s.queryStore.Clear()
+}
+
+// Load returns the indexed resources, which mirror the file store.
+func (s *syncStore) Load() (*zebra.ResourceMap, error) {
+	return s.queryStore.Load()
+}
+
+func (s *syncStore) Create(res zebra.Resource) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.checkName(res); err != nil {
+		return err
+	}
+
+	if err := s.fileStore.Create(res); err != nil {
+		return err
+	}
+
+	if err := s.queryStore.Create(res); err != nil {
+		return err
+	}
+
+	s.publish(watch.ActionCreate, res)
+
+	return s.record(audit.ActionCreate, nil, res)
+}
+
+func (s *syncStore) Update(res zebra.Resource) error {
+	return s.UpdateIf(res, 0)
+}
+
+// UpdateIf updates the resource if its stored version is the given version,
+// as described in store.FileStore.UpdateIf.
+func (s *syncStore) UpdateIf(res zebra.Resource, version uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.checkName(res); err != nil {
+		return err
+	}
+
+	before := s.get(res.GetID())
+
+	if err := s.fileStore.UpdateIf(res, version); err != nil {
+		return err
+	}
+
+	if err := s.queryStore.UpdateIf(res, 0); err != nil {
+		return err
+	}
+
+	s.publish(watch.ActionUpdate, res)
+
+	return s.record(audit.ActionUpdate, before, res)
+}
+
+func (s *syncStore) Delete(res zebra.Resource) error {
+	return s.DeleteIf(res, 0)
+}
+
+// DeleteIf deletes the resource if its stored version is the given version,
+// as described in store.FileStore.DeleteIf.
+func (s *syncStore) DeleteIf(res zebra.Resource, version uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	before := s.get(res.GetID())
+
+	if err := s.fileStore.DeleteIf(res, version); err != nil {
+		return err
+	}
+
+	if err := s.queryStore.DeleteIf(res, 0); err != nil {
+		return err
+	}
+
+	s.publish(watch.ActionDelete, res)
+
+	return s.record(audit.ActionDelete, before, nil)
+}
+
+// Import stores all resources in the resource map or none of them, as
+// described in store.FileStore.Import.
+func (s *syncStore) Import(resMap *zebra.ResourceMap) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.checkNames(resMap); err != nil {
+		return err
+	}
+
+	if err := s.fileStore.Import(resMap); err != nil {
+		return err
+	}
+
+	for _, list := range resMap.Resources {
+		for _, res := range list.Resources {
+			if err := s.queryStore.Create(res); err != nil {
+				return err
+			}
+
+			s.publish(watch.ActionCreate, res)
+
+			if err := s.record(audit.ActionCreate, nil, res); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Return ErrUserNameTaken if the resource is a user whose name another stored
+// user has. Users log in by name, so names must be unique. Should not be
+// called without holding the lock.
+func (s *syncStore) checkName(res zebra.Resource) error {
+	user, ok := res.(*zebra.User)
+	if !ok {
+		return nil
+	}
+
+	if id, ok := s.userNames()[user.Name]; ok && id != user.ID {
+		return ErrUserNameTaken
+	}
+
+	return nil
+}
+
+// Return a store.ImportError listing the users in the resource map whose
+// names another stored user, or another user in the map, has. Should not be
+// called without holding the lock.
+func (s *syncStore) checkNames(resMap *zebra.ResourceMap) error {
+	names := s.userNames()
+	failures := store.ImportError{}
+
+	for resType, list := range resMap.Resources {
+		for _, res := range list.Resources {
+			user, ok := res.(*zebra.User)
+			if !ok {
+				continue
+			}
+
+			if id, ok := names[user.Name]; ok && id != user.ID {
+				failures = append(failures, store.Failure{ID: user.ID, Type: resType, Err: ErrUserNameTaken})
+
+				continue
+			}
+
+			names[user.Name] = user.ID
+		}
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(failures, func(i, j int) bool {
+		return failures[i].ID < failures[j].ID
+	})
+
+	return failures
+}
+
+// Return the IDs of the stored users by their names.
+func (s *syncStore) userNames() map[string]string {
+	names := map[string]string{}
+
+	for _, list := range s.queryStore.QueryType([]string{userType}).Resources {
+		for _, res := range list.Resources {
+			if user, ok := res.(*zebra.User); ok {
+				names[user.Name] = user.ID
+			}
+		}
+	}
+
+	return names
+}
+
+// Return the stored resource with the given ID, or nil if there is none.
+func (s *syncStore) get(id string) zebra.Resource {
+	for _, list := range s.queryStore.QueryUUID([]string{id}).Resources {
+		for _, res := range list.Resources {
+			return res
+		}
+	}
+
+	return nil
+}
+
+// Publish a write to the event hub, if the store has one. Should not be called
+// without holding the lock, so that revisions follow the order of the writes.
+func (s *syncStore) publish(action string, res zebra.Resource) {
+	if s.events != nil {
+		s.events.Publish(action, res)
+	}
+}
+
+// Record a write in the audit log, if the store has one.
+func (s *syncStore) record(action string, before zebra.Resource, after zebra.Resource) error {
+	if s.audit == nil {
+		return nil
+	}
+
+	return appendRecord(s.audit, s.user, action, before, after)
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/project-safari/zebra/schema"
+)
+
+// GetTypes returns the JSON Schema of each resource type the API knows,
+// keyed by type name. The "type" parameter, a comma separated list of types,
+// selects the types to return; unknown types fail with 404.
+func (api *ResourceAPI) GetTypes(w http.ResponseWriter, req *http.Request) {
+	if authenticated(w, req) == nil {
+		return
+	}
+
+	types := commaList(req.URL.Query().Get("type"))
+	if types == nil {
+		types = api.factory.Types()
+	}
+
+	schemas := make(map[string]*schema.Schema, len(types))
+
+	for _, t := range types {
+		res := api.factory.New(t)
+		if res == nil {
+			writeError(w, http.StatusNotFound, badParam("type", ErrTypeUnknown))
+
+			return
+		}
+
+		schemas[t] = schema.Resource(t, res)
+	}
+
+	writeJSON(w, http.StatusOK, schemas)
+}
@@ -0,0 +1,40 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTypes(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	myAPI := newLeaseAPI(t, "typestore1", nil)
+
+	rec := serve(myAPI.GetTypes, http.MethodGet, "/api/v1/types", "")
+	assert.Equal(http.StatusOK, rec.Code)
+
+	schemas := map[string]*schema.Schema{}
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), &schemas))
+	assert.Len(schemas, 4)
+	assert.Equal(lease.Type, schemas[lease.Type].Title)
+	assert.Equal("string", schemas[lease.Type].Properties["duration"].Type)
+
+	rec = serve(myAPI.GetTypes, http.MethodGet, "/api/v1/types?type=VLANPool", "")
+	assert.Equal(http.StatusOK, rec.Code)
+
+	schemas = map[string]*schema.Schema{}
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), &schemas))
+	assert.Len(schemas, 1)
+	assert.Equal("VLANPool", schemas["VLANPool"].Properties["type"].Const)
+	assert.Equal(int64(65535), *schemas["VLANPool"].Properties["rangeEnd"].Maximum)
+
+	rec = serve(myAPI.GetTypes, http.MethodGet, "/api/v1/types?type=VLANPool,Spaceship", "")
+	assert.Equal(http.StatusNotFound, rec.Code)
+	assert.Equal("type", responseError(t, rec).Param)
+}
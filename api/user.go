@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+)
+
+var ErrPasswordHashSet = errors.New("password hashes cannot be set, set the password instead")
+
+var ErrUserNotFound = errors.New("user does not exist")
+
+var ErrUserNameTaken = errors.New("user name is taken by another user")
+
+var ErrPasswordIncorrect = errors.New("current password is incorrect")
+
+// Resource type of users.
+const userType = "User"
+
+// A passwordRequest holds the new password of a user, and the name of the
+// user if not the one making the request. Users setting their own password
+// must also give their current one.
+type passwordRequest struct {
+	Name     string `json:"name,omitempty"`
+	Current  string `json:"current,omitempty"`
+	Password string `json:"password"`
+}
+
+// SetPassword sets the password of the user named in the request body, or of
+// the user making the request if none is named. The password must follow the
+// rules of zebra.ValidatePassword, and only its salted hash is stored. Users
+// may set their own password if they give their current one; setting another
+// user's password requires permission to update users. Tokens issued to the
+// user before are revoked, so they must log in again.
+func (api *ResourceAPI) SetPassword(w http.ResponseWriter, req *http.Request) {
+	claims := authenticated(w, req)
+	if claims == nil {
+		return
+	}
+
+	body := new(passwordRequest)
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	if body.Name == "" {
+		body.Name = claims.Subject
+	}
+
+	if err := mayManage(claims, body.Name, auth.VerbUpdate, userType); err != nil {
+		writeError(w, http.StatusForbidden, err)
+
+		return
+	}
+
+	stored := api.findUser(body.Name)
+	if stored == nil {
+		writeError(w, http.StatusNotFound, ErrUserNotFound)
+
+		return
+	}
+
+	if body.Name == claims.Subject && !stored.CheckPassword(body.Current) {
+		writeError(w, http.StatusForbidden, ErrPasswordIncorrect)
+
+		return
+	}
+
+	user := *stored
+	if err := user.SetPassword(body.Password); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	if err := api.store.as(claims.Subject).UpdateIf(&user, stored.Version); err != nil {
+		writeError(w, storeStatus(err), err)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Set the password hash of a user written through the API. Clients may not
+// send password hashes, as that would skip the password rules: the hash in
+// contents, the JSON encoding of the user, must be left out or be the one
+// stored for the user, which is then kept. If contents has a "password"
+// field, the password is checked and hashed instead.
+func (api *ResourceAPI) setUserPassword(res zebra.Resource, contents []byte) error {
+	user, ok := res.(*zebra.User)
+	if !ok {
+		return nil
+	}
+
+	object := struct {
+		Password *string `json:"password"`
+	}{Password: nil}
+
+	if err := json.Unmarshal(contents, &object); err != nil {
+		return err
+	}
+
+	hash := ""
+	if stored, ok := api.find(user.ID).(*zebra.User); ok {
+		hash = stored.PasswordHash
+	}
+
+	if user.PasswordHash != "" && user.PasswordHash != hash {
+		return ErrPasswordHashSet
+	}
+
+	user.PasswordHash = hash
+
+	if object.Password != nil {
+		return user.SetPassword(*object.Password)
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/api"
+	"github.com/project-safari/zebra/audit"
+	"github.com/project-safari/zebra/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserPasswords(t *testing.T) { // nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "userstore1"
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	factory := zebra.Factory().Add("User", func() zebra.Resource { return new(zebra.User) })
+
+	myAPI := api.NewResourceAPI(factory)
+	assert.Nil(myAPI.Initialize(root))
+
+	signer, err := auth.NewSigner([]byte("0123456789abcdef0123456789abcdef"), time.Hour)
+	assert.Nil(err)
+	myAPI.SetSigner(signer)
+
+	login := func(name string, password string) int {
+		return serve(myAPI.Login, http.MethodPost, api.LoginPath,
+			`{"name":"`+name+`","password":"`+password+`"}`).Code
+	}
+
+	patch := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/resources?id=0100000001", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		asAdmin(myAPI.PatchResource)(rec, req)
+
+		return rec
+	}
+
+	hashed := new(zebra.User)
+	assert.Nil(hashed.SetPassword("Riddikulus!42"))
+
+	shravya := `"id":"0100000001","type":"User","name":"shravya","role":"developer"`
+	hash := `"passwordHash":"` + hashed.PasswordHash + `"`
+
+	// Clients may not send password hashes, which would skip the rules.
+	rec := serve(myAPI.CreateResource, http.MethodPost, "/api/v1/resources",
+		`{`+shravya+`,`+hash+`}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	assert.Contains(rec.Body.String(), api.ErrPasswordHashSet.Error())
+
+	rec = serve(myAPI.ImportResources, http.MethodPost, "/api/v1/resources/import",
+		`{"User":[{`+shravya+`,`+hash+`}]}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = serve(myAPI.CreateResource, http.MethodPost, "/api/v1/resources",
+		`{`+shravya+`,"password":"short"}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	assert.Contains(rec.Body.String(), zebra.ErrPassLen.Error())
+
+	rec = serve(myAPI.CreateResource, http.MethodPost, "/api/v1/resources",
+		`{`+shravya+`,"password":"Riddikulus!42"}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+	assert.NotContains(rec.Body.String(), "Riddikulus!42")
+	assert.Equal(http.StatusOK, login("shravya", "Riddikulus!42"))
+
+	// Password hashes are never sent to clients.
+	assert.NotContains(rec.Body.String(), "passwordHash")
+
+	rec = serve(myAPI.GetResources, http.MethodGet, "/api/v1/resources", "")
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), "shravya")
+	assert.NotContains(rec.Body.String(), "passwordHash")
+
+	// Updates without a password keep the stored hash.
+	rec = serve(myAPI.UpdateResource, http.MethodPut, "/api/v1/resources",
+		`{`+shravya+`,"groups":["perf"]}`)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.NotContains(rec.Body.String(), "passwordHash")
+	assert.Equal(http.StatusOK, login("shravya", "Riddikulus!42"))
+
+	rec = serve(myAPI.UpdateResource, http.MethodPut, "/api/v1/resources",
+		`{`+shravya+`,`+hash+`}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = patch(`{` + hash + `}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = patch(`{"password":"Expecto!Patronum9"}`)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal(http.StatusUnauthorized, login("shravya", "Riddikulus!42"))
+	assert.Equal(http.StatusOK, login("shravya", "Expecto!Patronum9"))
+
+	// Users set their own passwords, and admins set anyone's.
+	rec = serve(myAPI.CreateResource, http.MethodPost, "/api/v1/resources",
+		`{"id":"0100000002","type":"User","name":"nandyala","role":"developer","password":"Riddikulus!42"}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	setPassword := as("shravya", auth.RoleDeveloper, myAPI.SetPassword)
+
+	// Users must give their current password.
+	rec = serve(setPassword, http.MethodPost, "/api/v1/users/password", `{"password":"Alohomora!Charm7"}`)
+	assert.Equal(http.StatusForbidden, rec.Code)
+	assert.Equal(api.ErrPasswordIncorrect.Error(), responseError(t, rec).Message)
+
+	rec = serve(setPassword, http.MethodPost, "/api/v1/users/password",
+		`{"current":"Riddikulus!42","password":"Alohomora!Charm7"}`)
+	assert.Equal(http.StatusForbidden, rec.Code)
+	assert.Equal(http.StatusOK, login("shravya", "Expecto!Patronum9"))
+
+	rec = serve(setPassword, http.MethodPost, "/api/v1/users/password",
+		`{"current":"Expecto!Patronum9","password":"Alohomora!Charm7"}`)
+	assert.Equal(http.StatusNoContent, rec.Code)
+	assert.Equal(http.StatusOK, login("shravya", "Alohomora!Charm7"))
+
+	rec = serve(setPassword, http.MethodPost, "/api/v1/users/password",
+		`{"current":"Alohomora!Charm7","password":"alohomora"}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	assert.Equal(http.StatusOK, login("shravya", "Alohomora!Charm7"))
+
+	rec = serve(setPassword, http.MethodPost, "/api/v1/users/password",
+		`{"name":"nandyala","password":"Alohomora!Charm7"}`)
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	rec = serve(myAPI.SetPassword, http.MethodPost, "/api/v1/users/password",
+		`{"name":"nandyala","password":"Alohomora!Charm7"}`)
+	assert.Equal(http.StatusNoContent, rec.Code)
+	assert.Equal(http.StatusOK, login("nandyala", "Alohomora!Charm7"))
+
+	rec = serve(myAPI.SetPassword, http.MethodPost, "/api/v1/users/password",
+		`{"name":"nobody","password":"Alohomora!Charm7"}`)
+	assert.Equal(http.StatusNotFound, rec.Code)
+
+	// Password changes are audited without the hashes.
+	rec = serve(myAPI.GetAudit, http.MethodGet, "/api/v1/audit?resource=0100000002", "")
+	assert.Equal(http.StatusOK, rec.Code)
+
+	records := []*audit.Record{}
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), &records))
+	assert.Len(records, 2)
+	assert.Equal(audit.ActionUpdate, records[1].Action)
+	assert.Contains(records[1].Changes, audit.Change{Path: "passwordHash", Before: zebra.Redacted, After: zebra.Redacted})
+
+	contents, err := os.ReadFile(path.Join(root, api.AuditFile))
+	assert.Nil(err)
+	assert.NotContains(string(contents), "pbkdf2")
+}
+
+func TestUserNames(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "userstore2"
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	factory := zebra.Factory().Add("User", func() zebra.Resource { return new(zebra.User) })
+
+	myAPI := api.NewResourceAPI(factory)
+	assert.Nil(myAPI.Initialize(root))
+
+	rec := serve(myAPI.CreateResource, http.MethodPost, "/api/v1/resources",
+		`{"id":"0100000001","type":"User","name":"shravya","role":"developer","password":"Riddikulus!42"}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	rec = serve(myAPI.CreateResource, http.MethodPost, "/api/v1/resources",
+		`{"id":"0100000002","type":"User","name":"nandyala","role":"developer","password":"Riddikulus!42"}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	// Users log in by name, so no two users may share one.
+	rec = serve(myAPI.CreateResource, http.MethodPost, "/api/v1/resources",
+		`{"id":"0100000003","type":"User","name":"shravya","role":"admin","password":"Riddikulus!42"}`)
+	assert.Equal(http.StatusConflict, rec.Code)
+	assert.Equal(api.ErrUserNameTaken.Error(), responseError(t, rec).Message)
+
+	rec = serve(myAPI.UpdateResource, http.MethodPut, "/api/v1/resources",
+		`{"id":"0100000002","type":"User","name":"shravya","role":"developer"}`)
+	assert.Equal(http.StatusConflict, rec.Code)
+
+	// A user keeps their own name.
+	rec = serve(myAPI.UpdateResource, http.MethodPut, "/api/v1/resources",
+		`{"id":"0100000001","type":"User","name":"shravya","role":"admin"}`)
+	assert.Equal(http.StatusOK, rec.Code)
+}
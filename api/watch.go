@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/watch"
+)
+
+// Events kept for watchers that resume from a past revision.
+const watchHistory = 1000
+
+// Longest time a watch stays silent. Idle watches are sent a comment this
+// often so that proxies do not close them.
+const keepAlive = 30 * time.Second
+
+var ErrStreamUnsupported = errors.New("response cannot be streamed")
+
+// Watch streams the changes made to resources, including leases, as
+// Server-Sent Events. Each event is named after its action, "create",
+// "update" or "delete", has its revision as its ID and holds the event as
+// JSON, with its secrets hidden. The "id", "type", "label" and
+// "property" query parameters select events as they select resources in
+// GetResources. The stream starts after the event whose ID is given in the
+// Last-Event-ID header or the "revision" query parameter, or with the next
+// change if neither is given; events too old to resume from, or from before
+// the server restarted, fail with 410.
+// If the client falls too far behind, an "error" event ends the stream.
+func (api *ResourceAPI) Watch(w http.ResponseWriter, req *http.Request) {
+	claims := authenticated(w, req)
+	if claims == nil {
+		return
+	}
+
+	filter, err := resourceFilter(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	if err := claims.Authorize(auth.VerbRead, filter.Types...); err != nil {
+		writeError(w, http.StatusForbidden, err)
+
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, ErrStreamUnsupported)
+
+		return
+	}
+
+	after, err := api.watchRevision(req)
+	if err != nil {
+		writeError(w, revisionStatus(err), badParam("revision", err))
+
+		return
+	}
+
+	watcher, err := api.events.Watch(after, func(e watch.Event) bool {
+		return auth.Allowed(claims.Role, auth.VerbRead, e.Type) && filter.Match(e.Resource)
+	})
+	if err != nil {
+		writeError(w, revisionStatus(err), badParam("revision", err))
+
+		return
+	}
+
+	defer watcher.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		ctx, cancel := context.WithTimeout(req.Context(), keepAlive)
+		e, err := watcher.Next(ctx)
+
+		cancel()
+
+		switch {
+		case err == nil:
+			api.writeEvent(w, e)
+		case req.Context().Err() != nil:
+			return
+		case errors.Is(err, context.DeadlineExceeded):
+			fmt.Fprint(w, ": keep-alive\n\n")
+		default:
+			data, _ := zebra.MarshalRedacted(errorResponse{Error: newError(http.StatusServiceUnavailable, err)})
+			fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+			flusher.Flush()
+
+			return
+		}
+
+		flusher.Flush()
+	}
+}
+
+// Return the revision that the watch request resumes from: that of the event
+// ID in its Last-Event-ID header or "revision" parameter, or the latest one.
+func (api *ResourceAPI) watchRevision(req *http.Request) (uint64, error) {
+	value := req.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = req.URL.Query().Get("revision")
+	}
+
+	if value == "" {
+		return api.events.Revision(), nil
+	}
+
+	return api.events.ParseEventID(value)
+}
+
+// Write the event in the Server-Sent Events format.
+func (api *ResourceAPI) writeEvent(w http.ResponseWriter, e watch.Event) {
+	data, err := zebra.MarshalRedacted(e)
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", api.events.EventID(e.Revision), e.Action, data)
+}
+
+// Return the HTTP status code for an error returned by watch.Hub.Watch or
+// watch.Hub.ParseEventID.
+func revisionStatus(err error) int {
+	if errors.Is(err, watch.ErrRevisionExpired) || errors.Is(err, watch.ErrEpochChanged) {
+		return http.StatusGone
+	}
+
+	return http.StatusBadRequest
+}
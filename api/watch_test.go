@@ -0,0 +1,202 @@
+package api_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/lease"
+	"github.com/stretchr/testify/assert"
+)
+
+// A Server-Sent Event as read by a test.
+type sentEvent struct {
+	ID    string
+	Event string
+	Data  map[string]interface{}
+}
+
+// Return the next event, skipping comments, or fail after a second.
+func nextEvent(t *testing.T, events chan sentEvent) sentEvent {
+	t.Helper()
+
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+
+	return sentEvent{}
+}
+
+// Open a watch and return a channel of its events.
+func openWatch(t *testing.T, server *httptest.Server, query string, lastEventID string) chan sentEvent {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"?"+query, nil)
+	assert.Nil(t, err)
+
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := make(chan sentEvent)
+
+	go func() {
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		e := sentEvent{ID: "", Event: "", Data: nil}
+
+		for scanner.Scan() {
+			line := scanner.Text()
+
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				e.ID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				e.Event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				_ = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e.Data)
+			case line == "" && e.Event != "":
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+
+				e = sentEvent{ID: "", Event: "", Data: nil}
+			}
+		}
+	}()
+
+	return events
+}
+
+func TestWatch(t *testing.T) { // nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	myAPI := newLeaseAPI(t, "watchstore1", map[string]zebra.Labels{"0100000001": {"pool": "perf"}})
+
+	server := httptest.NewServer(asAdmin(myAPI.Watch))
+	t.Cleanup(server.Close)
+
+	all := openWatch(t, server, "", "")
+	perf := openWatch(t, server, "label="+url.QueryEscape("pool = perf"), "")
+	leases := openWatch(t, server, "type="+lease.Type, "")
+
+	rec := serve(myAPI.CreateResource, http.MethodPost, "/api/v1/resources",
+		`{"id":"0100000002","type":"VLANPool","labels":{"pool":"gpu"},"rangeEnd":10}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	rec = serve(myAPI.UpdateResource, http.MethodPut, "/api/v1/resources",
+		`{"id":"0100000001","type":"VLANPool","labels":{"pool":"perf"},"rangeEnd":20}`)
+	assert.Equal(http.StatusOK, rec.Code)
+
+	l := lease.NewLease("shravya", []string{"0100000001"}, time.Hour)
+	assert.Nil(myAPI.Leases().Acquire(context.Background(), l))
+
+	// Event IDs name the epoch of the server along with the revision.
+	e := nextEvent(t, all)
+	epoch := strings.TrimSuffix(e.ID, "-1")
+	assert.NotEmpty(epoch)
+	assert.Equal(epoch+"-1", e.ID)
+	assert.Equal("create", e.Event)
+	assert.Equal("0100000002", e.Data["id"])
+	assert.Equal("VLANPool", e.Data["type"])
+	assert.Equal("gpu", e.Data["resource"].(map[string]interface{})["labels"].(map[string]interface{})["pool"])
+
+	e = nextEvent(t, all)
+	assert.Equal(epoch+"-2", e.ID)
+	assert.Equal("update", e.Event)
+
+	e = nextEvent(t, all)
+	assert.Equal(epoch+"-3", e.ID)
+	assert.Equal(lease.Type, e.Data["type"])
+
+	e = nextEvent(t, perf)
+	assert.Equal(epoch+"-2", e.ID)
+	assert.Equal("0100000001", e.Data["id"])
+
+	e = nextEvent(t, leases)
+	assert.Equal(epoch+"-3", e.ID)
+	assert.Equal("create", e.Event)
+	assert.Equal(l.ID, e.Data["id"])
+
+	// Watches resume after the last event seen.
+	resumed := openWatch(t, server, "revision="+epoch+"-0", epoch+"-1")
+	assert.Equal(epoch+"-2", nextEvent(t, resumed).ID)
+	assert.Equal(epoch+"-3", nextEvent(t, resumed).ID)
+
+	rec = serve(myAPI.DeleteResource, http.MethodDelete, "/api/v1/resources?id=0100000002", "")
+	assert.Equal(http.StatusNoContent, rec.Code)
+
+	e = nextEvent(t, resumed)
+	assert.Equal(epoch+"-4", e.ID)
+	assert.Equal("delete", e.Event)
+	assert.Equal("0100000002", e.Data["id"])
+
+	// Watches cannot resume from before the server restarted.
+	rec = serve(myAPI.Watch, http.MethodGet, "/api/v1/watch?revision=earlier-1", "")
+	assert.Equal(http.StatusGone, rec.Code)
+
+	// Bad requests fail before the stream starts.
+	for _, query := range []string{"revision=" + epoch + "-10", "revision=first", "revision=1", "label=pool+%3D"} {
+		rec = serve(myAPI.Watch, http.MethodGet, "/api/v1/watch?"+query, "")
+		assert.Equal(http.StatusBadRequest, rec.Code, query)
+		assert.Equal("invalid_request", responseError(t, rec).Code, query)
+	}
+
+	rec = serve(as("shravya", auth.RoleDeveloper, myAPI.Watch), http.MethodGet, "/api/v1/watch?type=User", "")
+	assert.Equal(http.StatusForbidden, rec.Code)
+}
+
+func TestWatchOrder(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	myAPI := newLeaseAPI(t, "watchstore2", map[string]zebra.Labels{"0100000001": nil})
+
+	server := httptest.NewServer(asAdmin(myAPI.Watch))
+	t.Cleanup(server.Close)
+
+	events := openWatch(t, server, "id=0100000001", "")
+
+	// Revisions follow the order of the writes, whatever order the writers
+	// publish in.
+	writers := 10
+	for i := 0; i < writers; i++ {
+		go func(end int) {
+			serve(myAPI.UpdateResource, http.MethodPut, "/api/v1/resources",
+				fmt.Sprintf(`{"id":"0100000001","type":"VLANPool","rangeEnd":%d}`, end))
+		}(10 + i)
+	}
+
+	last := 1.0
+
+	for i := 0; i < writers; i++ {
+		version, _ := nextEvent(t, events).Data["resource"].(map[string]interface{})["version"].(float64)
+		assert.Equal(last+1, version)
+
+		last = version
+	}
+}
@@ -0,0 +1,72 @@
+package api_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/api"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhooks(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "webhookstore1"
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	factory := leaseFactory().
+		Add(webhook.Type, func() zebra.Resource { return new(webhook.Webhook) }).
+		Add(webhook.DeadLetterType, func() zebra.Resource { return new(webhook.DeadLetter) })
+
+	myAPI := api.NewResourceAPI(factory)
+	assert.Nil(myAPI.Initialize(root))
+
+	signatures := make(chan bool, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		timestamp, _ := strconv.ParseInt(req.Header.Get(webhook.TimestampHeader), 10, 64)
+		signatures <- req.Header.Get(webhook.SignatureHeader) == webhook.Sign("s3cr3t", timestamp, body)
+	}))
+	t.Cleanup(receiver.Close)
+
+	hook := `{"id":"0300000001","type":"Webhook","url":"` + receiver.URL + `","actions":["lease"],` +
+		`"types":["VLANPool"],"Keys":{"secret":"s3cr3t"}}`
+
+	// Only admins may subscribe webhooks, and their secrets are never shown.
+	rec := serve(as("shravya", auth.RoleDeveloper, myAPI.CreateResource), http.MethodPost, "/api/v1/resources", hook)
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	rec = serve(myAPI.CreateResource, http.MethodPost, "/api/v1/resources", hook)
+	assert.Equal(http.StatusCreated, rec.Code)
+	assert.Contains(rec.Body.String(), `"secret":"********"`)
+	assert.NotContains(rec.Body.String(), "s3cr3t")
+
+	rec = serve(myAPI.CreateResource, http.MethodPost, "/api/v1/resources",
+		`{"id":"0100000001","type":"VLANPool","labels":{"pool":"perf"},"rangeEnd":10}`)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	go myAPI.Webhooks().Run(ctx)
+
+	assert.Nil(myAPI.Leases().Acquire(ctx, lease.NewLease("shravya", []string{"0100000001"}, time.Hour)))
+
+	select {
+	case signed := <-signatures:
+		assert.True(signed)
+	case <-time.After(time.Second):
+		t.Fatal("no delivery")
+	}
+}
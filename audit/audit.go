@@ -0,0 +1,172 @@
+// Package audit keeps an append-only log of the changes made to resources and
+// leases, recording who made each change, when, and what it changed.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// Type is the resource type that permission to read the audit log is granted
+// on.
+const Type = "Audit"
+
+// System is the user that changes not made on behalf of a user, such as the
+// release of expired leases, are recorded for.
+const System = "zebra"
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Longest record that Query reads, in bytes.
+const maxRecordLen = 16 << 20
+
+var ErrLogClosed = errors.New("audit log is closed")
+
+// A Record describes one change to a resource. Records of changes to leases
+// also list the IDs of the resources that the lease holds.
+type Record struct {
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	Action    string    `json:"action"`
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Resources []string  `json:"resources,omitempty"`
+	Changes   []Change  `json:"changes,omitempty"`
+}
+
+// A Filter selects records. Empty fields select all records.
+type Filter struct {
+	User  string
+	ID    string
+	Type  string
+	Since time.Time
+	Until time.Time
+}
+
+// Match returns true if the filter selects the record. ID selects the records
+// of the resource with the ID and those of leases that hold it. Since is
+// inclusive and Until exclusive.
+func (f Filter) Match(r *Record) bool {
+	switch {
+	case f.User != "" && r.User != f.User:
+		return false
+	case f.ID != "" && r.ID != f.ID && !contains(r.Resources, f.ID):
+		return false
+	case f.Type != "" && r.Type != f.Type:
+		return false
+	case !f.Since.IsZero() && r.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !r.Time.Before(f.Until):
+		return false
+	}
+
+	return true
+}
+
+// Return true if id is one of ids.
+func contains(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Log is an append-only log of records, stored as one JSON object per line.
+type Log struct {
+	lock sync.Mutex
+	path string
+	file *os.File
+}
+
+// Open returns the log stored in the file at the given path, creating the
+// file if it does not exist.
+func Open(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600) //nolint:gomnd
+	if err != nil {
+		return nil, err
+	}
+
+	return &Log{lock: sync.Mutex{}, path: path, file: file}, nil
+}
+
+// Append adds the record to the end of the log, setting its time to now if
+// it has none. Return once the record is on disk.
+func (l *Log) Append(r Record) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.file == nil {
+		return ErrLogClosed
+	}
+
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	return l.file.Sync()
+}
+
+// Query returns the records selected by the filter, oldest first.
+func (l *Log) Query(f Filter) ([]*Record, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records := []*Record{}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, maxRecordLen)
+
+	for scanner.Scan() {
+		r := new(Record)
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			return nil, err
+		}
+
+		if f.Match(r) {
+			records = append(records, r)
+		}
+	}
+
+	return records, scanner.Err()
+}
+
+// Close closes the log file. Records can no longer be appended afterwards.
+func (l *Log) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+
+	return err
+}
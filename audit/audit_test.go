@@ -0,0 +1,153 @@
+package audit_test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/audit"
+	"github.com/project-safari/zebra/network"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLog(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	path := "testaudit1.jsonl"
+	t.Cleanup(func() { os.Remove(path) })
+
+	log, err := audit.Open(path)
+	assert.Nil(err)
+
+	start := time.Date(2022, time.March, 1, 9, 0, 0, 0, time.UTC)
+	records := []audit.Record{
+		{
+			Time: start, User: "shravya", Action: audit.ActionCreate,
+			ID: "0100000001", Type: "VLANPool", Changes: nil,
+		},
+		{
+			Time: start.Add(time.Hour), User: "nandyala", Action: audit.ActionUpdate,
+			ID: "0100000001", Type: "VLANPool", Changes: nil,
+		},
+		{
+			Time: start.Add(2 * time.Hour), User: "shravya", Action: audit.ActionDelete,
+			ID: "0100000002", Type: "VM", Changes: nil,
+		},
+	}
+
+	for _, r := range records {
+		assert.Nil(log.Append(r))
+	}
+
+	// Records survive reopening the log and are appended to.
+	assert.Nil(log.Close())
+	assert.Equal(audit.ErrLogClosed, log.Append(records[0]))
+
+	log, err = audit.Open(path)
+	assert.Nil(err)
+	assert.Nil(log.Append(audit.Record{User: "genie", Action: audit.ActionCreate, ID: "0100000003", Type: "VM"}))
+
+	all, err := log.Query(audit.Filter{})
+	assert.Nil(err)
+	assert.Len(all, 4)
+	assert.Equal("0100000003", all[3].ID)
+	assert.False(all[3].Time.IsZero())
+
+	byUser, err := log.Query(audit.Filter{User: "shravya"})
+	assert.Nil(err)
+	assert.Len(byUser, 2)
+
+	byID, err := log.Query(audit.Filter{ID: "0100000001", Type: "VLANPool"})
+	assert.Nil(err)
+	assert.Len(byID, 2)
+
+	byTime, err := log.Query(audit.Filter{Since: start.Add(time.Hour), Until: start.Add(2 * time.Hour)})
+	assert.Nil(err)
+	assert.Len(byTime, 1)
+	assert.Equal("nandyala", byTime[0].User)
+
+	assert.Nil(log.Close())
+	assert.Nil(log.Close())
+
+	info, err := os.Stat(path)
+	assert.Nil(err)
+	assert.Equal(os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	before := new(network.VLANPool)
+	before.ID = "0100000001"
+	before.Type = "VLANPool"
+	before.Labels = zebra.Labels{"owner": "shravya"}
+	before.RangeEnd = 10
+
+	after := new(network.VLANPool)
+	after.ID = "0100000001"
+	after.Type = "VLANPool"
+	after.Labels = zebra.Labels{"team": "perf"}
+	after.RangeEnd = 20
+
+	changes, err := audit.Diff(before, after)
+	assert.Nil(err)
+	assert.Equal([]audit.Change{
+		{Path: "labels.owner", Before: "shravya", After: nil},
+		{Path: "labels.team", Before: nil, After: "perf"},
+		{Path: "rangeEnd", Before: json.Number("10"), After: json.Number("20")},
+	}, changes)
+
+	changes, err = audit.Diff(nil, after)
+	assert.Nil(err)
+	assert.Len(changes, 5)
+
+	var none *network.VLANPool
+
+	changes, err = audit.Diff(before, none)
+	assert.Nil(err)
+	assert.Len(changes, 5)
+
+	changes, err = audit.Diff(before, before)
+	assert.Nil(err)
+	assert.Empty(changes)
+
+	// Credential keys are redacted.
+	creds := new(zebra.Credentials)
+	creds.ID = "0100000002"
+	creds.Type = "Credentials"
+	creds.Name = "root"
+	creds.Keys = map[string]string{"password": "properPass123$"}
+
+	rotated := new(zebra.Credentials)
+	*rotated = *creds
+	rotated.Keys = map[string]string{"password": "otherPass456$"}
+
+	changes, err = audit.Diff(creds, rotated)
+	assert.Nil(err)
+	assert.Equal([]audit.Change{{Path: "Keys.password", Before: zebra.Redacted, After: zebra.Redacted}}, changes)
+
+	changes, err = audit.Diff(creds, nil)
+	assert.Nil(err)
+	assert.Contains(changes, audit.Change{Path: "Keys.password", Before: zebra.Redacted, After: nil})
+	assert.Contains(changes, audit.Change{Path: "name", Before: "root", After: nil})
+
+	// So are password hashes.
+	user := new(zebra.User)
+	user.ID = "0100000003"
+	user.Type = "User"
+	user.Name = "shravya"
+	user.Role = "developer"
+	assert.Nil(user.SetPassword("Riddikulus!42"))
+
+	changed := new(zebra.User)
+	*changed = *user
+	assert.Nil(changed.SetPassword("Expecto!Patronum9"))
+
+	changes, err = audit.Diff(user, changed)
+	assert.Nil(err)
+	assert.Equal([]audit.Change{{Path: "passwordHash", Before: zebra.Redacted, After: zebra.Redacted}}, changes)
+}
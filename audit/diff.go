@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/project-safari/zebra"
+)
+
+// A Change is a value of a resource that was added, changed or removed. Path
+// names the value by the JSON field names leading to it, separated by dots,
+// with list indices as field names.
+type Change struct {
+	Path   string      `json:"path"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// A value in a flattened resource, and whether it is a secret.
+type leaf struct {
+	value  interface{}
+	secret bool
+}
+
+// Diff returns the changes between two versions of a resource, sorted by
+// path. Before is nil for a created resource and after is nil for a deleted
+// one. Secrets, the values of credential keys and password hashes, are
+// redacted, so the changes only show whether they were set, changed or
+// removed.
+func Diff(before zebra.Resource, after zebra.Resource) ([]Change, error) {
+	old, err := flatten(before)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := flatten(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []Change{}
+
+	for path, o := range old {
+		u, ok := updated[path]
+
+		switch {
+		case !ok:
+			changes = append(changes, Change{Path: path, Before: o.show(), After: nil})
+		case !reflect.DeepEqual(o.value, u.value):
+			changes = append(changes, Change{Path: path, Before: o.show(), After: u.show()})
+		}
+	}
+
+	for path, u := range updated {
+		if _, ok := old[path]; !ok {
+			changes = append(changes, Change{Path: path, Before: nil, After: u.show()})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	return changes, nil
+}
+
+// Return the value to record for the leaf.
+func (l leaf) show() interface{} {
+	if l.secret {
+		return zebra.Redacted
+	}
+
+	return l.value
+}
+
+// Return the values of the JSON encoded resource by their paths.
+func flatten(res zebra.Resource) (map[string]leaf, error) {
+	leaves := map[string]leaf{}
+
+	if res == nil || reflect.ValueOf(res).IsNil() {
+		return leaves, nil
+	}
+
+	contents, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	decoder.UseNumber()
+
+	var object interface{}
+	if err := decoder.Decode(&object); err != nil {
+		return nil, err
+	}
+
+	walk("", object, false, leaves)
+
+	return leaves, nil
+}
+
+// Add the leaves of the decoded JSON value at the given path to leaves. All
+// values within fields that zebra.IsSecret names are secret.
+func walk(path string, value interface{}, secret bool, leaves map[string]leaf) {
+	join := func(name string) string {
+		if path == "" {
+			return name
+		}
+
+		return path + "." + name
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for name, field := range value {
+			walk(join(name), field, secret || zebra.IsSecret(name), leaves)
+		}
+	case []interface{}:
+		for i, item := range value {
+			walk(join(strconv.Itoa(i)), item, secret, leaves)
+		}
+	case nil:
+	default:
+		leaves[path] = leaf{value: value, secret: secret}
+	}
+}
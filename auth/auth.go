@@ -0,0 +1,232 @@
+// Package auth provides signed, expiring bearer tokens that authenticate
+// zebra users to the HTTP API.
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/project-safari/zebra"
+)
+
+// Shortest HMAC key accepted, in bytes.
+const minKeyLen = 32
+
+// Token lifetime used when none is configured.
+const defaultTTL = 12 * time.Hour
+
+// Length of the stamp tokens carry, in bytes.
+const stampLen = 16
+
+var ErrKeyShort = errors.New("token signing key must be at least 32 bytes long")
+
+var ErrKeyMissing = errors.New("token signing key is not configured")
+
+var ErrKeyExample = errors.New("token signing key is the published example key")
+
+var ErrTokenInvalid = errors.New("token is malformed or its signature does not match")
+
+var ErrTokenExpired = errors.New("token has expired")
+
+var ErrTokenScope = errors.New("token is not valid for this request")
+
+var ErrTokenRevoked = errors.New("token was revoked")
+
+// ScopeCalendar is the scope of tokens that may only read the lease calendar,
+// which calendar clients send in the URL as they cannot send headers.
+const ScopeCalendar = "calendar"
+
+// A signing key that was once published in the example configuration, and
+// so can be used by anyone to forge tokens.
+const exampleKey = "development-only-key-replace-in-production"
+
+// The only header we issue and accept, as in RFC 7519 with HS256.
+const tokenHeader = `{"alg":"HS256","typ":"JWT"}`
+
+// Config holds the token settings read from the server configuration. Key
+// is the HMAC key tokens are signed with, and TTL how long a token is valid,
+// such as "12h".
+type Config struct {
+	Key string `json:"key"`
+	TTL string `json:"ttl"`
+}
+
+// Claims identify the user a token was issued to. Tokens with a scope may
+// only be used for the requests it names, and those without for any request.
+// The stamp ties the token to the user's password, as described in Check.
+type Claims struct {
+	Subject  string   `json:"sub"`
+	Role     string   `json:"role"`
+	Groups   []string `json:"groups,omitempty"`
+	Scope    string   `json:"scope,omitempty"`
+	Stamp    string   `json:"stamp"`
+	IssuedAt int64    `json:"iat"`
+	Expires  int64    `json:"exp"`
+}
+
+// Signer issues and verifies tokens signed with an HMAC-SHA256 key.
+type Signer struct {
+	key []byte
+	ttl time.Duration
+}
+
+// Return new Signer pointer for the given key and token lifetime.
+func NewSigner(key []byte, ttl time.Duration) (*Signer, error) {
+	if len(key) < minKeyLen {
+		return nil, ErrKeyShort
+	}
+
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+
+	return &Signer{key: key, ttl: ttl}, nil
+}
+
+// NewSignerFromConfig returns a Signer for the key and lifetime in cfg. If no
+// lifetime is set, tokens are valid for 12 hours. The key must be set, and
+// must not be the key once published as an example.
+func NewSignerFromConfig(cfg Config) (*Signer, error) {
+	switch cfg.Key {
+	case "":
+		return nil, ErrKeyMissing
+	case exampleKey:
+		return nil, ErrKeyExample
+	}
+
+	ttl := time.Duration(0)
+
+	if cfg.TTL != "" {
+		d, err := time.ParseDuration(cfg.TTL)
+		if err != nil {
+			return nil, err
+		}
+
+		ttl = d
+	}
+
+	return NewSigner([]byte(cfg.Key), ttl)
+}
+
+// Issue returns a new token for the user and the claims it carries.
+func (s *Signer) Issue(user *zebra.User) (string, *Claims, error) {
+	return s.IssueScoped(user, "", s.ttl)
+}
+
+// IssueScoped returns a new token for the user that is limited to the given
+// scope and valid for ttl, and the claims it carries.
+func (s *Signer) IssueScoped(user *zebra.User, scope string, ttl time.Duration) (string, *Claims, error) {
+	now := time.Now()
+	claims := &Claims{
+		Subject:  user.Name,
+		Role:     user.Role,
+		Groups:   user.Groups,
+		Scope:    scope,
+		Stamp:    s.stamp(user),
+		IssuedAt: now.Unix(),
+		Expires:  now.Add(ttl).Unix(),
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", nil, err
+	}
+
+	unsigned := encode([]byte(tokenHeader)) + "." + encode(payload)
+
+	return unsigned + "." + encode(s.sign(unsigned)), claims, nil
+}
+
+// Verify checks the token's signature and expiry and returns its claims.
+func (s *Signer) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 { //nolint:gomnd
+		return nil, ErrTokenInvalid
+	}
+
+	sig, err := decode(parts[2])
+	if err != nil || !hmac.Equal(sig, s.sign(parts[0]+"."+parts[1])) {
+		return nil, ErrTokenInvalid
+	}
+
+	header, err := decode(parts[0])
+	if err != nil || string(header) != tokenHeader {
+		return nil, ErrTokenInvalid
+	}
+
+	payload, err := decode(parts[1])
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+
+	claims := new(Claims)
+	if err := json.Unmarshal(payload, claims); err != nil || claims.Subject == "" {
+		return nil, ErrTokenInvalid
+	}
+
+	if time.Now().Unix() >= claims.Expires {
+		return nil, ErrTokenExpired
+	}
+
+	return claims, nil
+}
+
+// Check returns ErrTokenRevoked if the user that the claims, verified by
+// Verify, were issued to is nil, as it no longer exists, or has changed their
+// password since. Otherwise the role and groups in the claims are replaced
+// with the user's, so that changes to them take effect at once rather than
+// when the token expires.
+func (s *Signer) Check(claims *Claims, user *zebra.User) error {
+	if user == nil || !hmac.Equal([]byte(claims.Stamp), []byte(s.stamp(user))) {
+		return ErrTokenRevoked
+	}
+
+	claims.Role = user.Role
+	claims.Groups = user.Groups
+
+	return nil
+}
+
+// Return the stamp of the user, which changes whenever their password hash
+// does. It is derived from the hash with the key, so that tokens reveal
+// nothing about the hash.
+func (s *Signer) stamp(user *zebra.User) string {
+	return encode(s.sign("stamp." + user.PasswordHash)[:stampLen])
+}
+
+func (s *Signer) sign(unsigned string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(unsigned))
+
+	return mac.Sum(nil)
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decode(data string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(data)
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the claims of an authenticated
+// request.
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// FromContext returns the claims carried by ctx, or nil if the request was
+// not authenticated.
+func FromContext(ctx context.Context) *Claims {
+	claims, _ := ctx.Value(contextKey{}).(*Claims)
+
+	return claims
+}
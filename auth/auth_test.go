@@ -0,0 +1,172 @@
+package auth_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+const testKey = "0123456789abcdef0123456789abcdef"
+
+func TestSigner(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	signer, err := auth.NewSigner([]byte("short"), time.Hour)
+	assert.Nil(signer)
+	assert.Equal(auth.ErrKeyShort, err)
+
+	signer, err = auth.NewSigner([]byte(testKey), time.Hour)
+	assert.Nil(err)
+
+	user := new(zebra.User)
+	user.Name = "shravya"
+	user.Role = "developer"
+	user.Groups = []string{"safari"}
+
+	token, claims, err := signer.Issue(user)
+	assert.Nil(err)
+	assert.Equal("shravya", claims.Subject)
+	assert.Equal(3, len(strings.Split(token, ".")))
+
+	verified, err := signer.Verify(token)
+	assert.Nil(err)
+	assert.Equal(claims, verified)
+
+	// Tampered signature, payload or wrong key.
+	_, err = signer.Verify(token[:len(token)-2] + "AA")
+	assert.Equal(auth.ErrTokenInvalid, err)
+
+	parts := strings.Split(token, ".")
+	_, err = signer.Verify(parts[0] + ".e30." + parts[2])
+	assert.Equal(auth.ErrTokenInvalid, err)
+
+	_, err = signer.Verify("not-a-token")
+	assert.Equal(auth.ErrTokenInvalid, err)
+
+	token, claims, err = signer.IssueScoped(user, auth.ScopeCalendar, 24*time.Hour)
+	assert.Nil(err)
+	assert.Equal(int64(24*60*60), claims.Expires-claims.IssuedAt)
+
+	verified, err = signer.Verify(token)
+	assert.Nil(err)
+	assert.Equal(auth.ScopeCalendar, verified.Scope)
+
+	other, err := auth.NewSigner([]byte(testKey+"!"), time.Hour)
+	assert.Nil(err)
+
+	_, err = other.Verify(token)
+	assert.Equal(auth.ErrTokenInvalid, err)
+
+	// Expired.
+	expiring, err := auth.NewSigner([]byte(testKey), time.Nanosecond)
+	assert.Nil(err)
+
+	token, _, err = expiring.Issue(user)
+	assert.Nil(err)
+
+	time.Sleep(time.Second)
+
+	_, err = expiring.Verify(token)
+	assert.Equal(auth.ErrTokenExpired, err)
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	signer, err := auth.NewSigner([]byte(testKey), time.Hour)
+	assert.Nil(err)
+
+	user := new(zebra.User)
+	user.Name = "shravya"
+	user.Role = "developer"
+	assert.Nil(user.SetPassword("Riddikulus!42"))
+
+	_, claims, err := signer.Issue(user)
+	assert.Nil(err)
+	assert.Nil(signer.Check(claims, user))
+
+	// Role and group changes apply to the claims.
+	changed := *user
+	changed.Role = "read-only"
+	changed.Groups = []string{"safari"}
+	assert.Nil(signer.Check(claims, &changed))
+	assert.Equal("read-only", claims.Role)
+	assert.Equal([]string{"safari"}, claims.Groups)
+
+	// Password changes and deletion revoke the token.
+	assert.Nil(changed.SetPassword("Expecto!Patronum9"))
+	assert.Equal(auth.ErrTokenRevoked, signer.Check(claims, &changed))
+	assert.Equal(auth.ErrTokenRevoked, signer.Check(claims, nil))
+}
+
+func TestSignerFromConfig(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	_, err := auth.NewSignerFromConfig(auth.Config{Key: testKey, TTL: "soon"})
+	assert.NotNil(err)
+
+	_, err = auth.NewSignerFromConfig(auth.Config{Key: "", TTL: "1h"})
+	assert.Equal(auth.ErrKeyMissing, err)
+
+	_, err = auth.NewSignerFromConfig(auth.Config{Key: "development-only-key-replace-in-production", TTL: "1h"})
+	assert.Equal(auth.ErrKeyExample, err)
+
+	_, err = auth.NewSignerFromConfig(auth.Config{Key: "short", TTL: "1h"})
+	assert.Equal(auth.ErrKeyShort, err)
+
+	signer, err := auth.NewSignerFromConfig(auth.Config{Key: testKey, TTL: ""})
+	assert.Nil(err)
+
+	user := new(zebra.User)
+	user.Name = "nandyala"
+
+	_, claims, err := signer.Issue(user)
+	assert.Nil(err)
+	assert.Equal(int64(12*60*60), claims.Expires-claims.IssuedAt)
+}
+
+func TestContext(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	assert.Nil(auth.FromContext(ctx))
+
+	claims := &auth.Claims{Subject: "shravya", Role: "admin"}
+	assert.Equal(claims, auth.FromContext(auth.NewContext(ctx, claims)))
+}
+
+func TestRoles(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	assert.True(auth.Allowed(auth.RoleAdmin, auth.VerbCreate, "Datacenter"))
+	assert.True(auth.Allowed(auth.RoleAdmin, auth.VerbRead, "Credentials"))
+	assert.True(auth.Allowed(auth.RoleDeveloper, auth.VerbLease, "VM"))
+	assert.True(auth.Allowed(auth.RoleDeveloper, auth.VerbRead, "Switch"))
+	assert.False(auth.Allowed(auth.RoleDeveloper, auth.VerbCreate, "Datacenter"))
+	assert.False(auth.Allowed(auth.RoleDeveloper, auth.VerbDelete, "Switch"))
+	assert.False(auth.Allowed(auth.RoleDeveloper, auth.VerbRead, "Credentials"))
+	assert.True(auth.Allowed(auth.RoleAdmin, auth.VerbCreate, "Webhook"))
+	assert.False(auth.Allowed(auth.RoleAdmin, auth.VerbUpdate, "DeadLetter"))
+	assert.False(auth.Allowed(auth.RoleDeveloper, auth.VerbRead, "Webhook"))
+	assert.True(auth.Allowed(auth.RoleClient, auth.VerbLease, "VM"))
+	assert.False(auth.Allowed(auth.RoleClient, auth.VerbLease, "Server"))
+	assert.False(auth.Allowed(auth.RoleClient, auth.VerbReveal, "VM"))
+	assert.True(auth.Allowed(auth.RoleClient, auth.VerbRevealLeased, "VM"))
+	assert.False(auth.Allowed(auth.RoleDeveloper, auth.VerbReveal, "Switch"))
+	assert.False(auth.Allowed(auth.RoleReadOnly, auth.VerbLease, "VM"))
+	assert.False(auth.Allowed("intern", auth.VerbRead, "VM"))
+
+	claims := &auth.Claims{Subject: "shravya", Role: auth.RoleDeveloper}
+	assert.Nil(claims.Authorize(auth.VerbLease, "VM", "Server"))
+	assert.Equal(auth.ErrForbidden, claims.Authorize(auth.VerbLease, "VM", "Datacenter"))
+}
@@ -0,0 +1,96 @@
+package auth
+
+import "errors"
+
+// A Verb is an action a role may be permitted to take on a resource type.
+// VerbRevealLeased permits revealing credentials only of the resources that
+// the user holds with a lease, while VerbReveal permits revealing any.
+type Verb string
+
+const (
+	VerbRead   Verb = "read"
+	VerbCreate Verb = "create"
+	VerbUpdate Verb = "update"
+	VerbDelete Verb = "delete"
+	VerbLease  Verb = "lease"
+	VerbReveal Verb = "reveal"
+
+	VerbRevealLeased Verb = "reveal-leased"
+)
+
+const (
+	RoleAdmin     = "admin"
+	RoleDeveloper = "developer"
+	RoleClient    = "client"
+	RoleReadOnly  = "read-only"
+)
+
+// AnyType stands for every resource type except the restricted ones, which
+// hold secrets and must be granted by name.
+const AnyType = "*"
+
+var ErrForbidden = errors.New("role does not permit this action")
+
+// Resource types that AnyType does not cover.
+var restricted = map[string]bool{ //nolint:gochecknoglobals
+	"Audit":       true,
+	"Credentials": true,
+	"DeadLetter":  true,
+	"User":        true,
+	"Webhook":     true,
+}
+
+// A Role maps each verb it permits to the resource types it permits it on.
+type Role map[Verb][]string
+
+// Permissions of the known roles. Users with any other role may do nothing.
+var roles = map[string]Role{ //nolint:gochecknoglobals
+	RoleAdmin: {
+		VerbRead:   {AnyType, "Audit", "Credentials", "DeadLetter", "User", "Webhook"},
+		VerbCreate: {AnyType, "Credentials", "User", "Webhook"},
+		VerbUpdate: {AnyType, "Credentials", "User", "Webhook"},
+		VerbDelete: {AnyType, "Credentials", "DeadLetter", "User", "Webhook"},
+		VerbLease:  {AnyType},
+		VerbReveal: {AnyType, "Credentials"},
+	},
+	RoleDeveloper: {
+		VerbRead:         {AnyType},
+		VerbCreate:       {"VM"},
+		VerbUpdate:       {"VM"},
+		VerbDelete:       {"VM"},
+		VerbLease:        {"Server", "ESX", "VCenter", "VM", "Switch", "IPAddressPool", "VLANPool"},
+		VerbRevealLeased: {"Server", "ESX", "VCenter", "VM", "Switch"},
+	},
+	RoleClient: {
+		VerbRead:         {AnyType},
+		VerbLease:        {"VM"},
+		VerbRevealLeased: {"VM"},
+	},
+	RoleReadOnly: {
+		VerbRead: {AnyType},
+	},
+}
+
+// Allowed returns true if the role permits verb on resources of the given
+// type.
+func Allowed(role string, verb Verb, resType string) bool {
+	for _, t := range roles[role][verb] {
+		if t == resType || (t == AnyType && !restricted[resType]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authorize returns ErrForbidden unless the role in claims permits verb on
+// every one of the given types.
+func (c *Claims) Authorize(verb Verb, types ...string) error {
+	for _, t := range types {
+		if !Allowed(c.Role, verb, t) {
+			return ErrForbidden
+		}
+	}
+
+	return nil
+}
@@ -2,21 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
-	"strings"
 
 	"github.com/go-logr/logr"
 	"github.com/go-logr/zerologr"
 	"github.com/julienschmidt/httprouter"
 	"github.com/project-safari/zebra"
 	"github.com/project-safari/zebra/api"
+	"github.com/project-safari/zebra/auth"
 	"github.com/project-safari/zebra/compute"
 	"github.com/project-safari/zebra/dc"
+	"github.com/project-safari/zebra/lease"
 	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/store"
+	"github.com/project-safari/zebra/webhook"
 	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
 	"gojini.dev/config"
@@ -25,6 +29,8 @@ import (
 
 const version = "unknown"
 
+var errKeyFileMissing = errors.New("store configuration names no key file")
+
 func main() {
 	name := filepath.Base(os.Args[0])
 	rootCmd := &cobra.Command{ // nolint:exhaustruct,exhaustivestruct
@@ -35,7 +41,7 @@ func main() {
 		SilenceUsage: true,
 	}
 	rootCmd.SetVersionTemplate(version + "\n")
-	rootCmd.Flags().StringP("config", "c", path.Join(
+	rootCmd.PersistentFlags().StringP("config", "c", path.Join(
 		func() string {
 			s, _ := os.Getwd()
 
@@ -44,6 +50,16 @@ func main() {
 		"config file (default: $PWD/server.json",
 	)
 
+	rootCmd.AddCommand(&cobra.Command{ // nolint:exhaustruct,exhaustivestruct
+		Use:   "rotate-key",
+		Short: "encrypt stored credentials under a new key",
+		Long: "Add a new key to the key file named in the store configuration, encrypt the keys of\n" +
+			"all stored credentials under it and remove the old keys. Credentials stored in plain\n" +
+			"text are encrypted too. The server must not be running while keys are rotated.",
+		RunE:         rotateKey,
+		SilenceUsage: true,
+	})
+
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -62,6 +78,91 @@ func run(cmd *cobra.Command, args []string) error {
 	return startServer(cfgStore)
 }
 
+// Store configuration. KeyFile, if set, names the file holding the keys that
+// credentials are encrypted with in the store.
+type storeConfig struct {
+	Root    string `json:"rootDir"`
+	KeyFile string `json:"keyFile"`
+}
+
+func rotateKey(cmd *cobra.Command, args []string) error {
+	cfgStore := config.New()
+	if err := cfgStore.LoadFromFile(context.Background(), cmd.Flag("config").Value.String()); err != nil {
+		return err
+	}
+
+	storeCfg := new(storeConfig)
+	if err := cfgStore.Get("store", storeCfg); err != nil {
+		return err
+	}
+
+	if storeCfg.KeyFile == "" {
+		return errKeyFileMissing
+	}
+
+	keys, err := store.ReadKeyFile(storeCfg.KeyFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	key, err := store.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	// Keep the old keys until all credentials are encrypted under the new
+	// one, so the store stays readable if rotation is interrupted.
+	keys = append([][]byte{key}, keys...)
+	if err := store.WriteKeyFile(storeCfg.KeyFile, keys...); err != nil {
+		return err
+	}
+
+	cipher, err := store.NewCipher(keys...)
+	if err != nil {
+		return err
+	}
+
+	fs := store.NewFileStore(storeCfg.Root, initTypes())
+	fs.SetCipher(cipher)
+
+	if err := fs.Rewrap(); err != nil {
+		return err
+	}
+
+	return store.WriteKeyFile(storeCfg.KeyFile, key)
+}
+
+// Return a cipher for the keys in the key file, creating the file with a new
+// key if it does not exist yet.
+func loadCipher(ctx context.Context, keyFile string) *store.Cipher {
+	log := logr.FromContextOrDiscard(ctx)
+
+	keys, e := store.ReadKeyFile(keyFile)
+	if errors.Is(e, os.ErrNotExist) {
+		log.Info("store key file missing, generating a new key", "keyFile", keyFile)
+
+		key, err := store.GenerateKey()
+		if err == nil {
+			err = store.WriteKeyFile(keyFile, key)
+		}
+
+		keys, e = [][]byte{key}, err
+	}
+
+	if e != nil {
+		log.Error(e, "store key file invalid")
+		panic(e)
+	}
+
+	cipher, e := store.NewCipher(keys...)
+	if e != nil {
+		log.Error(e, "store key file invalid")
+		panic(e)
+	}
+
+	return cipher
+}
+
 func setupLogger(cfgStore *config.Store) context.Context {
 	ctx := context.Background()
 	zl := zerolog.New(os.Stderr).Level(zerolog.DebugLevel)
@@ -82,19 +183,25 @@ func startServer(cfgStore *config.Store) error {
 		return e
 	}
 
-	handler := httpHandler(appCtx, cfgStore)
+	resAPI := initAPI(appCtx, cfgStore)
+
+	// Release expired leases in the background.
+	go resAPI.Leases().Run(appCtx)
+
+	// Deliver events to webhooks in the background.
+	go resAPI.Webhooks().Run(appCtx)
+
+	handler := httpHandler(appCtx, resAPI)
 	webServer := web.NewServer(serverCfg, handler)
 
 	return webServer.Start(appCtx)
 }
 
-func httpHandler(ctx context.Context, cfgStore *config.Store) http.Handler {
+func initAPI(ctx context.Context, cfgStore *config.Store) *api.ResourceAPI {
 	log := logr.FromContextOrDiscard(ctx)
-	storeCfg := struct {
-		Root string `json:"rootDir"`
-	}{Root: ""}
+	storeCfg := new(storeConfig)
 
-	if e := cfgStore.Get("store", &storeCfg); e != nil {
+	if e := cfgStore.Get("store", storeCfg); e != nil {
 		log.Error(e, "store configuration missing")
 		panic(e)
 	}
@@ -102,15 +209,74 @@ func httpHandler(ctx context.Context, cfgStore *config.Store) http.Handler {
 	factory := initTypes()
 
 	resAPI := api.NewResourceAPI(factory)
+
+	if storeCfg.KeyFile != "" {
+		resAPI.SetCipher(loadCipher(ctx, storeCfg.KeyFile))
+	}
+
 	if e := resAPI.Initialize(storeCfg.Root); e != nil {
 		log.Error(e, "api initialization failed")
 		panic(e)
 	}
 
+	leaseCfg := lease.DefaultConfig()
+	if e := cfgStore.Get("lease", &leaseCfg); e != nil {
+		log.Info("lease configuration missing, using defaults")
+	}
+
+	if e := resAPI.Leases().Configure(leaseCfg); e != nil {
+		log.Error(e, "lease configuration invalid")
+		panic(e)
+	}
+
+	webhookCfg := webhook.DefaultConfig()
+	if e := cfgStore.Get("webhook", &webhookCfg); e != nil {
+		log.Info("webhook configuration missing, using defaults")
+	}
+
+	if e := resAPI.Webhooks().Configure(webhookCfg); e != nil {
+		log.Error(e, "webhook configuration invalid")
+		panic(e)
+	}
+
+	authCfg := new(auth.Config)
+	if e := cfgStore.Get("auth", authCfg); e != nil {
+		log.Error(e, "auth configuration missing")
+		panic(e)
+	}
+
+	signer, e := auth.NewSignerFromConfig(*authCfg)
+	if e != nil {
+		log.Error(e, "auth configuration invalid")
+		panic(e)
+	}
+
+	resAPI.SetSigner(signer)
+
+	return resAPI
+}
+
+func httpHandler(ctx context.Context, resAPI *api.ResourceAPI) http.Handler {
 	router := httprouter.New()
-	router.GET("/api/v1/resources", handle(resAPI))
+	router.NotFound = http.HandlerFunc(api.NotFound)
+	router.MethodNotAllowed = http.HandlerFunc(api.MethodNotAllowed)
+
+	// The same routes are described by the OpenAPI document.
+	for _, route := range resAPI.Routes() {
+		router.HandlerFunc(route.Method, route.Path, route.Handler)
+	}
+
+	return withLogger(ctx, api.Recover(resAPI.RequireAuth(router)))
+}
+
+// Make the application logger available to handlers through the request
+// context.
+func withLogger(ctx context.Context, next http.Handler) http.Handler {
+	log := logr.FromContextOrDiscard(ctx)
 
-	return router
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(w, req.WithContext(logr.NewContext(req.Context(), log)))
+	})
 }
 
 func initTypes() zebra.ResourceFactory {
@@ -152,6 +318,22 @@ func initTypes() zebra.ResourceFactory {
 		return new(compute.VM)
 	})
 
+	// lease resources
+	factory.Add(lease.Type, func() zebra.Resource {
+		return new(lease.Lease)
+	})
+	factory.Add(lease.RequestType, func() zebra.Resource {
+		return new(lease.Request)
+	})
+
+	// webhook resources
+	factory.Add(webhook.Type, func() zebra.Resource {
+		return new(webhook.Webhook)
+	})
+	factory.Add(webhook.DeadLetterType, func() zebra.Resource {
+		return new(webhook.DeadLetter)
+	})
+
 	// other resources
 	factory.Add("BaseResource", func() zebra.Resource {
 		return new(zebra.BaseResource)
@@ -162,28 +344,10 @@ func initTypes() zebra.ResourceFactory {
 	factory.Add("Credentials", func() zebra.Resource {
 		return new(zebra.Credentials)
 	})
+	factory.Add("User", func() zebra.Resource {
+		return new(zebra.User)
+	})
 
 	// Need to add all the known types here
 	return factory
 }
-
-func handle(resAPI *api.ResourceAPI) httprouter.Handle {
-	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
-		switch {
-		case strings.HasPrefix(req.URL.RawQuery, "id"):
-			resAPI.GetResourcesByID(res, req)
-
-		case strings.HasPrefix(req.URL.RawQuery, "type"):
-			resAPI.GetResourcesByType(res, req)
-
-		case strings.HasPrefix(req.URL.RawQuery, "property"):
-			resAPI.GetResourcesByProperty(res, req)
-
-		case strings.HasPrefix(req.URL.RawQuery, "label"):
-			resAPI.GetResourcesByLabel(res, req)
-
-		default:
-			resAPI.GetResources(res, req)
-		}
-	}
-}
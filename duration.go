@@ -0,0 +1,25 @@
+package zebra
+
+import "time"
+
+// Duration is a time.Duration that is read from and written to JSON as a
+// string such as "1h30m". It is encoded as text so that schemas describe it
+// as a string.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	d.Duration = v
+
+	return nil
+}
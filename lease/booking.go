@@ -0,0 +1,75 @@
+package lease
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrBooked = errors.New("resource is booked for an overlapping time")
+
+var ErrStartPast = errors.New("start time is in the past")
+
+// Return ErrLeased if any resource of l is held by a lease that has already
+// started and overlaps l, or ErrBooked if it is booked by a future lease that
+// overlaps l. The lease l itself is ignored if already stored. Should not be
+// called without holding the lock.
+func (m *Manager) check(l *Lease, now time.Time) error {
+	for _, resID := range l.Resources {
+		other := m.overlapping(resID, l.Start, l.Expiry(), l.ID, now)
+
+		switch {
+		case other == nil:
+			continue
+		case other.Start.After(now):
+			return ErrBooked
+		default:
+			return ErrLeased
+		}
+	}
+
+	return nil
+}
+
+// Return a lease, other than the one with ID ignore, that holds or books the
+// resource at some time between start and end. A lease that has started
+// holds its resources until it is released, even past its expiry, so once
+// expired it overlaps any time range starting now or earlier. Should not be
+// called without holding the lock.
+func (m *Manager) overlapping(resID string, start time.Time, end time.Time, ignore string, now time.Time) *Lease {
+	for _, id := range m.held[resID] {
+		other := m.leases[id]
+		if id == ignore {
+			continue
+		}
+
+		// Started and expired, but not released yet.
+		if !other.Start.After(now) && !other.Expiry().After(now) {
+			if !start.After(now) {
+				return other
+			}
+
+			continue
+		}
+
+		if start.Before(other.Expiry()) && other.Start.Before(end) {
+			return other
+		}
+	}
+
+	return nil
+}
+
+// Return true if a lease other than l holding one of its resources has
+// started, which means l is past its expiry and its resources are booked.
+// Should not be called without holding the lock.
+func (m *Manager) superseded(l *Lease, now time.Time) bool {
+	for _, resID := range l.Resources {
+		for _, id := range m.held[resID] {
+			if id != l.ID && !m.leases[id].Start.After(now) && !m.leases[id].Start.Before(l.Expiry()) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,200 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/project-safari/zebra"
+)
+
+// DefaultRole is the role whose maximum lease duration applies to roles that
+// have none configured.
+const DefaultRole = "default"
+
+var ErrMaxDuration = errors.New("lease duration exceeds the maximum allowed for the role")
+
+var ErrIntervalInvalid = errors.New("lease interval must be greater than 0")
+
+var ErrGraceInvalid = errors.New("lease grace period must not be negative")
+
+// Config holds the lease expiry settings. Expired leases are released once
+// they are Grace past their expiry, checked every Interval. MaxDuration maps
+// a role to the longest total duration a lease of that role may have.
+type Config struct {
+	Grace       zebra.Duration            `json:"grace"`
+	Interval    zebra.Duration            `json:"interval"`
+	MaxDuration map[string]zebra.Duration `json:"maxDuration"`
+}
+
+// DefaultConfig returns the settings used when none are configured: a five
+// minute grace period checked every minute, and no maximum duration.
+func DefaultConfig() Config {
+	return Config{
+		Grace:       zebra.Duration{Duration: 5 * time.Minute}, //nolint:gomnd
+		Interval:    zebra.Duration{Duration: time.Minute},
+		MaxDuration: map[string]zebra.Duration{},
+	}
+}
+
+// Validate returns an error if the settings cannot be used.
+func (c Config) Validate() error {
+	switch {
+	case c.Interval.Duration <= 0:
+		return ErrIntervalInvalid
+	case c.Grace.Duration < 0:
+		return ErrGraceInvalid
+	}
+
+	return nil
+}
+
+// Configure replaces the manager's expiry settings, unless they are not valid,
+// in which case it returns an error and keeps the current ones.
+func (m *Manager) Configure(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.cfg = cfg
+
+	return nil
+}
+
+// CheckDuration returns ErrMaxDuration if a lease of the given duration is
+// longer than allowed for the role.
+func (m *Manager) CheckDuration(role string, duration time.Duration) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.checkDuration(role, duration)
+}
+
+// Renew extends the lease with the given ID by extension. Leases past their
+// expiry may still be renewed during the grace period. Return the renewed
+// lease, ErrMaxDuration if its total duration would exceed the maximum for
+// the role, or ErrBooked if it would run into a booking of its resources.
+func (m *Manager) Renew(ctx context.Context, id string, extension time.Duration, role string) (*Lease, error) {
+	if extension <= 0 {
+		return nil, ErrDurationInvalid
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	l, ok := m.leases[id]
+	if !ok {
+		return nil, ErrLeaseNotFound
+	}
+
+	renewed := *l
+	renewed.Duration.Duration += extension
+
+	if err := m.checkDuration(role, renewed.Duration.Duration); err != nil {
+		return nil, err
+	}
+
+	if err := m.check(&renewed, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if err := m.store.Update(&renewed); err != nil {
+		return nil, err
+	}
+
+	m.leases[id] = &renewed
+	m.record(ctx, ActionRenew, l, &renewed)
+
+	return &renewed, nil
+}
+
+// Reap releases every lease that expired more than the grace period before
+// now, or that expired and has its resources booked by a lease that started,
+// grants the queued requests that can then be satisfied, and returns the
+// released leases.
+func (m *Manager) Reap(ctx context.Context, now time.Time) ([]*Lease, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	expired := []*Lease{}
+
+	for _, l := range m.leases {
+		switch {
+		case now.After(l.Expiry().Add(m.cfg.Grace.Duration)):
+			expired = append(expired, l)
+		case !now.Before(l.Expiry()) && m.superseded(l, now):
+			// No grace period when the resources are booked from now on.
+			expired = append(expired, l)
+		}
+	}
+
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].Expiry().Before(expired[j].Expiry())
+	})
+
+	for i, l := range expired {
+		if err := m.release(ctx, l); err != nil {
+			return expired[:i], err
+		}
+	}
+
+	_, err := m.grant()
+
+	return expired, err
+}
+
+// Run reaps expired leases every configured interval until the context is
+// done. Each released lease is logged along with why it was released.
+func (m *Manager) Run(ctx context.Context) {
+	log := logr.FromContextOrDiscard(ctx)
+
+	m.lock.Lock()
+	interval := m.cfg.Interval.Duration
+	grace := m.cfg.Grace.Duration
+	m.lock.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			released, err := m.Reap(ctx, now)
+
+			for _, l := range released {
+				reason := "expired"
+				if !now.After(l.Expiry().Add(grace)) {
+					reason = "expired and booked"
+				}
+
+				log.Info("lease released", "id", l.ID, "owner", l.Owner, "resources", l.Resources,
+					"reason", reason, "expiry", l.Expiry())
+			}
+
+			if err != nil {
+				log.Error(err, "lease reaper failed")
+			}
+		}
+	}
+}
+
+// Should not be called without holding the lock.
+func (m *Manager) checkDuration(role string, duration time.Duration) error {
+	limit, ok := m.cfg.MaxDuration[role]
+	if !ok {
+		limit = m.cfg.MaxDuration[DefaultRole]
+	}
+
+	if limit.Duration > 0 && duration > limit.Duration {
+		return ErrMaxDuration
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package lease
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Longest content line allowed by RFC 5545, in octets, not counting CRLF.
+const icalLineLen = 75
+
+const icalTime = "20060102T150405Z"
+
+// WriteCalendar writes the given leases to w as an iCalendar (RFC 5545)
+// document with one event per lease.
+func WriteCalendar(w io.Writer, name string, leases []*Lease) error {
+	buf := bufio.NewWriter(w)
+	now := time.Now().UTC().Format(icalTime)
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//project-safari//zebra//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + icalEscape(name),
+	}
+
+	for _, l := range leases {
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+l.ID+"@zebra",
+			"DTSTAMP:"+now,
+			"DTSTART:"+l.Start.UTC().Format(icalTime),
+			"DTEND:"+l.Expiry().UTC().Format(icalTime),
+			"SUMMARY:"+icalEscape(fmt.Sprintf("%s: %s", l.Owner, strings.Join(l.Resources, ", "))),
+			"DESCRIPTION:"+icalEscape(fmt.Sprintf("Lease %s held by %s on %s", l.ID, l.Owner,
+				strings.Join(l.Resources, ", "))),
+			"END:VEVENT",
+		)
+	}
+
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		if _, err := buf.WriteString(icalFold(line)); err != nil {
+			return err
+		}
+	}
+
+	return buf.Flush()
+}
+
+// Escape the characters that have a meaning in iCalendar text values.
+func icalEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// Fold a content line into lines of at most icalLineLen octets, each
+// continuation starting with a space, and terminate it with CRLF. Lines are
+// never split inside a UTF-8 sequence.
+func icalFold(line string) string {
+	var folded strings.Builder
+
+	limit := icalLineLen
+
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+
+		folded.WriteString(line[:cut])
+		folded.WriteString("\r\n ")
+
+		line = line[cut:]
+		limit = icalLineLen - 1
+	}
+
+	folded.WriteString(line)
+	folded.WriteString("\r\n")
+
+	return folded.String()
+}
@@ -0,0 +1,104 @@
+// Package lease provides structs and functions pertaining to resource leases.
+// A lease records that an owner holds a set of resources for a period of time.
+package lease
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/project-safari/zebra"
+)
+
+// Type is the resource type of a Lease.
+const Type = "Lease"
+
+var ErrOwnerEmpty = errors.New("owner is empty")
+
+var ErrResourcesEmpty = errors.New("lease has no resources")
+
+var ErrStartEmpty = errors.New("start time is empty")
+
+var ErrDurationInvalid = errors.New("duration must be greater than 0")
+
+var ErrResourcesDuplicate = errors.New("lease lists a resource more than once")
+
+var ErrNotLeasable = errors.New("leases and lease requests cannot be leased")
+
+// A Lease represents a set of resources held by an owner, starting at a given
+// time and lasting for a given duration.
+type Lease struct {
+	zebra.BaseResource
+	Owner     string         `json:"owner"`
+	Resources []string       `json:"resources"`
+	Start     time.Time      `json:"start"`
+	Duration  zebra.Duration `json:"duration"`
+}
+
+// NewLease returns a lease with a new ID for the given owner and resource IDs,
+// starting now.
+func NewLease(owner string, resources []string, duration time.Duration) *Lease {
+	return &Lease{
+		BaseResource: zebra.BaseResource{
+			ID:      newID(),
+			Type:    Type,
+			Labels:  nil,
+			Version: 0,
+		},
+		Owner:     owner,
+		Resources: resources,
+		Start:     time.Now(),
+		Duration:  zebra.Duration{Duration: duration},
+	}
+}
+
+// Validate returns an error if the given Lease object has incorrect values.
+// Else, it returns nil.
+func (l *Lease) Validate(ctx context.Context) error {
+	switch {
+	case l.Owner == "":
+		return ErrOwnerEmpty
+	case len(l.Resources) == 0:
+		return ErrResourcesEmpty
+	case l.Start.IsZero():
+		return ErrStartEmpty
+	case l.Duration.Duration <= 0:
+		return ErrDurationInvalid
+	}
+
+	seen := make(map[string]bool, len(l.Resources))
+	for _, id := range l.Resources {
+		if seen[id] {
+			return ErrResourcesDuplicate
+		}
+
+		seen[id] = true
+	}
+
+	return l.BaseResource.Validate(ctx)
+}
+
+// Leasable returns true if resources of the given type may be leased. Leases
+// and lease requests may not.
+func Leasable(resType string) bool {
+	return resType != Type && resType != RequestType
+}
+
+// Expiry returns the time at which the lease ends.
+func (l *Lease) Expiry() time.Time {
+	return l.Start.Add(l.Duration.Duration)
+}
+
+// Return a random hex ID. The first two characters select the file store
+// folder, so the ID must be hex.
+func newID() string {
+	b := make([]byte, 16) //nolint:gomnd
+
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,579 @@
+// Package lease_test tests structs and functions outlined in the lease package.
+package lease_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/query"
+	"github.com/project-safari/zebra/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStore(root string) *store.FileStore {
+	f := zebra.Factory().
+		Add(lease.Type, func() zebra.Resource { return new(lease.Lease) }).
+		Add(lease.RequestType, func() zebra.Resource { return new(lease.Request) })
+
+	return store.NewFileStore(root, f)
+}
+
+// Return a query store holding a VLANPool resource for each pool name, with
+// IDs 0100000000, 0100000001 and so on.
+func newQueryStore(pools ...string) *query.QueryStore {
+	resources := zebra.NewResourceMap(zebra.Factory())
+
+	for i, pool := range pools {
+		res := new(network.VLANPool)
+		res.ID = fmt.Sprintf("010000000%d", i)
+		res.Type = "VLANPool"
+		res.Labels = zebra.Labels{"pool": pool}
+		resources.Add(res, res.Type)
+	}
+
+	qs := query.NewQueryStore(resources)
+	if err := qs.Initialize(); err != nil {
+		panic(err)
+	}
+
+	return qs
+}
+
+// TestLease tests the *Lease Validate function with a pass and a fail case.
+func TestLease(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	l := new(lease.Lease)
+	assert.Equal(lease.ErrOwnerEmpty, l.Validate(ctx))
+
+	l.Owner = "aladdin"
+	assert.Equal(lease.ErrResourcesEmpty, l.Validate(ctx))
+
+	l.Resources = []string{"0100000001"}
+	assert.Equal(lease.ErrStartEmpty, l.Validate(ctx))
+
+	l.Start = time.Now()
+	assert.Equal(lease.ErrDurationInvalid, l.Validate(ctx))
+
+	l.Duration = zebra.Duration{Duration: time.Hour}
+	assert.Equal(zebra.ErrIDEmpty, l.Validate(ctx))
+
+	l.Resources = []string{"0100000001", "0100000002", "0100000001"}
+	assert.Equal(lease.ErrResourcesDuplicate, l.Validate(ctx))
+
+	l = lease.NewLease("aladdin", []string{"0100000001"}, time.Hour)
+	assert.Nil(l.Validate(ctx))
+	assert.Equal(lease.Type, l.GetType())
+	assert.NotEqual(l.ID, lease.NewLease("aladdin", l.Resources, time.Hour).ID)
+}
+
+func TestAcquireRelease(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	t.Cleanup(func() { os.RemoveAll("teststore1") })
+
+	fs := newStore("teststore1")
+	assert.Nil(fs.Initialize())
+
+	m := lease.NewManager(fs, nil)
+	assert.Nil(m.Initialize())
+
+	l1 := lease.NewLease("aladdin", []string{"0100000001", "0100000002"}, time.Hour)
+	assert.Nil(m.Acquire(ctx, l1))
+	assert.Equal(l1.ID, m.HeldBy("0100000002"))
+	assert.Equal(l1, m.Get(l1.ID))
+
+	// Any overlap with a held resource is rejected.
+	l2 := lease.NewLease("jasmine", []string{"0100000003", "0100000002"}, time.Hour)
+	assert.Equal(lease.ErrLeased, m.Acquire(ctx, l2))
+	assert.Empty(m.HeldBy("0100000003"))
+	assert.Len(m.Leases(), 1)
+
+	// Leases survive a reload from the store.
+	m = lease.NewManager(fs, nil)
+	assert.Nil(m.Initialize())
+	assert.Len(m.Leases(), 1)
+	assert.Equal(l1.ID, m.HeldBy("0100000001"))
+
+	assert.Nil(m.Release(ctx, l1.ID))
+	assert.Equal(lease.ErrLeaseNotFound, m.Release(ctx, l1.ID))
+	assert.Empty(m.HeldBy("0100000001"))
+
+	assert.Nil(m.Acquire(ctx, l2))
+	assert.Len(m.Leases(), 1)
+}
+
+func TestAcquireMatching(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	t.Cleanup(func() { os.RemoveAll("teststore2") })
+
+	fs := newStore("teststore2")
+	assert.Nil(fs.Initialize())
+
+	m := lease.NewManager(fs, newQueryStore("perf", "perf", "perf", "func"))
+	assert.Nil(m.Initialize())
+
+	sel := &lease.Selector{Type: "VLANPool", Labels: map[string]string{"pool": "perf"}, Count: 2}
+
+	l, err := m.AcquireMatching(ctx, "aladdin", sel, time.Hour)
+	assert.Nil(err)
+	assert.Equal([]string{"0100000000", "0100000001"}, l.Resources)
+
+	// Only one perf resource is left.
+	_, err = m.AcquireMatching(ctx, "jasmine", sel, time.Hour)
+	assert.Equal(lease.ErrUnavailable, err)
+	assert.Empty(m.HeldBy("0100000002"))
+
+	sel.Count = 1
+	l, err = m.AcquireMatching(ctx, "jasmine", sel, time.Hour)
+	assert.Nil(err)
+	assert.Equal([]string{"0100000002"}, l.Resources)
+
+	sel.Labels["pool"] = "unknown"
+	_, err = m.AcquireMatching(ctx, "jasmine", sel, time.Hour)
+	assert.Equal(lease.ErrUnavailable, err)
+
+	_, err = m.AcquireMatching(ctx, "jasmine", &lease.Selector{Type: "VLANPool", Labels: nil, Count: 1}, time.Hour)
+	assert.Nil(err)
+
+	_, err = m.AcquireMatching(ctx, "jasmine", &lease.Selector{Type: "", Labels: nil, Count: 1}, time.Hour)
+	assert.Equal(lease.ErrSelectorType, err)
+
+	_, err = m.AcquireMatching(ctx, "jasmine", &lease.Selector{Type: "VLANPool", Labels: nil, Count: 0}, time.Hour)
+	assert.Equal(lease.ErrSelectorCount, err)
+
+	_, err = m.AcquireMatching(ctx, "jasmine", &lease.Selector{Type: lease.Type, Labels: nil, Count: 1}, time.Hour)
+	assert.Equal(lease.ErrNotLeasable, err)
+}
+
+func TestQueue(t *testing.T) { // nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	t.Cleanup(func() { os.RemoveAll("teststore3") })
+
+	fs := newStore("teststore3")
+	assert.Nil(fs.Initialize())
+
+	qs := newQueryStore("perf", "perf", "perf")
+	m := lease.NewManager(fs, qs)
+	assert.Nil(m.Initialize())
+
+	two := &lease.Selector{Type: "VLANPool", Labels: map[string]string{"pool": "perf"}, Count: 2}
+	one := &lease.Selector{Type: "VLANPool", Labels: map[string]string{"pool": "perf"}, Count: 1}
+
+	l1, r, err := m.AcquireOrEnqueue(ctx, "aladdin", two, time.Hour)
+	assert.Nil(err)
+	assert.Nil(r)
+	assert.Len(l1.Resources, 2)
+
+	// Only one resource is free, so the request for two waits.
+	l, r2, err := m.AcquireOrEnqueue(ctx, "jasmine", two, time.Hour)
+	assert.Nil(err)
+	assert.Nil(l)
+	assert.Equal(lease.StateWaiting, r2.State)
+
+	// The free resource is claimed by the waiting request, so a later request
+	// for one resource waits behind it.
+	l, r1, err := m.AcquireOrEnqueue(ctx, "genie", one, time.Hour)
+	assert.Nil(err)
+	assert.Nil(l)
+
+	_, err = m.AcquireMatching(ctx, "genie", one, time.Hour)
+	assert.Equal(lease.ErrUnavailable, err)
+
+	// Nor can it be leased by ID.
+	assert.Equal(lease.ErrClaimed, m.Acquire(ctx, lease.NewLease("genie", []string{"0100000002"}, time.Hour)))
+
+	// Requests survive a restart.
+	m = lease.NewManager(fs, qs)
+	assert.Nil(m.Initialize())
+	requests := m.Requests()
+	assert.Len(requests, 2)
+	assert.Equal(r2.ID, requests[0].ID)
+	assert.Equal(r1.ID, requests[1].ID)
+
+	waitCtx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+
+	r, err = m.Wait(waitCtx, r2.ID)
+	assert.Nil(err)
+	assert.Equal(lease.StateWaiting, r.State)
+
+	// Releasing grants the requests in order.
+	assert.Nil(m.Release(ctx, l1.ID))
+
+	r, err = m.Wait(context.Background(), r2.ID)
+	assert.Nil(err)
+	assert.Equal(lease.StateGranted, r.State)
+	assert.Len(m.Get(r.Lease).Resources, 2)
+	assert.Equal("jasmine", m.Get(r.Lease).Owner)
+
+	r, err = m.Wait(context.Background(), r1.ID)
+	assert.Nil(err)
+	assert.Equal(lease.StateGranted, r.State)
+
+	// Releasing a granted lease removes its request.
+	assert.Nil(m.Release(ctx, r.Lease))
+	assert.Nil(m.GetRequest(r1.ID))
+
+	_, r, err = m.AcquireOrEnqueue(ctx, "genie", two, time.Hour)
+	assert.Nil(err)
+	assert.Nil(m.Cancel(ctx, r.ID))
+	assert.Equal(lease.ErrRequestNotFound, m.Cancel(ctx, r.ID))
+
+	_, err = m.Wait(context.Background(), r.ID)
+	assert.Equal(lease.ErrRequestNotFound, err)
+
+	_, _, err = m.AcquireOrEnqueue(ctx, "", one, time.Hour)
+	assert.Equal(lease.ErrOwnerEmpty, err)
+}
+
+// failingStore fails to update resources while fail is set.
+type failingStore struct {
+	zebra.Store
+	fail bool
+}
+
+var errUpdate = errors.New("update failed")
+
+func (s *failingStore) Update(res zebra.Resource) error {
+	if s.fail {
+		return errUpdate
+	}
+
+	return s.Store.Update(res)
+}
+
+func TestGrantUpdateFails(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	t.Cleanup(func() { os.RemoveAll("teststore7") })
+
+	fs := &failingStore{Store: newStore("teststore7"), fail: false}
+	assert.Nil(fs.Initialize())
+
+	m := lease.NewManager(fs, newQueryStore("perf"))
+	assert.Nil(m.Initialize())
+
+	one := &lease.Selector{Type: "VLANPool", Labels: map[string]string{"pool": "perf"}, Count: 1}
+
+	l, _, err := m.AcquireOrEnqueue(ctx, "aladdin", one, time.Hour)
+	assert.Nil(err)
+
+	_, r, err := m.AcquireOrEnqueue(ctx, "jasmine", one, time.Hour)
+	assert.Nil(err)
+
+	// The request cannot be marked granted, so it keeps waiting and the
+	// lease granted to it is released.
+	fs.fail = true
+	assert.Equal(errUpdate, m.Release(ctx, l.ID))
+	assert.Equal(lease.StateWaiting, m.GetRequest(r.ID).State)
+	assert.Empty(m.Leases())
+
+	// It is granted a single lease once the store works again.
+	fs.fail = false
+	assert.Nil(m.Grant())
+	assert.Equal(lease.StateGranted, m.GetRequest(r.ID).State)
+	assert.Len(m.Leases(), 1)
+	assert.Equal(m.GetRequest(r.ID).Lease, m.Leases()[0].ID)
+}
+
+// recorder collects the actions it is told about.
+type recorder struct {
+	lock    sync.Mutex
+	actions []string
+}
+
+func (r *recorder) Record(ctx context.Context, action string, before zebra.Resource, after zebra.Resource) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if before != nil {
+		action += " " + before.GetID()
+	}
+
+	if after != nil {
+		action += " " + after.GetID()
+	}
+
+	r.actions = append(r.actions, action)
+}
+
+func TestRecorder(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	t.Cleanup(func() { os.RemoveAll("teststore6") })
+
+	fs := newStore("teststore6")
+	assert.Nil(fs.Initialize())
+
+	rec := &recorder{lock: sync.Mutex{}, actions: nil}
+	m := lease.NewManager(fs, newQueryStore("perf"))
+	m.SetRecorder(rec)
+	assert.Nil(m.Initialize())
+
+	one := &lease.Selector{Type: "VLANPool", Labels: map[string]string{"pool": "perf"}, Count: 1}
+
+	l, _, err := m.AcquireOrEnqueue(ctx, "aladdin", one, time.Hour)
+	assert.Nil(err)
+
+	_, r, err := m.AcquireOrEnqueue(ctx, "jasmine", one, time.Hour)
+	assert.Nil(err)
+
+	assert.Nil(m.Release(ctx, l.ID))
+
+	granted := m.GetRequest(r.ID)
+	assert.Equal(lease.StateGranted, granted.State)
+
+	// Failed calls are not recorded.
+	assert.Equal(lease.ErrLeaseNotFound, m.Release(ctx, l.ID))
+
+	// Releasing the granted lease completes its request.
+	assert.Nil(m.Release(ctx, granted.Lease))
+
+	assert.Equal([]string{
+		"acquire " + l.ID,
+		"enqueue " + r.ID,
+		"release " + l.ID,
+		"acquire " + granted.Lease,
+		"grant " + r.ID + " " + r.ID,
+		"release " + granted.Lease,
+		"complete " + r.ID,
+	}, rec.actions)
+}
+
+func TestConfig(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	cfg := lease.DefaultConfig()
+	assert.Nil(json.Unmarshal([]byte(`{"grace":"1m","maxDuration":{"admin":"48h"}}`), &cfg))
+	assert.Equal(time.Minute, cfg.Grace.Duration)
+	assert.Equal(time.Minute, cfg.Interval.Duration)
+	assert.Equal(48*time.Hour, cfg.MaxDuration["admin"].Duration)
+
+	bytes, err := json.Marshal(cfg)
+	assert.Nil(err)
+	assert.Contains(string(bytes), `"grace":"1m0s"`)
+
+	assert.NotNil(json.Unmarshal([]byte(`{"grace":"soon"}`), &cfg))
+	assert.NotNil(json.Unmarshal([]byte(`{"grace":60}`), &cfg))
+	assert.Nil(cfg.Validate())
+
+	m := lease.NewManager(nil, nil)
+	assert.Nil(json.Unmarshal([]byte(`{"interval":"0s"}`), &cfg))
+	assert.Equal(lease.ErrIntervalInvalid, m.Configure(cfg))
+
+	cfg.Interval = zebra.Duration{Duration: -time.Minute}
+	assert.Equal(lease.ErrIntervalInvalid, m.Configure(cfg))
+
+	cfg.Interval = zebra.Duration{Duration: time.Minute}
+	cfg.Grace = zebra.Duration{Duration: -time.Minute}
+	assert.Equal(lease.ErrGraceInvalid, m.Configure(cfg))
+}
+
+func TestReapRenew(t *testing.T) { // nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	t.Cleanup(func() { os.RemoveAll("teststore4") })
+
+	fs := newStore("teststore4")
+	assert.Nil(fs.Initialize())
+
+	m := lease.NewManager(fs, newQueryStore("perf"))
+	assert.Nil(m.Initialize())
+	assert.Nil(m.Configure(lease.Config{
+		Grace:    zebra.Duration{Duration: time.Minute},
+		Interval: zebra.Duration{Duration: time.Millisecond},
+		MaxDuration: map[string]zebra.Duration{
+			lease.DefaultRole: {Duration: 2 * time.Hour},
+			"admin":           {Duration: 0},
+		},
+	}))
+
+	assert.Equal(lease.ErrMaxDuration, m.CheckDuration("developer", 3*time.Hour))
+	assert.Nil(m.CheckDuration("admin", 3*time.Hour))
+
+	sel := &lease.Selector{Type: "VLANPool", Labels: nil, Count: 1}
+
+	l, err := m.AcquireMatching(ctx, "aladdin", sel, time.Hour)
+	assert.Nil(err)
+
+	_, queued, err := m.AcquireOrEnqueue(ctx, "jasmine", sel, time.Hour)
+	assert.Nil(err)
+
+	// Expired, but within the grace period.
+	released, err := m.Reap(ctx, l.Expiry().Add(30*time.Second))
+	assert.Nil(err)
+	assert.Empty(released)
+
+	_, err = m.Renew(ctx, l.ID, 0, "developer")
+	assert.Equal(lease.ErrDurationInvalid, err)
+
+	_, err = m.Renew(ctx, "0000000000", time.Hour, "developer")
+	assert.Equal(lease.ErrLeaseNotFound, err)
+
+	_, err = m.Renew(ctx, l.ID, 2*time.Hour, "developer")
+	assert.Equal(lease.ErrMaxDuration, err)
+
+	renewed, err := m.Renew(ctx, l.ID, time.Hour, "developer")
+	assert.Nil(err)
+	assert.Equal(2*time.Hour, renewed.Duration.Duration)
+	assert.Equal(2*time.Hour, m.Get(l.ID).Duration.Duration)
+
+	released, err = m.Reap(ctx, l.Expiry().Add(2*time.Minute))
+	assert.Nil(err)
+	assert.Empty(released)
+
+	// Past the grace period of the renewed lease.
+	released, err = m.Reap(ctx, renewed.Expiry().Add(2*time.Minute))
+	assert.Nil(err)
+	assert.Len(released, 1)
+	assert.Nil(m.Get(l.ID))
+
+	// The queued request got the released resource.
+	r := m.GetRequest(queued.ID)
+	assert.Equal(lease.StateGranted, r.State)
+
+	// The background reaper releases leases on its own.
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go m.Run(runCtx)
+
+	assert.Nil(m.Release(ctx, r.Lease))
+	l = lease.NewLease("genie", []string{"0100000000"}, time.Nanosecond)
+	l.Start = time.Now().Add(-time.Hour)
+	assert.Nil(m.Acquire(ctx, l))
+	assert.Eventually(func() bool { return m.Get(l.ID) == nil }, time.Second, time.Millisecond)
+}
+
+func TestBookings(t *testing.T) { // nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	t.Cleanup(func() { os.RemoveAll("teststore5") })
+
+	fs := newStore("teststore5")
+	assert.Nil(fs.Initialize())
+
+	m := lease.NewManager(fs, newQueryStore("perf", "perf"))
+	assert.Nil(m.Initialize())
+
+	// Book a resource from 9:00 to 12:00 tomorrow.
+	nine := time.Now().Truncate(time.Hour).Add(24 * time.Hour)
+	booking := lease.NewLease("aladdin", []string{"0100000000"}, 3*time.Hour)
+	booking.Start = nine
+	assert.Nil(m.Acquire(ctx, booking))
+	assert.Empty(m.HeldBy("0100000000"))
+
+	// Overlapping bookings are rejected, adjacent ones are not.
+	l := lease.NewLease("jasmine", []string{"0100000001", "0100000000"}, 3*time.Hour)
+	l.Start = nine.Add(-30 * time.Minute)
+	assert.Equal(lease.ErrBooked, m.Acquire(ctx, l))
+
+	l.Start = nine.Add(-3 * time.Hour)
+	assert.Nil(m.Acquire(ctx, l))
+
+	after := lease.NewLease("genie", []string{"0100000000"}, time.Hour)
+	after.Start = booking.Expiry()
+	assert.Nil(m.Acquire(ctx, after))
+
+	// The booked lease cannot be renewed into the booking.
+	_, err := m.Renew(ctx, l.ID, time.Minute, "developer")
+	assert.Equal(lease.ErrBooked, err)
+
+	assert.Nil(m.Release(ctx, l.ID))
+	assert.Nil(m.Release(ctx, after.ID))
+
+	// A lease starting now may run up to the booking, but not into it.
+	sel := &lease.Selector{Type: "VLANPool", Labels: nil, Count: 2}
+
+	_, err = m.AcquireMatching(ctx, "jasmine", sel, 25*time.Hour)
+	assert.Equal(lease.ErrUnavailable, err)
+
+	now, err := m.AcquireMatching(ctx, "jasmine", sel, time.Hour)
+	assert.Nil(err)
+	assert.Equal(now.ID, m.HeldBy("0100000000"))
+	assert.Equal(lease.ErrLeased, m.Acquire(ctx, lease.NewLease("genie", []string{"0100000000"}, time.Hour)))
+
+	// Once the booking starts, the expired lease is released without waiting
+	// for the grace period.
+	assert.Nil(m.Release(ctx, now.ID))
+
+	l = lease.NewLease("jasmine", []string{"0100000000"}, time.Hour)
+	l.Start = nine.Add(-time.Hour)
+	assert.Nil(m.Acquire(ctx, l))
+
+	released, err := m.Reap(ctx, nine.Add(-time.Second))
+	assert.Nil(err)
+	assert.Empty(released)
+
+	released, err = m.Reap(ctx, nine)
+	assert.Nil(err)
+	assert.Len(released, 1)
+	assert.Equal(l.ID, released[0].ID)
+	assert.NotNil(m.Get(booking.ID))
+}
+
+func TestWriteCalendar(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	l := lease.NewLease("aladdin; jasmine", []string{"0100000001", "0100000002", "0100000003", "0100000004",
+		"0100000005"}, 90*time.Minute)
+	l.Start = time.Date(2022, 7, 1, 9, 0, 0, 0, time.UTC)
+
+	var buf strings.Builder
+
+	assert.Nil(lease.WriteCalendar(&buf, "lab, bookings", []*lease.Lease{l}))
+
+	cal := buf.String()
+	assert.True(strings.HasPrefix(cal, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	assert.True(strings.HasSuffix(cal, "END:VEVENT\r\nEND:VCALENDAR\r\n"))
+	assert.Contains(cal, "X-WR-CALNAME:lab\\, bookings\r\n")
+	assert.Contains(cal, "UID:"+l.ID+"@zebra\r\n")
+	assert.Contains(cal, "DTSTART:20220701T090000Z\r\n")
+	assert.Contains(cal, "DTEND:20220701T103000Z\r\n")
+	assert.Contains(cal, `SUMMARY:aladdin\; jasmine: 0100000001\, `)
+
+	// Long lines are folded.
+	for _, line := range strings.Split(cal, "\r\n") {
+		assert.LessOrEqual(len(line), 75)
+	}
+
+	assert.Contains(strings.ReplaceAll(cal, "\r\n ", ""), "0100000004\\, 0100000005\r\n")
+}
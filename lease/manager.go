@@ -0,0 +1,372 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/query"
+)
+
+var ErrLeased = errors.New("resource is already leased")
+
+var ErrLeaseNotFound = errors.New("lease does not exist")
+
+var ErrUnavailable = errors.New("not enough free resources match the selector")
+
+var ErrClaimed = errors.New("resource is claimed by a queued lease request")
+
+// Actions that a Recorder is told about.
+const (
+	ActionAcquire  = "acquire"
+	ActionRenew    = "renew"
+	ActionRelease  = "release"
+	ActionEnqueue  = "enqueue"
+	ActionGrant    = "grant"
+	ActionCancel   = "cancel"
+	ActionComplete = "complete"
+)
+
+// A Recorder is told about every lease or request that the manager stores,
+// updates or deletes, along with the context of the call that caused it.
+// Before is nil for stored objects and after is nil for deleted ones. Leases
+// granted to queued requests are recorded with a background context, as they
+// are not granted on behalf of the caller.
+type Recorder interface {
+	Record(ctx context.Context, action string, before zebra.Resource, after zebra.Resource)
+}
+
+// Manager hands out leases on resources, making sure a resource is never
+// held by more than one lease at a time. Leases may start in the future, in
+// which case they book the resources from then on. Leases are persisted in a
+// zebra.Store, and selectors are matched against a query store.
+type Manager struct {
+	lock       sync.Mutex
+	store      zebra.Store
+	queryStore *query.QueryStore
+	leases     map[string]*Lease
+	held       map[string][]string
+	requests   map[string]*Request
+	queue      []*Request
+	changed    chan struct{}
+	cfg        Config
+	recorder   Recorder
+}
+
+// Return new Manager pointer that persists leases in the given store and
+// matches selectors against the given query store.
+func NewManager(store zebra.Store, queryStore *query.QueryStore) *Manager {
+	return &Manager{
+		lock:       sync.Mutex{},
+		store:      store,
+		queryStore: queryStore,
+		leases:     map[string]*Lease{},
+		held:       map[string][]string{},
+		requests:   map[string]*Request{},
+		queue:      []*Request{},
+		changed:    make(chan struct{}),
+		cfg:        DefaultConfig(),
+		recorder:   nil,
+	}
+}
+
+// SetRecorder sets the recorder that is told about every change.
+func (m *Manager) SetRecorder(r Recorder) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.recorder = r
+}
+
+// Initialize loads the leases and queued requests already present in the
+// store, and grants the queued requests that can now be satisfied.
+func (m *Manager) Initialize() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	resources, err := m.store.Load()
+	if err != nil {
+		return err
+	}
+
+	m.leases = map[string]*Lease{}
+	m.held = map[string][]string{}
+
+	if list := resources.Resources[Type]; list != nil {
+		for _, res := range list.Resources {
+			if l, ok := res.(*Lease); ok {
+				m.add(l)
+			}
+		}
+	}
+
+	m.requests = map[string]*Request{}
+	m.queue = []*Request{}
+
+	if list := resources.Resources[RequestType]; list != nil {
+		for _, res := range list.Resources {
+			if r, ok := res.(*Request); ok {
+				m.requests[r.ID] = r
+
+				if r.State == StateWaiting {
+					m.queue = append(m.queue, r)
+				}
+			}
+		}
+	}
+
+	sort.Slice(m.queue, func(i, j int) bool {
+		return m.queue[i].before(m.queue[j])
+	})
+
+	_, err = m.grant()
+
+	return err
+}
+
+// Acquire stores the given lease. If any of its resources is already leased,
+// or booked for a time overlapping the lease, return ErrLeased or ErrBooked
+// and store nothing. If any is claimed by a queued request, as described in
+// grant, return ErrClaimed, so that the lease does not jump the queue.
+func (m *Manager) Acquire(ctx context.Context, l *Lease) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	claimed, err := m.grant()
+	if err != nil {
+		return err
+	}
+
+	if err := m.check(l, time.Now()); err != nil {
+		return err
+	}
+
+	for _, resID := range l.Resources {
+		if claimed[resID] {
+			return ErrClaimed
+		}
+	}
+
+	return m.acquire(ctx, l)
+}
+
+// AcquireMatching leases Count free resources matching the selector for the
+// given owner and duration. Matching resources are picked in ID order, and
+// resources wanted by queued requests are left for them. If fewer than Count
+// are free, return ErrUnavailable and lease nothing.
+func (m *Manager) AcquireMatching(ctx context.Context, owner string, sel *Selector,
+	duration time.Duration,
+) (*Lease, error) {
+	if err := sel.Validate(); err != nil {
+		return nil, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	claimed, err := m.grant()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.acquireMatching(ctx, owner, sel, duration, claimed)
+}
+
+// Release deletes the lease with the given ID, freeing its resources, and
+// grants the queued requests that can now be satisfied.
+func (m *Manager) Release(ctx context.Context, id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	l, ok := m.leases[id]
+	if !ok {
+		return ErrLeaseNotFound
+	}
+
+	if err := m.release(ctx, l); err != nil {
+		return err
+	}
+
+	_, err := m.grant()
+
+	return err
+}
+
+// Get returns the lease with the given ID, or nil if there is none.
+func (m *Manager) Get(id string) *Lease {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.leases[id]
+}
+
+// HeldBy returns the ID of the lease holding the given resource now, or an
+// empty string if the resource is free. Bookings that have not started yet do
+// not hold their resources.
+func (m *Manager) HeldBy(resID string) string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := time.Now()
+	holder := ""
+
+	for _, id := range m.held[resID] {
+		l := m.leases[id]
+		if !l.Start.After(now) && (holder == "" || l.Start.After(m.leases[holder].Start)) {
+			holder = id
+		}
+	}
+
+	return holder
+}
+
+// Leased returns true if any lease holds the given resource now or has
+// booked it for later.
+func (m *Manager) Leased(resID string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return len(m.held[resID]) > 0
+}
+
+// Leases returns all leases sorted by start time.
+func (m *Manager) Leases() []*Lease {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	leases := make([]*Lease, 0, len(m.leases))
+	for _, l := range m.leases {
+		leases = append(leases, l)
+	}
+
+	sort.Slice(leases, func(i, j int) bool {
+		return leases[i].Start.Before(leases[j].Start)
+	})
+
+	return leases
+}
+
+// Should not be called without holding the lock.
+func (m *Manager) acquireMatching(ctx context.Context, owner string, sel *Selector, duration time.Duration,
+	claimed map[string]bool,
+) (*Lease, error) {
+	l := NewLease(owner, nil, duration)
+
+	free, err := m.free(sel, l.Start, l.Expiry(), claimed)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(free) < sel.Count {
+		return nil, ErrUnavailable
+	}
+
+	l.Resources = free[:sel.Count]
+	if err := l.Validate(context.Background()); err != nil {
+		return nil, err
+	}
+
+	if err := m.acquire(ctx, l); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Return the IDs of resources matching the selector that are neither claimed
+// nor leased or booked at any time between start and end, in ID order.
+// Should not be called without holding the lock.
+func (m *Manager) free(sel *Selector, start time.Time, end time.Time, claimed map[string]bool) ([]string, error) {
+	ids, err := sel.match(m.queryStore)
+	if err != nil {
+		return nil, err
+	}
+
+	free := make([]string, 0, len(ids))
+	now := time.Now()
+
+	for _, id := range ids {
+		if !claimed[id] && m.overlapping(id, start, end, "", now) == nil {
+			free = append(free, id)
+		}
+	}
+
+	return free, nil
+}
+
+// Should not be called without holding the lock.
+func (m *Manager) acquire(ctx context.Context, l *Lease) error {
+	if err := m.store.Create(l); err != nil {
+		return err
+	}
+
+	m.add(l)
+	m.record(ctx, ActionAcquire, nil, l)
+
+	return nil
+}
+
+// Should not be called without holding the lock.
+func (m *Manager) release(ctx context.Context, l *Lease) error {
+	if err := m.store.Delete(l); err != nil {
+		return err
+	}
+
+	m.remove(l)
+	m.record(ctx, ActionRelease, l, nil)
+
+	// The request this lease was granted for is done with.
+	for _, r := range m.requests {
+		if r.Lease == l.ID {
+			if err := m.store.Delete(r); err != nil {
+				return err
+			}
+
+			delete(m.requests, r.ID)
+			m.record(ctx, ActionComplete, r, nil)
+		}
+	}
+
+	return nil
+}
+
+// Tell the recorder, if any, about a change. Should not be called without
+// holding the lock.
+func (m *Manager) record(ctx context.Context, action string, before zebra.Resource, after zebra.Resource) {
+	if m.recorder != nil {
+		m.recorder.Record(ctx, action, before, after)
+	}
+}
+
+// Should not be called without holding the lock.
+func (m *Manager) add(l *Lease) {
+	m.leases[l.ID] = l
+
+	for _, resID := range l.Resources {
+		m.held[resID] = append(m.held[resID], l.ID)
+	}
+}
+
+// Should not be called without holding the lock.
+func (m *Manager) remove(l *Lease) {
+	delete(m.leases, l.ID)
+
+	for _, resID := range l.Resources {
+		ids := make([]string, 0, len(m.held[resID]))
+
+		for _, id := range m.held[resID] {
+			if id != l.ID {
+				ids = append(ids, id)
+			}
+		}
+
+		if len(ids) == 0 {
+			delete(m.held, resID)
+		} else {
+			m.held[resID] = ids
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+var ErrRequestNotFound = errors.New("lease request does not exist")
+
+// AcquireOrEnqueue leases Count free resources matching the selector like
+// AcquireMatching. If not enough resources are free, the request is stored
+// at the back of the queue instead and returned. Queued requests are granted
+// in order as matching resources are released.
+func (m *Manager) AcquireOrEnqueue(ctx context.Context, owner string, sel *Selector,
+	duration time.Duration,
+) (*Lease, *Request, error) {
+	r := NewRequest(owner, *sel, duration)
+	if err := r.Validate(context.Background()); err != nil {
+		return nil, nil, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	claimed, err := m.grant()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	l, err := m.acquireMatching(ctx, owner, sel, duration, claimed)
+	if !errors.Is(err, ErrUnavailable) {
+		return l, nil, err
+	}
+
+	if err := m.store.Create(r); err != nil {
+		return nil, nil, err
+	}
+
+	m.requests[r.ID] = r
+	m.queue = append(m.queue, r)
+	m.record(ctx, ActionEnqueue, nil, r)
+
+	return nil, r, nil
+}
+
+// GetRequest returns the request with the given ID, or nil if there is none.
+func (m *Manager) GetRequest(id string) *Request {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.requests[id]
+}
+
+// Requests returns all requests, waiting or granted, in queue order.
+func (m *Manager) Requests() []*Request {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	requests := make([]*Request, 0, len(m.requests))
+	for _, r := range m.requests {
+		requests = append(requests, r)
+	}
+
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].before(requests[j])
+	})
+
+	return requests
+}
+
+// Cancel deletes the request with the given ID. A granted request's lease is
+// left untouched.
+func (m *Manager) Cancel(ctx context.Context, id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	r, ok := m.requests[id]
+	if !ok {
+		return ErrRequestNotFound
+	}
+
+	if err := m.store.Delete(r); err != nil {
+		return err
+	}
+
+	delete(m.requests, id)
+	m.record(ctx, ActionCancel, r, nil)
+
+	for i, queued := range m.queue {
+		if queued.ID == id {
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+
+			break
+		}
+	}
+
+	m.notify()
+
+	// Resources claimed by this request may now go to the ones behind it.
+	_, err := m.grant()
+
+	return err
+}
+
+// Grant leases resources to the queued requests that can now be satisfied, as
+// when resources matching them are created.
+func (m *Manager) Grant() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	_, err := m.grant()
+
+	return err
+}
+
+// Wait blocks until the request with the given ID is no longer waiting or
+// the context is done, and returns the request as it is then.
+func (m *Manager) Wait(ctx context.Context, id string) (*Request, error) {
+	for {
+		m.lock.Lock()
+		r, ok := m.requests[id]
+		changed := m.changed
+		m.lock.Unlock()
+
+		if !ok {
+			return nil, ErrRequestNotFound
+		}
+
+		if r.State != StateWaiting {
+			return r, nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return r, nil
+		}
+	}
+}
+
+// grant walks the queue in order and leases resources to every request that
+// can be satisfied. The free resources matching a request that cannot be
+// satisfied yet are claimed for it, so requests behind it cannot take them.
+// Return the claimed resources. Should not be called without holding the lock.
+func (m *Manager) grant() (map[string]bool, error) {
+	ctx := context.Background()
+	claimed := map[string]bool{}
+	waiting := make([]*Request, 0, len(m.queue))
+	granted := false
+
+	defer func() {
+		if granted {
+			m.notify()
+		}
+	}()
+
+	for i, r := range m.queue {
+		l := NewLease(r.Owner, nil, r.Duration.Duration)
+
+		free, err := m.free(&r.Selector, l.Start, l.Expiry(), claimed)
+		if err != nil {
+			m.queue = append(waiting, m.queue[i:]...)
+
+			return claimed, err
+		}
+
+		if len(free) < r.Selector.Count {
+			for _, id := range free {
+				claimed[id] = true
+			}
+
+			waiting = append(waiting, r)
+
+			continue
+		}
+
+		l.Resources = free[:r.Selector.Count]
+
+		done := *r
+		done.State = StateGranted
+		done.Lease = l.ID
+
+		if err := m.acquire(ctx, l); err != nil {
+			m.queue = append(waiting, m.queue[i:]...)
+
+			return claimed, err
+		}
+
+		if err := m.store.Update(&done); err != nil {
+			m.queue = append(waiting, m.queue[i:]...)
+
+			// The request is still waiting and would be granted another
+			// lease, so this one must not be kept.
+			if releaseErr := m.release(ctx, l); releaseErr != nil {
+				return claimed, releaseErr
+			}
+
+			return claimed, err
+		}
+
+		m.requests[r.ID] = &done
+		m.record(ctx, ActionGrant, r, &done)
+		granted = true
+	}
+
+	m.queue = waiting
+
+	return claimed, nil
+}
+
+// Wake up everyone waiting on a request. Should not be called without holding
+// the lock.
+func (m *Manager) notify() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
@@ -0,0 +1,84 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/project-safari/zebra"
+)
+
+// RequestType is the resource type of a Request.
+const RequestType = "LeaseRequest"
+
+// States of a Request.
+const (
+	StateWaiting = "waiting"
+	StateGranted = "granted"
+)
+
+var ErrQueuedEmpty = errors.New("queued time is empty")
+
+var ErrStateInvalid = errors.New("request state is invalid")
+
+// A Request is a selector-based lease request waiting in the queue for
+// matching resources to become free. Once granted, it names the lease that
+// was created for it.
+type Request struct {
+	zebra.BaseResource
+	Owner    string         `json:"owner"`
+	Selector Selector       `json:"selector"`
+	Duration zebra.Duration `json:"duration"`
+	Queued   time.Time      `json:"queued"`
+	State    string         `json:"state"`
+	Lease    string         `json:"lease,omitempty"`
+}
+
+// NewRequest returns a waiting request with a new ID for the given owner,
+// selector and lease duration, queued now.
+func NewRequest(owner string, sel Selector, duration time.Duration) *Request {
+	return &Request{
+		BaseResource: zebra.BaseResource{
+			ID:      newID(),
+			Type:    RequestType,
+			Labels:  nil,
+			Version: 0,
+		},
+		Owner:    owner,
+		Selector: sel,
+		Duration: zebra.Duration{Duration: duration},
+		Queued:   time.Now(),
+		State:    StateWaiting,
+		Lease:    "",
+	}
+}
+
+// Validate returns an error if the given Request object has incorrect values.
+// Else, it returns nil.
+func (r *Request) Validate(ctx context.Context) error {
+	switch {
+	case r.Owner == "":
+		return ErrOwnerEmpty
+	case r.Duration.Duration <= 0:
+		return ErrDurationInvalid
+	case r.Queued.IsZero():
+		return ErrQueuedEmpty
+	case r.State != StateWaiting && r.State != StateGranted:
+		return ErrStateInvalid
+	}
+
+	if err := r.Selector.Validate(); err != nil {
+		return err
+	}
+
+	return r.BaseResource.Validate(ctx)
+}
+
+// Return true if r was queued before other.
+func (r *Request) before(other *Request) bool {
+	if r.Queued.Equal(other.Queued) {
+		return r.ID < other.ID
+	}
+
+	return r.Queued.Before(other.Queued)
+}
@@ -0,0 +1,77 @@
+package lease
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/project-safari/zebra/query"
+)
+
+var ErrSelectorType = errors.New("selector type is empty")
+
+var ErrSelectorCount = errors.New("selector count must be greater than 0")
+
+// A Selector asks for Count resources of the given type whose labels match
+// all of the given labels.
+type Selector struct {
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Count  int               `json:"count"`
+}
+
+// Validate returns an error if the given Selector object has incorrect values.
+// Else, it returns nil.
+func (s *Selector) Validate() error {
+	switch {
+	case s.Type == "":
+		return ErrSelectorType
+	case !Leasable(s.Type):
+		return ErrNotLeasable
+	case s.Count <= 0:
+		return ErrSelectorCount
+	}
+
+	return nil
+}
+
+// Return the IDs of all resources in the query store matching the selector,
+// sorted by ID.
+func (s *Selector) match(qs *query.QueryStore) ([]string, error) {
+	matches := map[string]bool{}
+
+	if list := qs.QueryType([]string{s.Type}).Resources[s.Type]; list != nil {
+		for _, res := range list.Resources {
+			matches[res.GetID()] = true
+		}
+	}
+
+	for key, val := range s.Labels {
+		results, err := qs.QueryLabel(query.Query{Op: query.MatchEqual, Key: key, Values: []string{val}})
+		if err != nil {
+			return nil, err
+		}
+
+		labelled := map[string]bool{}
+
+		if list := results.Resources[s.Type]; list != nil {
+			for _, res := range list.Resources {
+				labelled[res.GetID()] = true
+			}
+		}
+
+		for id := range matches {
+			if !labelled[id] {
+				delete(matches, id)
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(matches))
+	for id := range matches {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids, nil
+}
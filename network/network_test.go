@@ -42,9 +42,10 @@ func TestSwitch(t *testing.T) {
 	switch1.Credentials = zebra.Credentials{
 		NamedResource: zebra.NamedResource{
 			BaseResource: zebra.BaseResource{
-				ID:     "blahblah",
-				Type:   "Credentials",
-				Labels: nil,
+				ID:      "blahblah",
+				Type:    "Credentials",
+				Labels:  nil,
+				Version: 0,
 			},
 			Name: "blah",
 		},
@@ -0,0 +1,426 @@
+// Package patch applies JSON Merge Patches, as defined in RFC 7396, and JSON
+// Patches, as defined in RFC 6902, to JSON documents.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Media types of patches.
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// Operations of JSON Patches.
+const (
+	OpAdd     = "add"
+	OpRemove  = "remove"
+	OpReplace = "replace"
+	OpMove    = "move"
+	OpCopy    = "copy"
+	OpTest    = "test"
+)
+
+var ErrOperationInvalid = errors.New("patch operation is not valid")
+
+var ErrPointerInvalid = errors.New("json pointer is not valid")
+
+var ErrPathMissing = errors.New("patch path does not exist")
+
+var ErrTestFailed = errors.New("patch test failed")
+
+// An Operation is one step of a JSON Patch. From is set for the move and copy
+// operations, and Value for the add, replace and test operations.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// ParseOperations returns the operations of the JSON Patch, or an error if any
+// of them is malformed.
+func ParseOperations(data []byte) ([]Operation, error) {
+	ops := []Operation{}
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		if err := op.check(); err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+
+	return ops, nil
+}
+
+// Return an error if the operation is malformed.
+func (op Operation) check() error {
+	if _, err := Tokens(op.Path); err != nil {
+		return err
+	}
+
+	switch op.Op {
+	case OpAdd, OpReplace, OpTest:
+		if len(op.Value) == 0 {
+			return fmt.Errorf("%w: %s requires a value", ErrOperationInvalid, op.Op)
+		}
+	case OpMove, OpCopy:
+		if _, err := Tokens(op.From); err != nil {
+			return fmt.Errorf("%w: %s requires a from pointer", ErrOperationInvalid, op.Op)
+		}
+
+		if op.Op == OpMove && strings.HasPrefix(op.Path, op.From+"/") {
+			return fmt.Errorf("%w: cannot move a value into itself", ErrOperationInvalid)
+		}
+	case OpRemove:
+	default:
+		return fmt.Errorf("%w: unknown op %q", ErrOperationInvalid, op.Op)
+	}
+
+	return nil
+}
+
+// Tokens returns the reference tokens of the JSON Pointer, as defined in RFC
+// 6901. The empty pointer, which refers to the whole document, has none.
+func Tokens(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: %q", ErrPointerInvalid, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	return tokens, nil
+}
+
+// Apply returns the document with the operations applied in order. If any
+// operation fails, none is applied.
+func Apply(doc []byte, ops []Operation) ([]byte, error) {
+	root, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range ops {
+		if root, err = apply(root, op); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", op.Op, op.Path, err)
+		}
+	}
+
+	return json.Marshal(root)
+}
+
+// Merge returns the document with the merge patch applied.
+func Merge(doc []byte, patch []byte) ([]byte, error) {
+	root, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := decode(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(merge(root, p))
+}
+
+// Return target with the merge patch applied.
+func merge(target interface{}, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+		} else {
+			t[key] = merge(t[key], value)
+		}
+	}
+
+	return t
+}
+
+// Return the root of the document with the operation applied.
+func apply(root interface{}, op Operation) (interface{}, error) {
+	path, _ := Tokens(op.Path)
+
+	var value interface{}
+
+	switch op.Op {
+	case OpAdd, OpReplace, OpTest:
+		v, err := decode(op.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		value = v
+	case OpMove, OpCopy:
+		from, _ := Tokens(op.From)
+
+		v, err := get(root, from)
+		if err != nil {
+			return nil, err
+		}
+
+		// Copies must not share maps or slices with the original.
+		if value, err = clone(v); err != nil {
+			return nil, err
+		}
+
+		if op.Op == OpMove {
+			if root, err = remove(root, from); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	switch op.Op {
+	case OpRemove:
+		return remove(root, path)
+	case OpReplace:
+		root, err := remove(root, path)
+		if err != nil {
+			return nil, err
+		}
+
+		return add(root, path, value)
+	case OpTest:
+		v, err := get(root, path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !equal(v, value) {
+			return nil, ErrTestFailed
+		}
+
+		return root, nil
+	default:
+		return add(root, path, value)
+	}
+}
+
+// Return the value at the path.
+func get(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			v, ok := n[token]
+			if !ok {
+				return nil, ErrPathMissing
+			}
+
+			node = v
+		case []interface{}:
+			i, err := index(token, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+
+			node = n[i]
+		default:
+			return nil, ErrPathMissing
+		}
+	}
+
+	return node, nil
+}
+
+// Return node with the value added at the path, replacing any value of an
+// object member and shifting array elements. Adding at the empty path
+// replaces node.
+func add(node interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return update(node, path, func(parent interface{}, token string) (interface{}, error) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			p[token] = value
+
+			return p, nil
+		case []interface{}:
+			if token == "-" {
+				return append(p, value), nil
+			}
+
+			i, err := index(token, len(p))
+			if err != nil {
+				return nil, err
+			}
+
+			p = append(p, nil)
+			copy(p[i+1:], p[i:])
+			p[i] = value
+
+			return p, nil
+		default:
+			return nil, ErrPathMissing
+		}
+	})
+}
+
+// Return node with the value at the path removed. Removing the empty path
+// leaves null.
+func remove(node interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil //nolint:nilnil
+	}
+
+	return update(node, path, func(parent interface{}, token string) (interface{}, error) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := p[token]; !ok {
+				return nil, ErrPathMissing
+			}
+
+			delete(p, token)
+
+			return p, nil
+		case []interface{}:
+			i, err := index(token, len(p)-1)
+			if err != nil {
+				return nil, err
+			}
+
+			return append(p[:i], p[i+1:]...), nil
+		default:
+			return nil, ErrPathMissing
+		}
+	})
+}
+
+// Return node with the parent of the non-empty path replaced by fn applied
+// to it and the last token of the path.
+func update(node interface{}, path []string, fn func(interface{}, string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(node, path[0])
+	}
+
+	child, err := get(node, path[:1])
+	if err != nil {
+		return nil, err
+	}
+
+	child, err = update(child, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		n[path[0]] = child
+	case []interface{}:
+		i, _ := index(path[0], len(n)-1)
+		n[i] = child
+	}
+
+	return node, nil
+}
+
+// Return the array index of the token, which must be from 0 to max.
+func index(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.Trim(token, "0123456789") != "" {
+		return 0, fmt.Errorf("%w: %q is not an array index", ErrPathMissing, token)
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i > max {
+		return 0, fmt.Errorf("%w: index %s is out of range", ErrPathMissing, token)
+	}
+
+	return i, nil
+}
+
+// Return true if the JSON values are equal, comparing numbers by value.
+func equal(a interface{}, b interface{}) bool {
+	switch x := a.(type) {
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+
+		fx, _, errx := big.ParseFloat(string(x), 10, 256, big.ToNearestEven)
+		fy, _, erry := big.ParseFloat(string(y), 10, 256, big.ToNearestEven)
+
+		return errx == nil && erry == nil && fx.Cmp(fy) == 0
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+
+		for key, value := range x {
+			if other, ok := y[key]; !ok || !equal(value, other) {
+				return false
+			}
+		}
+
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+
+		return true
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
+
+// Return a deep copy of the decoded JSON value.
+func clone(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return decode(data)
+}
+
+// Decode the JSON value, keeping numbers as written.
+func decode(data []byte) (interface{}, error) {
+	var v interface{}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
@@ -0,0 +1,137 @@
+package patch_test
+
+import (
+	"testing"
+
+	"github.com/project-safari/zebra/patch"
+	"github.com/stretchr/testify/assert"
+)
+
+// Examples from RFC 7396, appendix A.
+func TestMerge(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	tests := []struct {
+		doc      string
+		patch    string
+		expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{`{"n":18446744073709551615}`, `{"m":1}`, `{"m":1,"n":18446744073709551615}`},
+	}
+
+	for _, test := range tests {
+		merged, err := patch.Merge([]byte(test.doc), []byte(test.patch))
+		assert.Nil(err, test.patch)
+		assert.JSONEq(test.expected, string(merged), test.patch)
+	}
+
+	_, err := patch.Merge([]byte(`{}`), []byte(`{"a":`))
+	assert.NotNil(err)
+}
+
+// Examples from RFC 6902, appendix A.
+func TestApply(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	tests := []struct {
+		doc      string
+		patch    string
+		expected string
+	}{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{
+			`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			`{"foo":["all","grass","cows","eat"]}`,
+			`[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			`{"foo":["all","cows","eat","grass"]}`,
+		},
+		{
+			`{"baz":"qux","foo":["a",2,"c"]}`,
+			`[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`,
+			`{"baz":"qux","foo":["a",2,"c"]}`,
+		},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`,
+			`{"foo":"bar","child":{"grandchild":{}}}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{`{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10}]`, `{"/":9,"~1":10}`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/foo","value":null}]`, `{"foo":null}`},
+		{`{"foo":{"a":1}}`, `[{"op":"copy","from":"/foo","path":"/bar"},{"op":"add","path":"/bar/b","value":2}]`,
+			`{"foo":{"a":1},"bar":{"a":1,"b":2}}`},
+		{`{"foo":"bar"}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+	}
+
+	for _, test := range tests {
+		ops, err := patch.ParseOperations([]byte(test.patch))
+		if !assert.Nil(err, test.patch) {
+			continue
+		}
+
+		patched, err := patch.Apply([]byte(test.doc), ops)
+		assert.Nil(err, test.patch)
+		assert.JSONEq(test.expected, string(patched), test.patch)
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	invalid := []string{
+		`{"op":"add"}`,
+		`[{"op":"add","path":"/a"}]`,
+		`[{"op":"copy","from":"a","path":"/b"}]`,
+		`[{"op":"move","from":"/a","path":"/a/b"}]`,
+		`[{"op":"delete","path":"/a"}]`,
+		`[{"op":"remove","path":"a"}]`,
+	}
+
+	for _, p := range invalid {
+		_, err := patch.ParseOperations([]byte(p))
+		assert.NotNil(err, p)
+	}
+
+	failing := map[string]error{
+		`[{"op":"add","path":"/baz/bat","value":"qux"}]`:                           patch.ErrPathMissing,
+		`[{"op":"remove","path":"/missing"}]`:                                      patch.ErrPathMissing,
+		`[{"op":"replace","path":"/list/3","value":1}]`:                            patch.ErrPathMissing,
+		`[{"op":"add","path":"/list/01","value":1}]`:                               patch.ErrPathMissing,
+		`[{"op":"test","path":"/foo","value":1}]`:                                  patch.ErrTestFailed,
+		`[{"op":"test","path":"/list","value":[1,2]}]`:                             patch.ErrTestFailed,
+		`[{"op":"add","path":"/a","value":1},{"op":"test","path":"/a","value":2}]`: patch.ErrTestFailed,
+	}
+
+	for p, expected := range failing {
+		ops, err := patch.ParseOperations([]byte(p))
+		if !assert.Nil(err, p) {
+			continue
+		}
+
+		_, err = patch.Apply([]byte(`{"foo":"bar","list":[1,2,3]}`), ops)
+		assert.ErrorIs(err, expected, p)
+	}
+}
@@ -0,0 +1,170 @@
+package query
+
+import (
+	"github.com/project-safari/zebra"
+)
+
+// A Filter selects the resources that have one of the IDs, are of one of the
+// types and are selected by the selector. Empty IDs or types and a nil
+// selector select every resource.
+type Filter struct {
+	IDs      []string
+	Types    []string
+	Selector Selector
+}
+
+// Match returns true if the filter selects the resource.
+func (f Filter) Match(res zebra.Resource) bool {
+	if len(f.IDs) > 0 && !isIn(res.GetID(), f.IDs) {
+		return false
+	}
+
+	if len(f.Types) > 0 && !isIn(res.GetType(), f.Types) {
+		return false
+	}
+
+	return f.Selector == nil || f.Selector.Match(res)
+}
+
+// QueryFilter returns the resources that the filter selects. Rather than
+// scanning every resource, it only checks those found by looking up the IDs,
+// the types, or the labels and types the selector requires, whichever are the
+// fewest.
+func (qs *QueryStore) QueryFilter(f Filter) *zebra.ResourceMap {
+	qs.lock.RLock()
+	defer qs.lock.RUnlock()
+
+	candidates := qs.rUUID
+
+	narrow := func(set map[string]zebra.Resource) {
+		if len(set) < len(candidates) {
+			candidates = set
+		}
+	}
+
+	if len(f.IDs) > 0 {
+		set := map[string]zebra.Resource{}
+
+		for _, id := range f.IDs {
+			if res, ok := qs.rUUID[id]; ok {
+				set[id] = res
+			}
+		}
+
+		narrow(set)
+	}
+
+	if len(f.Types) > 0 {
+		narrow(qs.typeIndex(f.Types))
+	}
+
+	if f.Selector != nil {
+		if set, ok := qs.indexed(f.Selector); ok {
+			narrow(set)
+		}
+	}
+
+	results := zebra.NewResourceMap(qs.factory)
+
+	for _, res := range candidates {
+		if f.Match(res) {
+			results.Add(res, res.GetType())
+		}
+	}
+
+	return results
+}
+
+// Return the resources of the given types, by ID. Should not be called
+// without holding the read lock.
+func (qs *QueryStore) typeIndex(types []string) map[string]zebra.Resource {
+	set := map[string]zebra.Resource{}
+
+	for _, t := range types {
+		if list := qs.rType.Resources[t]; list != nil {
+			for _, res := range list.Resources {
+				set[res.GetID()] = res
+			}
+		}
+	}
+
+	return set
+}
+
+// Return the resources that may match the selector, by ID, as found by looking
+// up the labels and types it requires, or false if it does not require any.
+// Should not be called without holding the read lock.
+func (qs *QueryStore) indexed(sel Selector) (map[string]zebra.Resource, bool) {
+	switch s := sel.(type) {
+	case *Requirement:
+		return qs.indexedRequirement(s)
+	case And:
+		// Resources must match every selector, so the fewest candidates of
+		// any one will do.
+		var smallest map[string]zebra.Resource
+
+		for _, child := range s {
+			if set, ok := qs.indexed(child); ok && (smallest == nil || len(set) < len(smallest)) {
+				smallest = set
+			}
+		}
+
+		return smallest, smallest != nil
+	case Or:
+		// Resources may match any selector, so all of them must be indexed.
+		union := map[string]zebra.Resource{}
+
+		for _, child := range s {
+			set, ok := qs.indexed(child)
+			if !ok {
+				return nil, false
+			}
+
+			for id, res := range set {
+				union[id] = res
+			}
+		}
+
+		return union, true
+	}
+
+	return nil, false
+}
+
+// Should not be called without holding the read lock.
+func (qs *QueryStore) indexedRequirement(r *Requirement) (map[string]zebra.Resource, bool) {
+	if r.Op != MatchEqual && r.Op != MatchIn && r.Op != MatchExists {
+		return nil, false
+	}
+
+	switch r.Key.Kind {
+	case KindType:
+		if r.Op == MatchExists {
+			return nil, false
+		}
+
+		return qs.typeIndex(r.Values), true
+	case KindLabel:
+		set := map[string]zebra.Resource{}
+
+		index := qs.rLabel[r.Key.Name]
+		if index == nil {
+			return set, true
+		}
+
+		for val, list := range index.Resources {
+			if r.Op != MatchExists && !isIn(val, r.Values) {
+				continue
+			}
+
+			for _, res := range list.Resources {
+				set[res.GetID()] = res
+			}
+		}
+
+		return set, true
+	case KindProperty:
+	}
+
+	return nil, false
+}
@@ -0,0 +1,58 @@
+package query_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/project-safari/zebra/query"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryFilter(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	qs := query.NewQueryStore(selectorResources())
+	assert.Nil(qs.Initialize())
+
+	parse := func(selector string) query.Selector {
+		sel, err := query.ParseSelector(selector, query.KindLabel)
+		assert.Nil(err)
+
+		return sel
+	}
+
+	tests := []struct {
+		filter   query.Filter
+		expected []string
+	}{
+		{query.Filter{IDs: nil, Types: nil, Selector: nil},
+			[]string{"0100000001", "0100000002", "0100000003", "0200000001"}},
+		{query.Filter{IDs: []string{"0100000001", "0200000001", "0300000001"}, Types: nil, Selector: nil},
+			[]string{"0100000001", "0200000001"}},
+		{query.Filter{IDs: nil, Types: []string{vlan}, Selector: nil},
+			[]string{"0100000001", "0100000002", "0100000003"}},
+		{query.Filter{IDs: []string{"0100000001", "0200000001"}, Types: []string{vlan}, Selector: nil},
+			[]string{"0100000001"}},
+		{query.Filter{IDs: nil, Types: []string{vlan}, Selector: parse("team")},
+			[]string{"0100000001", "0100000002"}},
+		{query.Filter{IDs: nil, Types: []string{ipool}, Selector: parse("team")},
+			[]string{"0200000001"}},
+		{query.Filter{IDs: []string{"0100000002"}, Types: []string{vlan}, Selector: parse("team = perf")},
+			[]string{}},
+		{query.Filter{IDs: nil, Types: nil, Selector: parse("team in (perf, func) && property:RangeEnd != 10")},
+			[]string{"0100000002"}},
+		{query.Filter{IDs: nil, Types: nil, Selector: parse("team = perf || type = IPAddressPool")},
+			[]string{"0100000001", "0200000001"}},
+		{query.Filter{IDs: nil, Types: nil, Selector: parse("team = perf || !temporary")},
+			[]string{"0100000001", "0100000002", "0200000001"}},
+		{query.Filter{IDs: nil, Types: nil, Selector: parse("missing = label")},
+			[]string{}},
+	}
+
+	for _, test := range tests {
+		matched := ids(qs.QueryFilter(test.filter), vlan, ipool)
+		sort.Strings(matched)
+		assert.Equal(test.expected, matched, test.filter)
+	}
+}
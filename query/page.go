@@ -0,0 +1,186 @@
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/project-safari/zebra"
+)
+
+var ErrCursorInvalid = errors.New("cursor is malformed or was returned for another sort order")
+
+// Order sorts resources by the value of a property, the name of a field of
+// the resource structs, and resources with equal values by ID. Numeric values
+// sort before all others, which sort by their string form. Resources without
+// the property sort as if its value were empty. Descending order is the exact
+// reverse. The zero Order sorts by ID.
+type Order struct {
+	Property   string
+	Descending bool
+}
+
+// ParseOrder returns the Order given by a sort parameter: a property name,
+// prefixed with "-" to sort in descending order. The empty string sorts by ID.
+func ParseOrder(s string) Order {
+	return Order{Property: strings.TrimPrefix(s, "-"), Descending: strings.HasPrefix(s, "-")}
+}
+
+// String returns the sort parameter that ParseOrder parses as the Order.
+func (o Order) String() string {
+	if o.Descending {
+		return "-" + o.Property
+	}
+
+	return o.Property
+}
+
+// A Cursor marks the last resource of a page, so that the next page can
+// start after it. Since it holds the sort value of the resource rather than
+// its position, pages neither skip nor repeat resources that were already
+// there when the first page was read, however resources are added or
+// removed in between.
+type Cursor struct {
+	Sort string   `json:"sort"`
+	Num  *float64 `json:"num,omitempty"`
+	Str  string   `json:"str,omitempty"`
+	ID   string   `json:"id"`
+}
+
+// String returns the cursor as an opaque token that ParseCursor parses.
+func (c *Cursor) String() string {
+	contents, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(contents)
+}
+
+// ParseCursor returns the cursor that a token returned by Cursor.String
+// stands for.
+func ParseCursor(token string) (*Cursor, error) {
+	contents, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrCursorInvalid
+	}
+
+	c := new(Cursor)
+	if err := json.Unmarshal(contents, c); err != nil || c.ID == "" {
+		return nil, ErrCursorInvalid
+	}
+
+	return c, nil
+}
+
+// Page returns at most limit resources of the resource map, the first ones
+// after the cursor in the given order, along with the cursor of the page's
+// last resource if more resources follow it. The cursor may be nil to start
+// from the first resource and limit may be 0 for no limit. The resources of
+// each type keep their order in the returned map.
+func Page(resources *zebra.ResourceMap, order Order, after *Cursor, limit int) (*zebra.ResourceMap, *Cursor, error) {
+	if after != nil && after.Sort != order.String() {
+		return nil, nil, ErrCursorInvalid
+	}
+
+	cursors := []*Cursor{}
+	byID := map[string]zebra.Resource{}
+
+	for _, list := range resources.Resources {
+		for _, res := range list.Resources {
+			c := order.cursor(res)
+			if after == nil || order.less(after, c) {
+				cursors = append(cursors, c)
+				byID[res.GetID()] = res
+			}
+		}
+	}
+
+	sort.Slice(cursors, func(i, j int) bool {
+		return order.less(cursors[i], cursors[j])
+	})
+
+	var next *Cursor
+
+	if limit > 0 && len(cursors) > limit {
+		cursors = cursors[:limit]
+		next = cursors[limit-1]
+	}
+
+	page := zebra.NewResourceMap(resources.GetFactory())
+
+	for _, c := range cursors {
+		res := byID[c.ID]
+		page.Add(res, res.GetType())
+	}
+
+	return page, next, nil
+}
+
+// Return the cursor of the resource.
+func (o Order) cursor(res zebra.Resource) *Cursor {
+	c := &Cursor{Sort: o.String(), Num: nil, Str: "", ID: res.GetID()}
+
+	if o.Property == "" {
+		return c
+	}
+
+	value := reflect.ValueOf(res).Elem().FieldByName(o.Property)
+	if value.IsValid() && !value.CanInterface() {
+		// Unexported fields are not properties.
+		return c
+	}
+
+	switch value.Kind() { //nolint:exhaustive
+	case reflect.Invalid:
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		num := float64(value.Int())
+		c.Num = &num
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		num := float64(value.Uint())
+		c.Num = &num
+	case reflect.Float32, reflect.Float64:
+		num := value.Float()
+		c.Num = &num
+	default:
+		c.Str = fmt.Sprint(value.Interface())
+	}
+
+	return c
+}
+
+// Return true if the resource at cursor a sorts before the one at b.
+func (o Order) less(a *Cursor, b *Cursor) bool {
+	cmp := compare(a, b)
+	if cmp == 0 {
+		cmp = strings.Compare(a.ID, b.ID)
+	}
+
+	if o.Descending {
+		return cmp > 0
+	}
+
+	return cmp < 0
+}
+
+// Compare the sort values of the cursors.
+func compare(a *Cursor, b *Cursor) int {
+	switch {
+	case a.Num != nil && b.Num != nil:
+		switch {
+		case *a.Num < *b.Num:
+			return -1
+		case *a.Num > *b.Num:
+			return 1
+		}
+
+		return 0
+	case a.Num != nil:
+		return -1
+	case b.Num != nil:
+		return 1
+	}
+
+	return strings.Compare(a.Str, b.Str)
+}
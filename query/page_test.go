@@ -0,0 +1,106 @@
+package query_test
+
+import (
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/query"
+	"github.com/stretchr/testify/assert"
+)
+
+// Return the IDs of the resources in the map, by type then in list order.
+func ids(resources *zebra.ResourceMap, types ...string) []string {
+	list := []string{}
+
+	for _, t := range types {
+		if resources.Resources[t] == nil {
+			continue
+		}
+
+		for _, res := range resources.Resources[t].Resources {
+			list = append(list, res.GetID())
+		}
+	}
+
+	return list
+}
+
+func TestPage(t *testing.T) { // nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	pool := func(id string, rangeEnd uint16) *network.VLANPool {
+		res := new(network.VLANPool)
+		res.ID = id
+		res.Type = vlan
+		res.RangeEnd = rangeEnd
+
+		return res
+	}
+
+	resources := zebra.NewResourceMap(nil)
+	resources.Add(pool("0100000003", 10), vlan)
+	resources.Add(pool("0100000001", 30), vlan)
+	resources.Add(pool("0100000004", 20), vlan)
+	resources.Add(pool("0100000002", 20), vlan)
+
+	// All at once, by ID.
+	page, next, err := query.Page(resources, query.ParseOrder(""), nil, 0)
+	assert.Nil(err)
+	assert.Nil(next)
+	assert.Equal([]string{"0100000001", "0100000002", "0100000003", "0100000004"}, ids(page, vlan))
+
+	page, next, err = query.Page(resources, query.ParseOrder(""), nil, 2)
+	assert.Nil(err)
+	assert.Equal([]string{"0100000001", "0100000002"}, ids(page, vlan))
+	assert.NotNil(next)
+
+	// Writes between pages move neither the resources already seen nor
+	// those still to come.
+	resources.Delete(pool("0100000002", 20), vlan)
+	resources.Add(pool("0100000000", 10), vlan)
+	resources.Add(pool("0100000005", 10), vlan)
+
+	cursor, err := query.ParseCursor(next.String())
+	assert.Nil(err)
+
+	page, next, err = query.Page(resources, query.ParseOrder(""), cursor, 2)
+	assert.Nil(err)
+	assert.Equal([]string{"0100000003", "0100000004"}, ids(page, vlan))
+
+	page, next, err = query.Page(resources, query.ParseOrder(""), next, 2)
+	assert.Nil(err)
+	assert.Equal([]string{"0100000005"}, ids(page, vlan))
+	assert.Nil(next)
+
+	// By property, with ties broken by ID and resources without the property
+	// last, or first in descending order.
+	other := new(network.IPAddressPool)
+	other.ID = "0200000001"
+	other.Type = ipool
+	resources.Add(other, ipool)
+
+	order := query.ParseOrder("-RangeEnd")
+	assert.Equal("-RangeEnd", order.String())
+
+	page, next, err = query.Page(resources, order, nil, 3)
+	assert.Nil(err)
+	assert.Equal([]string{"0100000001", "0100000004", "0200000001"}, ids(page, vlan, ipool))
+
+	page, _, err = query.Page(resources, order, next, 3)
+	assert.Nil(err)
+	assert.Equal([]string{"0100000005", "0100000003", "0100000000"}, ids(page, vlan, ipool))
+
+	page, _, err = query.Page(resources, query.ParseOrder("RangeEnd"), nil, 0)
+	assert.Nil(err)
+	assert.Equal([]string{"0100000000", "0100000003", "0100000005", "0100000004", "0100000001"}, ids(page, vlan))
+	assert.Equal([]string{"0200000001"}, ids(page, ipool))
+
+	// Cursors only continue the order they were returned for.
+	_, _, err = query.Page(resources, query.ParseOrder(""), next, 3)
+	assert.Equal(query.ErrCursorInvalid, err)
+
+	_, err = query.ParseCursor("not a cursor")
+	assert.Equal(query.ErrCursorInvalid, err)
+}
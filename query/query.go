@@ -17,6 +17,8 @@ const (
 	MatchNotEqual
 	MatchIn
 	MatchNotIn
+	MatchExists
+	MatchNotExists
 )
 
 // Command struct for label queries.
@@ -43,6 +45,8 @@ var ErrResExists = errors.New("called create on resource that already exists")
 
 var ErrResDoesNotExist = errors.New("called update on resource that does not exist")
 
+var ErrVersionConflict = errors.New("resource was changed since the given version")
+
 // Return new query store pointer given resource map.
 func NewQueryStore(resources *zebra.ResourceMap) *QueryStore {
 	querystore := &QueryStore{
@@ -128,11 +132,18 @@ func (qs *QueryStore) Load() (*zebra.ResourceMap, error) {
 	return resources, nil
 }
 
-// Create a resource. If a resource with this ID already exists, return error.
+// Create a resource at version 1. If a resource with this ID already exists,
+// return error.
 func (qs *QueryStore) Create(res zebra.Resource) error {
 	qs.lock.Lock()
 	defer qs.lock.Unlock()
 
+	if _, exists := qs.rUUID[res.GetID()]; exists {
+		return ErrResExists
+	}
+
+	res.SetVersion(1)
+
 	return qs.create(res)
 }
 
@@ -167,6 +178,13 @@ func (qs *QueryStore) create(res zebra.Resource) error {
 
 // Update a resource. Return error if resource does not exist.
 func (qs *QueryStore) Update(res zebra.Resource) error {
+	return qs.UpdateIf(res, 0)
+}
+
+// UpdateIf updates a resource if its current version is the given version, or
+// whatever its version if version is 0, and moves it to the next version.
+// Otherwise it returns ErrVersionConflict.
+func (qs *QueryStore) UpdateIf(res zebra.Resource, version uint64) error {
 	qs.lock.Lock()
 	defer qs.lock.Unlock()
 
@@ -182,8 +200,15 @@ func (qs *QueryStore) Update(res zebra.Resource) error {
 		return ErrResDoesNotExist
 	}
 
+	current := oldRes.GetVersion()
+	if version != 0 && version != current {
+		return ErrVersionConflict
+	}
+
 	_ = qs.delete(oldRes)
 
+	res.SetVersion(current + 1)
+
 	_ = qs.create(res)
 
 	return nil
@@ -191,6 +216,13 @@ func (qs *QueryStore) Update(res zebra.Resource) error {
 
 // Delete a resource.
 func (qs *QueryStore) Delete(res zebra.Resource) error {
+	return qs.DeleteIf(res, 0)
+}
+
+// DeleteIf deletes a resource if its current version is the given version, or
+// whatever its version if version is 0. Otherwise it returns
+// ErrVersionConflict.
+func (qs *QueryStore) DeleteIf(res zebra.Resource, version uint64) error {
 	qs.lock.Lock()
 	defer qs.lock.Unlock()
 
@@ -198,6 +230,10 @@ func (qs *QueryStore) Delete(res zebra.Resource) error {
 		return err
 	}
 
+	if oldRes, exists := qs.rUUID[res.GetID()]; exists && version != 0 && version != oldRes.GetVersion() {
+		return ErrVersionConflict
+	}
+
 	return qs.delete(res)
 }
 
@@ -315,13 +351,25 @@ func (qs *QueryStore) QueryProperty(query Query) (*zebra.ResourceMap, error) {
 	}
 }
 
+// Return resources that the selector selects.
+func (qs *QueryStore) QuerySelector(sel Selector) *zebra.ResourceMap {
+	return qs.QueryFilter(Filter{IDs: nil, Types: nil, Selector: sel})
+}
+
 func (qs *QueryStore) labelMatch(query Query, inVals bool) (*zebra.ResourceMap, error) {
 	results := zebra.NewResourceMap(qs.factory)
 
+	// No resource has this label.
+	if qs.rLabel[query.Key] == nil {
+		return results, nil
+	}
+
 	if inVals {
 		for _, val := range query.Values {
-			for _, res := range qs.rLabel[query.Key].Resources[val].Resources {
-				results.Add(res, res.GetType())
+			if resList := qs.rLabel[query.Key].Resources[val]; resList != nil {
+				for _, res := range resList.Resources {
+					results.Add(res, res.GetType())
+				}
 			}
 		}
 
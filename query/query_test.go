@@ -182,6 +182,13 @@ func TestCreateAndUpdate(t *testing.T) {
 
 	res, err = querystore.QueryLabel(query.Query{Op: query.MatchEqual, Key: "stagetest", Values: []string{"dev"}})
 	assert.True(err == nil && len(res.Resources) == 1 && res.Resources[vlan].Resources[0].GetID() == "0200000001")
+
+	// Unknown label keys and values match nothing.
+	res, err = querystore.QueryLabel(query.Query{Op: query.MatchEqual, Key: "stagetest", Values: []string{"qa"}})
+	assert.True(err == nil && len(res.Resources) == 0)
+
+	res, err = querystore.QueryLabel(query.Query{Op: query.MatchNotIn, Key: "unknown", Values: []string{"qa"}})
+	assert.True(err == nil && len(res.Resources) == 0)
 }
 
 func TestDelete(t *testing.T) {
@@ -228,6 +235,38 @@ func TestDelete(t *testing.T) {
 	assert.True(retRes[vlan].Resources[0] == resource1)
 }
 
+func TestVersions(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	resource1, resource2 := getResources()
+
+	querystore := query.NewQueryStore(zebra.NewResourceMap(nil))
+	assert.Nil(querystore.Initialize())
+
+	assert.Nil(querystore.Create(resource1))
+	assert.Nil(querystore.Create(resource2))
+	assert.Equal(uint64(1), resource1.Version)
+
+	updated, _ := getResources()
+	updated.RangeEnd = 20
+
+	assert.Nil(querystore.UpdateIf(updated, 1))
+	assert.Equal(uint64(2), updated.Version)
+
+	// Writes based on older versions fail and leave the resource as it was.
+	stale, _ := getResources()
+	assert.Equal(query.ErrVersionConflict, querystore.UpdateIf(stale, 1))
+	assert.Equal(query.ErrVersionConflict, querystore.DeleteIf(stale, 1))
+	assert.Equal(updated, querystore.QueryUUID([]string{"0100000001"}).Resources[vlan].Resources[0])
+
+	assert.Nil(querystore.Update(stale))
+	assert.Equal(uint64(3), stale.Version)
+
+	assert.Nil(querystore.DeleteIf(stale, 3))
+	assert.Nil(querystore.QueryUUID([]string{"0100000001"}).Resources[vlan])
+}
+
 func TestQuery(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
@@ -390,9 +429,10 @@ func getResources() (*network.VLANPool, *network.IPAddressPool) {
 	// Create VLANPool resource
 	resource1 := &network.VLANPool{
 		BaseResource: zebra.BaseResource{
-			ID:     "0100000001",
-			Type:   vlan,
-			Labels: map[string]string{"product-owner": "shravya"},
+			ID:      "0100000001",
+			Type:    vlan,
+			Labels:  map[string]string{"product-owner": "shravya"},
+			Version: 0,
 		},
 		RangeStart: 0,
 		RangeEnd:   10,
@@ -409,6 +449,7 @@ func getResources() (*network.VLANPool, *network.IPAddressPool) {
 				"product-owner": "nandyala",
 				"team":          "cloud networking",
 			},
+			Version: 0,
 		},
 		Subnets: []net.IPNet{{IP: ipaddress, Mask: mask}},
 	}
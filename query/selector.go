@@ -0,0 +1,434 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/project-safari/zebra"
+)
+
+// A Kind tells what a selector key refers to.
+type Kind uint8
+
+const (
+	KindLabel Kind = iota
+	KindProperty
+	KindType
+)
+
+// Prefixes that qualify selector keys, and the key that stands for the
+// resource type.
+const (
+	labelPrefix    = "label:"
+	propertyPrefix = "property:"
+	typeKey        = "type"
+)
+
+// Characters that end unquoted keys and values.
+const special = `=!&|,()"`
+
+// A Selector selects resources.
+type Selector interface {
+	Match(res zebra.Resource) bool
+}
+
+// A SyntaxError is returned by ParseSelector for an invalid selector. Pos is
+// the byte offset in the selector at which the error was found.
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+// A Key names the label, property or type that a requirement applies to.
+type Key struct {
+	Kind Kind
+	Name string
+}
+
+// Return the value of the key for the resource, and whether it has one.
+func (k Key) value(res zebra.Resource) (string, bool) {
+	switch k.Kind {
+	case KindType:
+		return res.GetType(), true
+	case KindLabel:
+		val, ok := res.GetLabels()[k.Name]
+
+		return val, ok
+	case KindProperty:
+		field := reflect.ValueOf(res).Elem().FieldByName(k.Name)
+		if !field.IsValid() || !field.CanInterface() {
+			return "", false
+		}
+
+		if field.Kind() == reflect.String {
+			return field.String(), true
+		}
+
+		return fmt.Sprint(field.Interface()), true
+	}
+
+	return "", false
+}
+
+// A Requirement selects resources by the value of a key. Op is MatchEqual,
+// MatchNotEqual, MatchIn or MatchNotIn, which match resources that have the
+// key with a value that is, or is not, among Values, or MatchExists and
+// MatchNotExists, which match resources that have, or do not have, the key.
+type Requirement struct {
+	Key    Key
+	Op     Operator
+	Values []string
+}
+
+func (r *Requirement) Match(res zebra.Resource) bool {
+	val, ok := r.Key.value(res)
+
+	switch r.Op {
+	case MatchEqual, MatchIn:
+		return ok && isIn(val, r.Values)
+	case MatchNotEqual, MatchNotIn:
+		return !ok || !isIn(val, r.Values)
+	case MatchExists:
+		return ok
+	case MatchNotExists:
+		return !ok
+	}
+
+	return false
+}
+
+// And selects resources that all of its selectors select.
+type And []Selector
+
+func (a And) Match(res zebra.Resource) bool {
+	for _, s := range a {
+		if !s.Match(res) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Or selects resources that any of its selectors select.
+type Or []Selector
+
+func (o Or) Match(res zebra.Resource) bool {
+	for _, s := range o {
+		if s.Match(res) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseSelector parses a selector such as
+//
+//	owner = jean-luc, (team in (perf, func) || !temporary)
+//
+// A selector is a list of requirements on keys, combined with "&&" or ","
+// for AND and "||" for OR, where AND binds tighter, and grouped with
+// parentheses. A requirement is one of
+//
+//	key = value
+//	key != value
+//	key in (value, ...)
+//	key notin (value, ...)
+//	key
+//	!key
+//
+// where the last two select resources that have, or do not have, the key.
+// Keys prefixed with "label:" or "property:" name a label or a property, the
+// name of a field of the resource structs, and "type" stands for the
+// resource type. Other keys are of the given kind. Keys and values may be
+// quoted with double quotes, and must be if they contain spaces or any of
+// the characters =!&|,()".
+func ParseSelector(input string, kind Kind) (Selector, error) {
+	p := &parser{input: input, pos: 0, kind: kind}
+
+	s, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.skipSpace(); p.pos < len(p.input) {
+		return nil, p.errorf("unexpected %q", p.input[p.pos])
+	}
+
+	return s, nil
+}
+
+type parser struct {
+	input string
+	pos   int
+	kind  Kind
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Pos: p.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// Consume tok if the input continues with it after spaces.
+func (p *parser) accept(tok string) bool {
+	p.skipSpace()
+
+	if strings.HasPrefix(p.input[p.pos:], tok) {
+		p.pos += len(tok)
+
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) expect(tok string) error {
+	if !p.accept(tok) {
+		return p.errorf("expected %q", tok)
+	}
+
+	return nil
+}
+
+func (p *parser) or() (Selector, error) {
+	s, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	or := Or{s}
+
+	for p.accept("||") {
+		s, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+
+		or = append(or, s)
+	}
+
+	if len(or) == 1 {
+		return s, nil
+	}
+
+	return or, nil
+}
+
+func (p *parser) and() (Selector, error) {
+	s, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+
+	and := And{s}
+
+	for p.accept("&&") || p.accept(",") {
+		s, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+
+		and = append(and, s)
+	}
+
+	if len(and) == 1 {
+		return s, nil
+	}
+
+	return and, nil
+}
+
+func (p *parser) term() (Selector, error) {
+	if p.accept("(") {
+		s, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+
+		return s, p.expect(")")
+	}
+
+	if p.accept("!") {
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+
+		return &Requirement{Key: key, Op: MatchNotExists, Values: nil}, nil
+	}
+
+	key, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+
+	req := &Requirement{Key: key, Op: MatchExists, Values: nil}
+
+	switch {
+	case p.accept("!="):
+		req.Op = MatchNotEqual
+	case p.accept("="):
+		req.Op = MatchEqual
+	case p.acceptWord("in"):
+		req.Op = MatchIn
+	case p.acceptWord("notin"):
+		req.Op = MatchNotIn
+	default:
+		return req, nil
+	}
+
+	if req.Op == MatchEqual || req.Op == MatchNotEqual {
+		val, err := p.word("value")
+		if err != nil {
+			return nil, err
+		}
+
+		req.Values = []string{val}
+
+		return req, nil
+	}
+
+	req.Values, err = p.list()
+
+	return req, err
+}
+
+// Consume the word w if the input continues with it as a whole word.
+func (p *parser) acceptWord(w string) bool {
+	start := p.pos
+
+	p.skipSpace()
+
+	if word, end := p.scanWord(); word == w && end > p.pos {
+		p.pos = end
+
+		return true
+	}
+
+	p.pos = start
+
+	return false
+}
+
+// Parse a parenthesized, comma separated list of values.
+func (p *parser) list() ([]string, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	values := []string{}
+
+	for {
+		val, err := p.word("value")
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, val)
+
+		if !p.accept(",") {
+			break
+		}
+	}
+
+	return values, p.expect(")")
+}
+
+func (p *parser) key() (Key, error) {
+	p.skipSpace()
+	quoted := p.pos < len(p.input) && p.input[p.pos] == '"'
+
+	name, err := p.word("key")
+	if err != nil {
+		return Key{}, err
+	}
+
+	// Prefixes are only recognized outside quotes.
+	if quoted {
+		return Key{Kind: p.kind, Name: name}, nil
+	}
+
+	switch {
+	case name == typeKey:
+		return Key{Kind: KindType, Name: name}, nil
+	case strings.HasPrefix(name, labelPrefix):
+		return Key{Kind: KindLabel, Name: strings.TrimPrefix(name, labelPrefix)}, nil
+	case strings.HasPrefix(name, propertyPrefix):
+		return Key{Kind: KindProperty, Name: strings.TrimPrefix(name, propertyPrefix)}, nil
+	}
+
+	return Key{Kind: p.kind, Name: name}, nil
+}
+
+// Parse a key or value, quoted or not. What names it in errors.
+func (p *parser) word(what string) (string, error) {
+	p.skipSpace()
+
+	if p.pos < len(p.input) && p.input[p.pos] == '"' {
+		return p.quoted()
+	}
+
+	word, end := p.scanWord()
+	if word == "" {
+		if p.pos == len(p.input) {
+			return "", p.errorf("expected %s, found end of selector", what)
+		}
+
+		return "", p.errorf("expected %s, found %q", what, p.input[p.pos])
+	}
+
+	p.pos = end
+
+	return word, nil
+}
+
+// Return the unquoted word at the current position and where it ends.
+func (p *parser) scanWord() (string, int) {
+	end := p.pos
+	for end < len(p.input) && !unicode.IsSpace(rune(p.input[end])) && !strings.ContainsRune(special, rune(p.input[end])) {
+		end++
+	}
+
+	return p.input[p.pos:end], end
+}
+
+// Parse a double quoted string, in which a backslash escapes the next
+// character.
+func (p *parser) quoted() (string, error) {
+	start := p.pos
+
+	var b strings.Builder
+
+	for p.pos++; p.pos < len(p.input); p.pos++ {
+		switch c := p.input[p.pos]; c {
+		case '\\':
+			if p.pos++; p.pos == len(p.input) {
+				break
+			}
+
+			b.WriteByte(p.input[p.pos])
+		case '"':
+			p.pos++
+
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	p.pos = start
+
+	return "", p.errorf("unterminated quoted string")
+}
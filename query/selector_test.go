@@ -0,0 +1,112 @@
+package query_test
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/query"
+	"github.com/stretchr/testify/assert"
+)
+
+func selectorResources() *zebra.ResourceMap {
+	pool := func(id string, rangeEnd uint16, labels map[string]string) *network.VLANPool {
+		res := new(network.VLANPool)
+		res.ID = id
+		res.Type = vlan
+		res.Labels = labels
+		res.RangeEnd = rangeEnd
+
+		return res
+	}
+
+	resources := zebra.NewResourceMap(nil)
+	resources.Add(pool("0100000001", 10, map[string]string{"owner": "jean-luc", "team": "perf"}), vlan)
+	resources.Add(pool("0100000002", 20, map[string]string{"owner": "shravya", "team": "func"}), vlan)
+	resources.Add(pool("0100000003", 30, map[string]string{"owner": "nandyala", "temporary": "yes"}), vlan)
+
+	_, addresses := getResources()
+	resources.Add(addresses, ipool)
+
+	return resources
+}
+
+func TestParseSelector(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	qs := query.NewQueryStore(selectorResources())
+	assert.Nil(qs.Initialize())
+
+	tests := []struct {
+		selector string
+		kind     query.Kind
+		expected []string
+	}{
+		{"owner = jean-luc", query.KindLabel, []string{"0100000001"}},
+		{"owner=jean-luc", query.KindLabel, []string{"0100000001"}},
+		{"owner != jean-luc", query.KindLabel, []string{"0100000002", "0100000003", "0200000001"}},
+		{"owner in (shravya, nandyala)", query.KindLabel, []string{"0100000002", "0100000003"}},
+		{"owner notin (shravya,nandyala)", query.KindLabel, []string{"0100000001", "0200000001"}},
+		{"temporary", query.KindLabel, []string{"0100000003"}},
+		{"!temporary", query.KindLabel, []string{"0100000001", "0100000002", "0200000001"}},
+		{"team = perf || team = func", query.KindLabel, []string{"0100000001", "0100000002"}},
+		{"team = perf, owner = shravya", query.KindLabel, []string{}},
+		{"team = perf && owner = jean-luc", query.KindLabel, []string{"0100000001"}},
+		// AND binds tighter than OR, unless parentheses say otherwise.
+		{"temporary || team = perf && owner = shravya", query.KindLabel, []string{"0100000003"}},
+		{"(temporary || team = perf) && owner != shravya", query.KindLabel, []string{"0100000001", "0100000003"}},
+		{`"product-owner" = "nandyala"`, query.KindLabel, []string{"0200000001"}},
+		{`team = "cloud networking"`, query.KindLabel, []string{"0200000001"}},
+		{`team = "cloud \"networking\""`, query.KindLabel, []string{}},
+		{"RangeEnd in (10, 30)", query.KindProperty, []string{"0100000001", "0100000003"}},
+		{"Type = IPAddressPool", query.KindProperty, []string{"0200000001"}},
+		{"RangeEnd", query.KindProperty, []string{"0100000001", "0100000002", "0100000003"}},
+		{"type = VLANPool, label:team = perf", query.KindProperty, []string{"0100000001"}},
+		{"property:RangeEnd = 20 || owner = nandyala", query.KindLabel, []string{"0100000002", "0100000003"}},
+		{"type notin (VLANPool)", query.KindLabel, []string{"0200000001"}},
+	}
+
+	for _, test := range tests {
+		sel, err := query.ParseSelector(test.selector, test.kind)
+		assert.Nil(err, test.selector)
+
+		matched := ids(qs.QuerySelector(sel), vlan, ipool)
+		sort.Strings(matched)
+		assert.Equal(test.expected, matched, test.selector)
+	}
+}
+
+func TestSelectorSyntaxError(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	tests := []struct {
+		selector string
+		pos      int
+		msg      string
+	}{
+		{"", 0, "expected key, found end of selector"},
+		{"owner =", 7, "expected value, found end of selector"},
+		{"owner in shravya", 9, `expected "("`},
+		{"owner in (shravya", 17, `expected ")"`},
+		{"(owner = shravya", 16, `expected ")"`},
+		{"owner = shravya)", 15, `unexpected ')'`},
+		{"owner == shravya", 7, `expected value, found '='`},
+		{"owner = shravya &&", 18, "expected key, found end of selector"},
+		{`owner = "shravya`, 8, "unterminated quoted string"},
+	}
+
+	for _, test := range tests {
+		sel, err := query.ParseSelector(test.selector, query.KindLabel)
+		assert.Nil(sel, test.selector)
+
+		syntaxErr := new(query.SyntaxError)
+		if assert.True(errors.As(err, &syntaxErr), test.selector) {
+			assert.Equal(test.pos, syntaxErr.Pos, test.selector)
+			assert.Equal(test.msg, syntaxErr.Msg, test.selector)
+		}
+	}
+}
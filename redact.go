@@ -0,0 +1,91 @@
+package zebra
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Redacted is shown in place of the values of secrets, as described in
+// IsSecret.
+const Redacted = "********"
+
+// Names of the JSON fields holding the credential keys of Credentials and the
+// password hash of a User.
+const (
+	credentialKeysField = "Keys"
+	passwordHashField   = "passwordHash"
+)
+
+// IsSecret returns true if the values within the JSON field with the given
+// name are secrets, as credential keys and password hashes are.
+func IsSecret(name string) bool {
+	return name == credentialKeysField || name == passwordHashField
+}
+
+// MarshalRedacted returns the JSON encoding of v with its secrets hidden, for
+// showing it to clients. The values of credential keys are replaced with
+// Redacted, so that clients can still tell which keys are set, and password
+// hashes, which no client needs, are left out.
+func MarshalRedacted(v interface{}) ([]byte, error) {
+	contents, err := MarshalRevealed(v)
+	if err != nil {
+		return nil, err
+	}
+
+	contents, _, err = MapCredentialKeys(contents, func(string) (string, error) {
+		return Redacted, nil
+	})
+
+	return contents, err
+}
+
+// MarshalRevealed returns the JSON encoding of v with the values of its
+// credential keys but without password hashes, for showing credentials to
+// clients allowed to reveal them.
+func MarshalRevealed(v interface{}) ([]byte, error) {
+	contents, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	decoder.UseNumber()
+
+	var object interface{}
+	if err := decoder.Decode(&object); err != nil {
+		return nil, err
+	}
+
+	if !dropPasswordHashes(object) {
+		return contents, nil
+	}
+
+	return json.Marshal(object)
+}
+
+// Remove all password hash fields from the decoded JSON value, and return
+// true if any were found.
+func dropPasswordHashes(value interface{}) bool {
+	found := false
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for name, field := range value {
+			if name == passwordHashField {
+				delete(value, name)
+
+				found = true
+
+				continue
+			}
+
+			found = dropPasswordHashes(field) || found
+		}
+	case []interface{}:
+		for _, item := range value {
+			found = dropPasswordHashes(item) || found
+		}
+	}
+
+	return found
+}
@@ -0,0 +1,40 @@
+package zebra_test
+
+import (
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMarshalRedacted tests that credential keys are redacted and password
+// hashes left out, however deeply they are nested.
+func TestMarshalRedacted(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	creds := new(zebra.Credentials)
+	creds.ID = "0100000001"
+	creds.Type = "Credentials"
+	creds.Keys = map[string]string{"password": "Riddikulus!42"}
+
+	user := new(zebra.User)
+	user.ID = "0100000002"
+	user.Type = "User"
+	user.Name = "shravya"
+	assert.Nil(user.SetPassword("Riddikulus!42"))
+
+	v := map[string]interface{}{"resources": []zebra.Resource{creds, user}}
+
+	contents, err := zebra.MarshalRedacted(v)
+	assert.Nil(err)
+	assert.Contains(string(contents), `"password":"`+zebra.Redacted+`"`)
+	assert.Contains(string(contents), `"name":"shravya"`)
+	assert.NotContains(string(contents), "Riddikulus!42")
+	assert.NotContains(string(contents), "passwordHash")
+
+	contents, err = zebra.MarshalRevealed(v)
+	assert.Nil(err)
+	assert.Contains(string(contents), `"password":"Riddikulus!42"`)
+	assert.NotContains(string(contents), "passwordHash")
+}
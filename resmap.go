@@ -2,11 +2,13 @@ package zebra
 
 import (
 	"encoding/json"
+	"sort"
 )
 
 type ResourceFactory interface {
 	New(resourceType string) Resource
 	Add(resourceType string, factory func() Resource) ResourceFactory
+	Types() []string
 }
 
 type typeMap map[string]func() Resource
@@ -28,6 +30,20 @@ func (t typeMap) Add(resourceType string, factory func() Resource) ResourceFacto
 	return t
 }
 
+// Types returns the names of the types added to the resource factory, in
+// alphabetical order.
+func (t typeMap) Types() []string {
+	types := make([]string, 0, len(t))
+
+	for resourceType := range t {
+		types = append(types, resourceType)
+	}
+
+	sort.Strings(types)
+
+	return types
+}
+
 func Factory() ResourceFactory {
 	return typeMap{}
 }
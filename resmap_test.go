@@ -18,6 +18,9 @@ func TestAddNew(t *testing.T) {
 	f.Add("Switch", func() zebra.Resource { return new(network.Switch) })
 	assert.NotNil(f.New("Switch"))
 	assert.Nil(f.New("random"))
+
+	f.Add("IPAddressPool", func() zebra.Resource { return new(network.IPAddressPool) })
+	assert.Equal([]string{"IPAddressPool", "Switch"}, f.Types())
 }
 
 func TestNewResourceList(t *testing.T) {
@@ -56,9 +59,10 @@ func TestListMarshalUnmarshal(t *testing.T) {
 
 	vlan := &network.VLANPool{
 		BaseResource: zebra.BaseResource{
-			ID:     "0100001",
-			Type:   "invalid",
-			Labels: nil,
+			ID:      "0100001",
+			Type:    "invalid",
+			Labels:  nil,
+			Version: 0,
 		},
 		RangeStart: 0,
 		RangeEnd:   10,
@@ -191,9 +195,10 @@ func TestMapMarshalUnMarshal(t *testing.T) {
 
 	vlan := &network.VLANPool{
 		BaseResource: zebra.BaseResource{
-			ID:     "0100001",
-			Type:   "VLANPool",
-			Labels: nil,
+			ID:      "0100001",
+			Type:    "VLANPool",
+			Labels:  nil,
+			Version: 0,
 		},
 		RangeStart: 0,
 		RangeEnd:   10,
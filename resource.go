@@ -1,8 +1,11 @@
 package zebra
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 	"unicode"
 )
@@ -14,6 +17,8 @@ type Resource interface {
 	GetID() string
 	GetType() string
 	GetLabels() Labels
+	GetVersion() uint64
+	SetVersion(version uint64)
 }
 
 var ErrNameEmpty = errors.New("name is empty")
@@ -34,12 +39,15 @@ var ErrPassSpecial = errors.New("password does not contain a special character")
 
 var ErrNoKeys = errors.New("keys is nil")
 
+var ErrKeyUnknown = errors.New("credential key must be a password or an ssh-key")
+
 // BaseResource must be embedded in all resource structs, ensuring each resource is
 // assigned an ID string.
 type BaseResource struct {
-	ID     string `json:"id"`
-	Type   string `json:"type"`
-	Labels Labels `json:"labels,omitempty"`
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Labels  Labels `json:"labels,omitempty"`
+	Version uint64 `json:"version,omitempty"`
 }
 
 // Validate returns an error if the given BaseResource object has incorrect values.
@@ -77,6 +85,17 @@ func (r *BaseResource) GetLabels() Labels {
 	return dest
 }
 
+// Return version of BaseResource r. Stores start resources at version 1 and
+// move them to the next version with every update.
+func (r *BaseResource) GetVersion() uint64 {
+	return r.Version
+}
+
+// Set version of BaseResource r.
+func (r *BaseResource) SetVersion(version uint64) {
+	r.Version = version
+}
+
 // NamedResource represents all resources assigned both a string ID and a name.
 type NamedResource struct {
 	BaseResource
@@ -107,7 +126,11 @@ func (c *Credentials) Validate(ctx context.Context) error {
 	keyValidators := map[string]func(string) error{"password": ValidatePassword, "ssh-key": ValidateSSHKey}
 
 	for keyType, key := range c.Keys {
-		v := keyValidators[keyType]
+		v, ok := keyValidators[keyType]
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrKeyUnknown, keyType)
+		}
+
 		if err := v(key); err != nil {
 			return err
 		}
@@ -120,6 +143,85 @@ func (c *Credentials) Validate(ctx context.Context) error {
 	return c.NamedResource.Validate(ctx)
 }
 
+// MapCredentialKeys applies fn to the values of all credential keys, the
+// "Keys" objects of Credentials, in the JSON encoded resource and returns the
+// resulting JSON, along with whether any credential keys were found.
+func MapCredentialKeys(contents []byte, fn func(string) (string, error)) ([]byte, bool, error) {
+	return MapNamedCredentialKeys(contents, func(_ string, value string) (string, error) {
+		return fn(value)
+	})
+}
+
+// MapNamedCredentialKeys is like MapCredentialKeys, but fn is given the name
+// of each credential key along with its value.
+func MapNamedCredentialKeys(contents []byte, fn func(string, string) (string, error)) ([]byte, bool, error) {
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	decoder.UseNumber()
+
+	var object interface{}
+	if err := decoder.Decode(&object); err != nil {
+		return nil, false, err
+	}
+
+	found, err := walkKeys(object, fn)
+	if err != nil || !found {
+		return contents, found, err
+	}
+
+	contents, err = json.Marshal(object)
+
+	return contents, true, err
+}
+
+// Apply fn to the names and values of all "Keys" objects within the decoded
+// JSON value.
+func walkKeys(value interface{}, fn func(string, string) (string, error)) (bool, error) {
+	found := false
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for name, field := range value {
+			if keys, ok := field.(map[string]interface{}); ok && name == credentialKeysField {
+				found = true
+
+				for k, v := range keys {
+					s, ok := v.(string)
+					if !ok {
+						continue
+					}
+
+					mapped, err := fn(k, s)
+					if err != nil {
+						return found, err
+					}
+
+					keys[k] = mapped
+				}
+
+				continue
+			}
+
+			ok, err := walkKeys(field, fn)
+			if err != nil {
+				return found, err
+			}
+
+			found = found || ok
+		}
+	case []interface{}:
+		for _, item := range value {
+			ok, err := walkKeys(item, fn)
+			if err != nil {
+				return found, err
+			}
+
+			found = found || ok
+		}
+	}
+
+	return found, nil
+}
+
 // Check to make sure password follows rules.
 // 1. At least 12 characters long.
 // 2. Contains upper and lowercase letters.
@@ -158,9 +260,3 @@ func ValidatePassword(password string) error { //nolint:cyclop
 
 	return nil
 }
-
-// TO BE IMPLEMENTED AT A LATER TIME.
-// Check to make sure SSH key follows specified rules.
-func ValidateSSHKey(key string) error {
-	return nil
-}
@@ -17,9 +17,10 @@ func TestBaseResource(t *testing.T) {
 
 	ctx := context.Background()
 	res := &zebra.BaseResource{
-		ID:     "",
-		Type:   "",
-		Labels: zebra.Labels{"key": "value"},
+		ID:      "",
+		Type:    "",
+		Labels:  zebra.Labels{"key": "value"},
+		Version: 0,
 	}
 	assert.NotNil(res.Validate(ctx))
 
@@ -43,9 +44,10 @@ func TestNamedResource(t *testing.T) {
 	ctx := context.Background()
 	res := &zebra.NamedResource{
 		BaseResource: zebra.BaseResource{
-			ID:     "",
-			Type:   "",
-			Labels: zebra.Labels{"key": "value"},
+			ID:      "",
+			Type:    "",
+			Labels:  zebra.Labels{"key": "value"},
+			Version: 0,
 		},
 		Name: "",
 	}
@@ -74,9 +76,10 @@ func TestCredentials(t *testing.T) {
 	credentials := zebra.Credentials{
 		NamedResource: zebra.NamedResource{
 			BaseResource: zebra.BaseResource{
-				ID:     "",
-				Type:   "Credentials",
-				Labels: zebra.Labels{},
+				ID:      "",
+				Type:    "Credentials",
+				Labels:  zebra.Labels{},
+				Version: 0,
 			},
 			Name: "",
 		},
@@ -113,5 +116,11 @@ func TestCredentials(t *testing.T) {
 	assert.NotNil(credentials.Validate(ctx))
 
 	credentials.Keys["password"] = "properPass123$"
+	assert.NotNil(credentials.Validate(ctx))
+
+	credentials.Keys["ssh-key"] = ed25519Key
 	assert.Nil(credentials.Validate(ctx))
+
+	credentials.Keys["enable"] = "properPass123$"
+	assert.ErrorIs(credentials.Validate(ctx), zebra.ErrKeyUnknown)
 }
@@ -0,0 +1,316 @@
+// Package schema describes resource types with JSON Schemas generated from
+// their Go structs, so that clients can build forms for resources and
+// validate them before sending them. The schemas follow the rules that
+// encoding/json applies to the structs: fields are named by their json tags,
+// and the fields of embedded structs are promoted into the outer object.
+// Whether a resource is valid is decided by its Validate method, which
+// schemas cannot follow, so they only require what every resource needs: its
+// "id" and "type".
+package schema
+
+import (
+	"encoding"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/project-safari/zebra"
+)
+
+// Draft is the JSON Schema dialect of the generated schemas.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Names of the fields holding the password hash of a user, which is never
+// shown to clients, and the password they send instead, which the server
+// hashes.
+const (
+	passwordHashField = "passwordHash"
+	passwordField     = "password"
+)
+
+// A Schema is a JSON Schema. Only the keywords needed to describe Go values
+// are included.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Const                string             `json:"const,omitempty"`
+	Minimum              *int64             `json:"minimum,omitempty"`
+	Maximum              *int64             `json:"maximum,omitempty"`
+	WriteOnly            bool               `json:"writeOnly,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+//nolint:gochecknoglobals
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	jsonMarshaler  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshaler  = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	// Least and greatest values of integer kinds. A greatest value of 0
+	// stands for none that fits in an int64.
+	integerLimits = map[reflect.Kind][2]int64{
+		reflect.Int8:   {math.MinInt8, math.MaxInt8},
+		reflect.Int16:  {math.MinInt16, math.MaxInt16},
+		reflect.Int32:  {math.MinInt32, math.MaxInt32},
+		reflect.Uint:   {0, 0},
+		reflect.Uint8:  {0, math.MaxUint8},
+		reflect.Uint16: {0, math.MaxUint16},
+		reflect.Uint32: {0, math.MaxUint32},
+		reflect.Uint64: {0, 0},
+	}
+)
+
+// Resource returns the schema of resources of the given type, as created by
+// res. The schema is titled with the type name, requires the "id" and "type"
+// fields, which zebra.BaseResource.Validate checks for every resource, and
+// requires the "type" field to hold the type name. A "passwordHash" field is
+// described as the write-only "password" field that clients send in its
+// place.
+func Resource(resType string, res zebra.Resource) *Schema {
+	s := For(reflect.TypeOf(res))
+	s.Schema = Draft
+	s.Title = resType
+
+	if _, ok := s.Properties[passwordHashField]; ok {
+		delete(s.Properties, passwordHashField)
+
+		s.Properties[passwordField] = Type("string")
+		s.Properties[passwordField].WriteOnly = true
+	}
+
+	for _, name := range []string{"id", "type"} {
+		if _, ok := s.Properties[name]; ok {
+			s.Required = append(s.Required, name)
+		}
+	}
+
+	if t, ok := s.Properties["type"]; ok {
+		t.Const = resType
+	}
+
+	return s
+}
+
+// Return a schema of the given type and format. An empty type allows any
+// value.
+func newSchema(typ string, format string) *Schema {
+	return &Schema{
+		Schema:               "",
+		Ref:                  "",
+		Title:                "",
+		Type:                 typ,
+		Format:               format,
+		Const:                "",
+		Minimum:              nil,
+		Maximum:              nil,
+		WriteOnly:            false,
+		Items:                nil,
+		Properties:           nil,
+		AdditionalProperties: nil,
+		Required:             nil,
+		OneOf:                nil,
+	}
+}
+
+// Type returns a schema of values of the given JSON type, such as "string".
+func Type(typ string) *Schema {
+	return newSchema(typ, "")
+}
+
+// Ref returns a schema that refers to the schema at the given URI.
+func Ref(uri string) *Schema {
+	s := newSchema("", "")
+	s.Ref = uri
+
+	return s
+}
+
+// OneOf returns a schema of values that match exactly one of the schemas.
+func OneOf(schemas ...*Schema) *Schema {
+	s := newSchema("", "")
+	s.OneOf = schemas
+
+	return s
+}
+
+// Array returns the schema of arrays of items.
+func Array(items *Schema) *Schema {
+	s := newSchema("array", "")
+	s.Items = items
+
+	return s
+}
+
+// Map returns the schema of objects whose properties are all values.
+func Map(values *Schema) *Schema {
+	s := newSchema("object", "")
+	s.AdditionalProperties = values
+
+	return s
+}
+
+// For returns the schema of the JSON encoding of values of type t.
+func For(t reflect.Type) *Schema {
+	return of(t, map[reflect.Type]bool{})
+}
+
+// Return the schema of type t. Struct types in seen are being described
+// already, and are described as any value to end recursion.
+func of(t reflect.Type, seen map[reflect.Type]bool) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return newSchema("string", "date-time")
+	case t == rawMessageType:
+		return newSchema("", "")
+	case t.Implements(jsonMarshaler) || reflect.PtrTo(t).Implements(jsonMarshaler):
+		return newSchema("", "")
+	case t.Implements(textMarshaler) || reflect.PtrTo(t).Implements(textMarshaler):
+		return newSchema("string", "")
+	}
+
+	switch t.Kind() { //nolint:exhaustive
+	case reflect.Bool:
+		return newSchema("boolean", "")
+	case reflect.String:
+		return newSchema("string", "")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return integer(t.Kind())
+	case reflect.Float32, reflect.Float64:
+		return newSchema("number", "")
+	case reflect.Slice, reflect.Array:
+		// Byte slices are encoded as base64 strings.
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return newSchema("string", "byte")
+		}
+
+		return Array(of(t.Elem(), seen))
+	case reflect.Map:
+		return Map(of(t.Elem(), seen))
+	case reflect.Struct:
+		if seen[t] {
+			return newSchema("", "")
+		}
+
+		seen[t] = true
+		defer delete(seen, t)
+
+		return object(t, seen)
+	}
+
+	// Interfaces may hold any value.
+	return newSchema("", "")
+}
+
+// Return the schema of an integer of the given kind.
+func integer(kind reflect.Kind) *Schema {
+	s := newSchema("integer", "")
+
+	if limits, ok := integerLimits[kind]; ok {
+		min := limits[0]
+		s.Minimum = &min
+
+		if max := limits[1]; max != 0 {
+			s.Maximum = &max
+		}
+	}
+
+	return s
+}
+
+// A field of a struct, as encoding/json sees it.
+type field struct {
+	name   string
+	depth  int
+	schema *Schema
+}
+
+// Return the schema of a struct type.
+func object(t reflect.Type, seen map[reflect.Type]bool) *Schema {
+	s := newSchema("object", "")
+	s.Properties = map[string]*Schema{}
+
+	// As in encoding/json, the shallowest field with a name wins.
+	found := map[string]field{}
+
+	for _, f := range fields(t, 0, seen) {
+		if other, ok := found[f.name]; !ok || f.depth < other.depth {
+			found[f.name] = f
+		}
+	}
+
+	for name, f := range found {
+		s.Properties[name] = f.schema
+	}
+
+	return s
+}
+
+// Return the fields of a struct type at the given depth of embedding,
+// including those promoted from embedded structs.
+func fields(t reflect.Type, depth int, seen map[reflect.Type]bool) []field {
+	list := []field{}
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+
+		ft := sf.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			list = append(list, fields(ft, depth+1, seen)...)
+
+			continue
+		}
+
+		if !sf.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		s := of(sf.Type, seen)
+		if hasOption(opts, "string") {
+			s = newSchema("string", "")
+		}
+
+		list = append(list, field{name: name, depth: depth, schema: s})
+	}
+
+	return list
+}
+
+// Return true if the comma separated json tag options include opt.
+func hasOption(opts string, opt string) bool {
+	for _, o := range strings.Split(opts, ",") {
+		if o == opt {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,91 @@
+package schema_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResource(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	s := schema.Resource("Switch", new(network.Switch))
+	assert.Equal(schema.Draft, s.Schema)
+	assert.Equal("Switch", s.Title)
+	assert.Equal("object", s.Type)
+	assert.Equal("Switch", s.Properties["type"].Const)
+	assert.Equal([]string{"id", "type"}, s.Required)
+
+	// Fields of embedded structs are promoted, while other structs nest.
+	assert.Equal("object", s.Properties["labels"].Type)
+	assert.Equal("string", s.Properties["labels"].AdditionalProperties.Type)
+	assert.Equal("integer", s.Properties["version"].Type)
+	assert.Equal("string", s.Properties["managementIP"].Type)
+	assert.Equal(int64(0), *s.Properties["numPorts"].Minimum)
+	assert.Equal(int64(4294967295), *s.Properties["numPorts"].Maximum)
+
+	credentials := s.Properties["credentials"]
+	assert.Empty(credentials.Required)
+	assert.Equal("", credentials.Properties["type"].Const)
+	assert.Equal("string", credentials.Properties["Keys"].AdditionalProperties.Type)
+}
+
+func TestResourceUser(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	// Clients send passwords, and never see the hashes stored for them.
+	s := schema.Resource("User", new(zebra.User))
+	assert.NotContains(s.Properties, "passwordHash")
+	assert.Equal("string", s.Properties["password"].Type)
+	assert.True(s.Properties["password"].WriteOnly)
+	assert.Equal("string", s.Properties["role"].Type)
+}
+
+type inner struct {
+	Name  string `json:"name"`
+	Shade string `json:"shade"`
+}
+
+type node struct {
+	inner
+	Shade    int             `json:"shade,omitempty"`
+	Hidden   string          `json:"-"`
+	Count    int64           `json:"count,string"`
+	Created  time.Time       `json:"created"`
+	Children []*node         `json:"children,omitempty"`
+	Extra    json.RawMessage `json:"extra,omitempty"`
+	Data     []byte          `json:"data,omitempty"`
+	Untagged bool
+	private  string
+}
+
+func TestFor(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	s := schema.For(reflect.TypeOf(node{private: ""}))
+	assert.Len(s.Properties, 8)
+	assert.Empty(s.Required)
+
+	// The shallower of two fields with the same name wins.
+	assert.Equal("integer", s.Properties["shade"].Type)
+	assert.Equal("string", s.Properties["name"].Type)
+	assert.Equal("string", s.Properties["count"].Type)
+	assert.Equal("date-time", s.Properties["created"].Format)
+	assert.Equal("boolean", s.Properties["Untagged"].Type)
+	assert.Equal("byte", s.Properties["data"].Format)
+	assert.Equal("", s.Properties["extra"].Type)
+
+	// Recursive types end in a schema that allows any value.
+	assert.Equal("array", s.Properties["children"].Type)
+	assert.Equal("", s.Properties["children"].Items.Type)
+	assert.Nil(s.Properties["children"].Items.Properties)
+}
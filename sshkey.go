@@ -0,0 +1,227 @@
+package zebra
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+var ErrSSHKeyEmpty = errors.New("ssh key is empty")
+
+var ErrSSHKeyPrivate = errors.New("ssh key is a private key, only public keys may be stored")
+
+var ErrSSHKeyFormat = errors.New("ssh key is not a single line in OpenSSH authorized_keys format")
+
+var ErrSSHKeyType = errors.New("ssh key type is not supported, use rsa, ed25519 or ecdsa")
+
+var ErrSSHKeyEncoding = errors.New("ssh key data is not valid base64")
+
+var ErrSSHKeyMalformed = errors.New("ssh key data is malformed")
+
+var ErrSSHKeyMismatch = errors.New("ssh key data does not match its type")
+
+var ErrSSHKeySize = errors.New("ssh key is too small, rsa keys must be at least 2048 bits")
+
+// Smallest RSA modulus accepted, in bits.
+const minRSAKeyBits = 2048
+
+const ed25519KeyLen = 32
+
+// Curves of the supported ECDSA key types, by the curve name in the key.
+var sshCurves = map[string]elliptic.Curve{ //nolint:gochecknoglobals
+	"nistp256": elliptic.P256(),
+	"nistp384": elliptic.P384(),
+	"nistp521": elliptic.P521(),
+}
+
+// Check to make sure SSH key follows specified rules.
+// 1. It is a single public key in OpenSSH authorized_keys format, that is
+// an optional list of options, the key type, the base64 encoded key and an
+// optional comment.
+// 2. The key type is ssh-rsa, ssh-ed25519 or ecdsa-sha2-nistp256, -nistp384
+// or -nistp521, and matches the type encoded in the key.
+// 3. RSA keys are at least 2048 bits long.
+func ValidateSSHKey(key string) error {
+	key = strings.TrimSpace(key)
+
+	switch {
+	case key == "":
+		return ErrSSHKeyEmpty
+	case strings.Contains(key, "PRIVATE KEY"), strings.HasPrefix(key, "PuTTY-User-Key-File"):
+		return ErrSSHKeyPrivate
+	case strings.ContainsAny(key, "\r\n"):
+		return ErrSSHKeyFormat
+	}
+
+	fields := sshKeyFields(key)
+
+	// The options, if any, are a single field before the key type.
+	i := 0
+	if len(fields) > 2 && !isSSHKeyType(fields[0]) && isSSHKeyType(fields[1]) {
+		i = 1
+	}
+
+	if len(fields) < i+2 { //nolint:gomnd
+		return ErrSSHKeyFormat
+	}
+
+	keyType := fields[i]
+	if !isSSHKeyType(keyType) {
+		return ErrSSHKeyType
+	}
+
+	data, err := base64.StdEncoding.DecodeString(fields[i+1])
+	if err != nil {
+		return ErrSSHKeyEncoding
+	}
+
+	return validateSSHKeyData(keyType, data)
+}
+
+// Return true if keyType is one of the supported key types.
+func isSSHKeyType(keyType string) bool {
+	if keyType == "ssh-rsa" || keyType == "ssh-ed25519" {
+		return true
+	}
+
+	_, ok := sshCurves[strings.TrimPrefix(keyType, "ecdsa-sha2-")]
+
+	return ok && strings.HasPrefix(keyType, "ecdsa-sha2-")
+}
+
+// Split an authorized_keys line into fields separated by spaces or tabs,
+// except inside double quotes, which may appear in the options.
+func sshKeyFields(line string) []string {
+	fields := []string{}
+	quoted := false
+	start := -1
+
+	for i, char := range line {
+		switch {
+		case char == '"':
+			quoted = !quoted
+		case (char == ' ' || char == '\t') && !quoted:
+			if start >= 0 {
+				fields = append(fields, line[start:i])
+				start = -1
+			}
+
+			continue
+		}
+
+		if start < 0 {
+			start = i
+		}
+	}
+
+	if start >= 0 {
+		fields = append(fields, line[start:])
+	}
+
+	return fields
+}
+
+// Check the SSH wire format encoding (RFC 4253, section 6.6) of a public key
+// of the given type.
+func validateSSHKeyData(keyType string, data []byte) error {
+	name, data, ok := sshString(data)
+	if !ok {
+		return ErrSSHKeyMalformed
+	}
+
+	if string(name) != keyType {
+		return ErrSSHKeyMismatch
+	}
+
+	switch keyType {
+	case "ssh-rsa":
+		return validateRSAKey(data)
+	case "ssh-ed25519":
+		return validateEd25519Key(data)
+	default:
+		return validateECDSAKey(strings.TrimPrefix(keyType, "ecdsa-sha2-"), data)
+	}
+}
+
+// An RSA key holds the public exponent and the modulus as mpints.
+func validateRSAKey(data []byte) error {
+	e, data, ok := sshString(data)
+	if !ok {
+		return ErrSSHKeyMalformed
+	}
+
+	n, data, ok := sshString(data)
+	if !ok || len(data) != 0 {
+		return ErrSSHKeyMalformed
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if exponent.Cmp(big.NewInt(3)) < 0 || exponent.Bit(0) == 0 { //nolint:gomnd
+		return ErrSSHKeyMalformed
+	}
+
+	if new(big.Int).SetBytes(n).BitLen() < minRSAKeyBits {
+		return ErrSSHKeySize
+	}
+
+	return nil
+}
+
+// An Ed25519 key holds the 32 byte public key.
+func validateEd25519Key(data []byte) error {
+	key, data, ok := sshString(data)
+	if !ok || len(data) != 0 {
+		return ErrSSHKeyMalformed
+	}
+
+	if len(key) != ed25519KeyLen {
+		return ErrSSHKeyMismatch
+	}
+
+	return nil
+}
+
+// An ECDSA key holds the curve name and the public point, which must be on
+// the curve.
+func validateECDSAKey(curveName string, data []byte) error {
+	name, data, ok := sshString(data)
+	if !ok {
+		return ErrSSHKeyMalformed
+	}
+
+	point, data, ok := sshString(data)
+	if !ok || len(data) != 0 {
+		return ErrSSHKeyMalformed
+	}
+
+	if !bytes.Equal(name, []byte(curveName)) {
+		return ErrSSHKeyMismatch
+	}
+
+	if x, _ := elliptic.Unmarshal(sshCurves[curveName], point); x == nil { //nolint:staticcheck
+		return ErrSSHKeyMalformed
+	}
+
+	return nil
+}
+
+// Read a length-prefixed string from data and return it along with the rest
+// of data. Return false if data is too short.
+func sshString(data []byte) ([]byte, []byte, bool) {
+	if len(data) < 4 { //nolint:gomnd
+		return nil, nil, false
+	}
+
+	length := binary.BigEndian.Uint32(data)
+	data = data[4:]
+
+	if uint64(length) > uint64(len(data)) {
+		return nil, nil, false
+	}
+
+	return data[:length], data[length:], true
+}
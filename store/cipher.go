@@ -0,0 +1,316 @@
+package store
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Length of the keys in a key file and of the data keys, in bytes.
+const keyLen = 32
+
+// Prefix of an encrypted value, which is followed by the ID of the key that
+// wrapped its data key, the wrapped data key and the encrypted value, each
+// separated by "$".
+const sealedPrefix = "aes256-gcm$"
+
+var ErrKeyFileEmpty = errors.New("key file holds no keys")
+
+var ErrKeyInvalid = errors.New("key must be 32 bytes long")
+
+var ErrKeyUnknown = errors.New("value was encrypted with a key that is not in the key file")
+
+var ErrSealedInvalid = errors.New("encrypted value is malformed")
+
+var ErrCipherMissing = errors.New("store holds encrypted values but no key file is configured")
+
+// A Cipher encrypts credential values with envelope encryption. Each value
+// is encrypted with AES-GCM under its own random data key, and the data key
+// is in turn encrypted under the cipher's primary key, so that rotating keys
+// only needs the data keys to be encrypted again. Values encrypted under any
+// of the cipher's keys can be decrypted. Each value is bound to the ID of the
+// resource and the name of the credential key holding it, and does not
+// decrypt if copied to another resource or key.
+type Cipher struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// Return new Cipher pointer that encrypts with the first of the given keys
+// and decrypts with any of them.
+func NewCipher(keys ...[]byte) (*Cipher, error) {
+	if len(keys) == 0 {
+		return nil, ErrKeyFileEmpty
+	}
+
+	c := &Cipher{primary: keyID(keys[0]), keys: make(map[string]cipher.AEAD, len(keys))}
+
+	for _, key := range keys {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+
+		c.keys[keyID(key)] = aead
+	}
+
+	return c, nil
+}
+
+// GenerateKey returns a new random key.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, keyLen)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// ReadKeyFile returns the keys in the key file at the given path, which
+// holds one base64 encoded key per line, the primary key first.
+func ReadKeyFile(path string) ([][]byte, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := [][]byte{}
+
+	for _, line := range strings.Split(string(contents), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+
+		key, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(key) != keyLen {
+			return nil, ErrKeyInvalid
+		}
+
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrKeyFileEmpty
+	}
+
+	return keys, nil
+}
+
+// WriteKeyFile replaces the key file at the given path with one holding the
+// given keys, readable only by its owner.
+func WriteKeyFile(path string, keys ...[]byte) error {
+	var contents bytes.Buffer
+
+	for _, key := range keys {
+		contents.WriteString(base64.StdEncoding.EncodeToString(key))
+		contents.WriteString("\n")
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(path), "temp_")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if err := file.Chmod(0o600); err != nil { //nolint:gomnd
+		return err
+	}
+
+	if _, err := file.Write(contents.Bytes()); err != nil {
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+// LoadCipher returns a Cipher for the keys in the key file at the given path.
+func LoadCipher(path string) (*Cipher, error) {
+	keys, err := ReadKeyFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewCipher(keys...)
+}
+
+// Encrypt returns the value of the named credential key of the resource with
+// the given ID, encrypted under a new data key, which is itself encrypted
+// under the primary key.
+func (c *Cipher) Encrypt(value string, id string, name string) (string, error) {
+	dataKey, err := GenerateKey()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	sealedValue, err := seal(data, []byte(value), binding(id, name))
+	if err != nil {
+		return "", err
+	}
+
+	return c.wrap(dataKey, sealedValue)
+}
+
+// Decrypt returns the value that Encrypt returned the given encrypted value
+// for, given the same resource ID and key name. Values that are not
+// encrypted are returned unchanged.
+func (c *Cipher) Decrypt(value string, id string, name string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+
+	dataKey, sealedValue, err := c.unwrap(value)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	plain, err := open(data, sealedValue, binding(id, name))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plain), nil
+}
+
+// Rewrap returns the value with its data key encrypted under the primary
+// key instead of the key it was encrypted under. The value itself is not
+// encrypted again. Values that are not encrypted yet are encrypted for the
+// named credential key of the resource with the given ID.
+func (c *Cipher) Rewrap(value string, id string, name string) (string, error) {
+	if !IsSealed(value) {
+		return c.Encrypt(value, id, name)
+	}
+
+	dataKey, sealedValue, err := c.unwrap(value)
+	if err != nil {
+		return "", err
+	}
+
+	return c.wrap(dataKey, sealedValue)
+}
+
+// IsSealed returns true if the value was encrypted by a Cipher.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
+
+// Encrypt the data key under the primary key and join it with the value
+// sealed by the data key.
+func (c *Cipher) wrap(dataKey []byte, sealedValue []byte) (string, error) {
+	wrapped, err := seal(c.keys[c.primary], dataKey, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return sealedPrefix + c.primary + "$" + base64.RawStdEncoding.EncodeToString(wrapped) + "$" +
+		base64.RawStdEncoding.EncodeToString(sealedValue), nil
+}
+
+// Split an encrypted value into its decrypted data key and the value sealed
+// by the data key.
+func (c *Cipher) unwrap(value string) ([]byte, []byte, error) {
+	value = strings.TrimPrefix(value, sealedPrefix)
+
+	parts := strings.Split(value, "$")
+	if len(parts) != 3 { //nolint:gomnd
+		return nil, nil, ErrSealedInvalid
+	}
+
+	kek, ok := c.keys[parts[0]]
+	if !ok {
+		return nil, nil, ErrKeyUnknown
+	}
+
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, ErrSealedInvalid
+	}
+
+	sealedValue, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, ErrSealedInvalid
+	}
+
+	dataKey, err := open(kek, wrapped, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return dataKey, sealedValue, nil
+}
+
+// Return the additional data that binds a value to the ID of the resource
+// and the name of the credential key holding it. The two are separated by a
+// NUL byte, which neither contains.
+func binding(id string, name string) []byte {
+	return []byte(id + "\x00" + name)
+}
+
+// Return the ID that encrypted values use to name the key that wrapped their
+// data key.
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+
+	return hex.EncodeToString(sum[:4])
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != keyLen {
+		return nil, ErrKeyInvalid
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Encrypt plain under a random nonce, authenticating aad along with it, and
+// return the nonce followed by the ciphertext.
+func seal(aead cipher.AEAD, plain []byte, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plain, aad), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrSealedInvalid
+	}
+
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], aad)
+}
@@ -0,0 +1,196 @@
+package store_test
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCipher(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	_, err := store.NewCipher()
+	assert.Equal(store.ErrKeyFileEmpty, err)
+
+	_, err = store.NewCipher([]byte("short"))
+	assert.Equal(store.ErrKeyInvalid, err)
+
+	oldKey, err := store.GenerateKey()
+	assert.Nil(err)
+
+	newKey, err := store.GenerateKey()
+	assert.Nil(err)
+
+	oldCipher, err := store.NewCipher(oldKey)
+	assert.Nil(err)
+
+	sealed, err := oldCipher.Encrypt("properPass123$", "0100000001", "password")
+	assert.Nil(err)
+	assert.True(store.IsSealed(sealed))
+	assert.NotContains(sealed, "properPass123$")
+
+	plain, err := oldCipher.Decrypt(sealed, "0100000001", "password")
+	assert.Nil(err)
+	assert.Equal("properPass123$", plain)
+
+	// Values do not decrypt when copied to another resource or key.
+	_, err = oldCipher.Decrypt(sealed, "0100000002", "password")
+	assert.NotNil(err)
+
+	_, err = oldCipher.Decrypt(sealed, "0100000001", "enable")
+	assert.NotNil(err)
+
+	// Values that are not encrypted are left alone.
+	plain, err = oldCipher.Decrypt("properPass123$", "0100000001", "password")
+	assert.Nil(err)
+	assert.Equal("properPass123$", plain)
+
+	// Rewrapping moves the value to the new key.
+	both, err := store.NewCipher(newKey, oldKey)
+	assert.Nil(err)
+
+	rewrapped, err := both.Rewrap(sealed, "0100000001", "password")
+	assert.Nil(err)
+	assert.Equal(strings.Split(sealed, "$")[3], strings.Split(rewrapped, "$")[3])
+
+	newCipher, err := store.NewCipher(newKey)
+	assert.Nil(err)
+
+	_, err = newCipher.Decrypt(sealed, "0100000001", "password")
+	assert.Equal(store.ErrKeyUnknown, err)
+
+	plain, err = newCipher.Decrypt(rewrapped, "0100000001", "password")
+	assert.Nil(err)
+	assert.Equal("properPass123$", plain)
+
+	// Tampered values do not decrypt.
+	_, err = newCipher.Decrypt(rewrapped[:len(rewrapped)-2]+"AA", "0100000001", "password")
+	assert.NotNil(err)
+
+	_, err = newCipher.Decrypt("aes256-gcm$nonsense", "0100000001", "password")
+	assert.Equal(store.ErrSealedInvalid, err)
+}
+
+func TestKeyFile(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	path := "testkeyfile"
+	t.Cleanup(func() { os.Remove(path) })
+
+	_, err := store.LoadCipher(path)
+	assert.True(os.IsNotExist(err))
+
+	key1, err := store.GenerateKey()
+	assert.Nil(err)
+
+	key2, err := store.GenerateKey()
+	assert.Nil(err)
+
+	assert.Nil(store.WriteKeyFile(path, key1, key2))
+
+	info, err := os.Stat(path)
+	assert.Nil(err)
+	assert.Equal(os.FileMode(0o600), info.Mode().Perm())
+
+	keys, err := store.ReadKeyFile(path)
+	assert.Nil(err)
+	assert.Equal([][]byte{key1, key2}, keys)
+
+	assert.Nil(os.WriteFile(path, []byte("\n"), 0o600))
+
+	_, err = store.LoadCipher(path)
+	assert.Equal(store.ErrKeyFileEmpty, err)
+
+	assert.Nil(os.WriteFile(path, []byte("c2hvcnQ=\n"), 0o600))
+
+	_, err = store.LoadCipher(path)
+	assert.Equal(store.ErrKeyInvalid, err)
+}
+
+func TestEncryptedStore(t *testing.T) { // nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "teststore8"
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	types := zebra.Factory().Add("Switch", func() zebra.Resource { return new(network.Switch) })
+
+	sw := new(network.Switch)
+	sw.ID = "0100000001"
+	sw.Type = "Switch"
+	sw.ManagementIP = net.ParseIP("10.0.0.1")
+	sw.SerialNumber = "FDO1234"
+	sw.Model = "N9K"
+	sw.NumPorts = 48
+	sw.Credentials.ID = "0100000002"
+	sw.Credentials.Type = "Credentials"
+	sw.Credentials.Name = "admin"
+	sw.Credentials.Keys = map[string]string{"password": "properPass123$"}
+
+	oldKey, err := store.GenerateKey()
+	assert.Nil(err)
+
+	oldCipher, err := store.NewCipher(oldKey)
+	assert.Nil(err)
+
+	fs := store.NewFileStore(root, types)
+	fs.SetCipher(oldCipher)
+	assert.Nil(fs.Initialize())
+	assert.Nil(fs.Create(sw))
+
+	contents, err := os.ReadFile(root + "/resources/01/00000001")
+	assert.Nil(err)
+	assert.NotContains(string(contents), "properPass123$")
+	assert.Contains(string(contents), `"numPorts":48`)
+
+	resources, err := fs.Load()
+	assert.Nil(err)
+	assert.Equal(sw, resources.Resources["Switch"].Resources[0])
+
+	// Encrypted values do not load from another resource's file.
+	assert.Nil(os.WriteFile(root+"/resources/01/00000003", contents, 0o600))
+
+	_, err = fs.Load()
+	assert.NotNil(err)
+	assert.Nil(os.Remove(root + "/resources/01/00000003"))
+
+	// Without the key, the store does not load.
+	_, err = store.NewFileStore(root, types).Load()
+	assert.Equal(store.ErrCipherMissing, err)
+
+	// Rotate to a new key.
+	newKey, err := store.GenerateKey()
+	assert.Nil(err)
+
+	both, err := store.NewCipher(newKey, oldKey)
+	assert.Nil(err)
+
+	fs.SetCipher(both)
+	assert.Nil(fs.Rewrap())
+
+	newCipher, err := store.NewCipher(newKey)
+	assert.Nil(err)
+
+	fs.SetCipher(newCipher)
+
+	resources, err = fs.Load()
+	assert.Nil(err)
+	assert.Equal(sw, resources.Resources["Switch"].Resources[0])
+
+	fs.SetCipher(oldCipher)
+
+	_, err = fs.Load()
+	assert.Equal(store.ErrKeyUnknown, err)
+
+	// Without a cipher, rewrapping is not possible.
+	assert.Equal(store.ErrCipherMissing, store.NewFileStore(root, types).Rewrap())
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/project-safari/zebra"
+)
+
+var ErrIDDuplicate = errors.New("resource id appears more than once")
+
+// A Failure names a resource that could not be imported and why.
+type Failure struct {
+	ID   string
+	Type string
+	Err  error
+}
+
+func (f Failure) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"id": f.ID, "type": f.Type, "error": f.Err.Error()})
+}
+
+// ImportError is returned by Import when any resource cannot be imported. It
+// lists every such resource, sorted by ID.
+type ImportError []Failure
+
+func (e ImportError) Error() string {
+	return fmt.Sprintf("import failed for %d resources", len(e))
+}
+
+// Import stores all resources in the resource map, or none of them. Nothing is
+// stored if any resource is invalid, is listed under a type other than its
+// own, or has the ID of a stored resource or of another resource in the map;
+// an ImportError lists all such resources instead.
+func (f *FileStore) Import(resMap *zebra.ResourceMap) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	resources := []zebra.Resource{}
+	failures := ImportError{}
+	seen := map[string]bool{}
+
+	for resType, list := range resMap.Resources {
+		for _, res := range list.Resources {
+			if err := f.checkImport(resType, res, seen); err != nil {
+				failures = append(failures, Failure{ID: res.GetID(), Type: resType, Err: err})
+			}
+
+			seen[res.GetID()] = true
+			resources = append(resources, res)
+		}
+	}
+
+	if len(failures) > 0 {
+		sort.SliceStable(failures, func(i, j int) bool {
+			return failures[i].ID < failures[j].ID
+		})
+
+		return failures
+	}
+
+	for i, res := range resources {
+		if err := f.create(res); err != nil {
+			// Roll back to leave the store as it was.
+			for _, created := range resources[:i] {
+				_ = f.delete(created)
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Return why the resource listed under resType cannot be imported, if it
+// cannot. Should not be called without holding the write lock.
+func (f *FileStore) checkImport(resType string, res zebra.Resource, seen map[string]bool) error {
+	if res.GetType() != resType {
+		return ErrTypeInvalid
+	}
+
+	if err := validate(res); err != nil {
+		return err
+	}
+
+	if seen[res.GetID()] {
+		return ErrIDDuplicate
+	}
+
+	if f.exists(res) {
+		return ErrFileExists
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package store_test
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImport(t *testing.T) { // nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	t.Cleanup(func() { os.RemoveAll("teststore9") })
+
+	types := zebra.Factory().Add(vlan, func() zebra.Resource { return new(network.VLANPool) })
+
+	filestore := store.NewFileStore("teststore9", types)
+	assert.Nil(filestore.Initialize())
+
+	pool := func(id string) *network.VLANPool {
+		res := new(network.VLANPool)
+		res.ID = id
+		res.Type = vlan
+		res.RangeEnd = 10
+
+		return res
+	}
+
+	assert.Nil(filestore.Create(pool("0100000001")))
+
+	// One bad resource and nothing is stored.
+	resMap := zebra.NewResourceMap(types)
+	resMap.Add(pool("0100000002"), vlan)
+	resMap.Add(pool("0100000001"), vlan)
+	resMap.Add(pool("0100000003"), vlan)
+	resMap.Add(pool("0100000003"), vlan)
+	invalid := pool("0100000004")
+	invalid.RangeStart = 20
+	resMap.Add(invalid, vlan)
+	resMap.Add(pool("0100000005"), "Switch")
+
+	err := filestore.Import(resMap)
+
+	var failures store.ImportError
+
+	assert.True(errors.As(err, &failures))
+	assert.Len(failures, 4)
+	assert.Equal("0100000001", failures[0].ID)
+	assert.Equal(store.ErrFileExists, failures[0].Err)
+	assert.Equal(store.ErrIDDuplicate, failures[1].Err)
+	assert.Equal("0100000004", failures[2].ID)
+	assert.Equal(network.ErrInvalidRange, failures[2].Err)
+	assert.Equal("0100000005", failures[3].ID)
+	assert.Equal(store.ErrTypeInvalid, failures[3].Err)
+
+	loaded, err := filestore.Load()
+	assert.Nil(err)
+	assert.Len(loaded.Resources[vlan].Resources, 1)
+
+	// Otherwise everything is.
+	resMap = zebra.NewResourceMap(types)
+	resMap.Add(pool("0100000002"), vlan)
+	resMap.Add(pool("0100000003"), vlan)
+	assert.Nil(filestore.Import(resMap))
+
+	loaded, err = filestore.Load()
+	assert.Nil(err)
+	assert.Len(loaded.Resources[vlan].Resources, 3)
+
+	// Failures are listed by ID in JSON.
+	contents, err := failures[0].MarshalJSON()
+	assert.Nil(err)
+	assert.Contains(string(contents), `"id":"0100000001"`)
+	assert.True(strings.HasPrefix(failures.Error(), "import failed for 4"))
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -8,6 +9,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"sync"
 	"syscall"
 
@@ -19,6 +21,7 @@ type FileStore struct {
 	lock        sync.Mutex
 	storageRoot string
 	factory     zebra.ResourceFactory
+	cipher      *Cipher
 }
 
 var ErrTypeInvalid = errors.New("resource type invalid")
@@ -37,6 +40,10 @@ var ErrNoType = errors.New("resource has no type field")
 
 var ErrFactoryNil = errors.New("resource factory is nil for filestore")
 
+var ErrIDInvalid = errors.New("resource id must not contain '/', '\\' or '..'")
+
+var ErrVersionConflict = errors.New("resource was changed since the given version")
+
 // Return new FileStore pointer set with storageRoot root, lock, and map of type
 // name keys with corresponding constructor function values.
 func NewFileStore(root string, resourceFactory zebra.ResourceFactory) *FileStore {
@@ -44,9 +51,20 @@ func NewFileStore(root string, resourceFactory zebra.ResourceFactory) *FileStore
 		lock:        sync.Mutex{},
 		storageRoot: root,
 		factory:     resourceFactory,
+		cipher:      nil,
 	}
 }
 
+// SetCipher sets the cipher that the values of credential keys are encrypted
+// with when stored, and decrypted with when loaded. Without a cipher they are
+// stored in plain text.
+func (f *FileStore) SetCipher(c *Cipher) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.cipher = c
+}
+
 // Initialize store given path. Path is relative to current file location.
 // If folders already exist, do nothing (existing store is unchanged).
 func (f *FileStore) Initialize() error {
@@ -143,6 +161,13 @@ func (f *FileStore) Load() (*zebra.ResourceMap, error) {
 				continue
 			}
 
+			contents, err = f.decryptKeys(subdir.Name()+file.Name(), contents)
+			if err != nil {
+				retErr = err
+
+				continue
+			}
+
 			newRes, err := f.unpackResource(contents, resType)
 			if err != nil {
 				retErr = err
@@ -160,7 +185,7 @@ func (f *FileStore) Load() (*zebra.ResourceMap, error) {
 // Store new object given storage root path and resource pointer.
 // If object already exists, return error.
 func (f *FileStore) Create(res zebra.Resource) error {
-	if err := res.Validate(context.Background()); err != nil {
+	if err := validate(res); err != nil {
 		return err
 	}
 
@@ -170,19 +195,123 @@ func (f *FileStore) Create(res zebra.Resource) error {
 	return f.create(res)
 }
 
-// Should not be called without holding the write lock.
+// Store the resource at version 1. Should not be called without holding the
+// write lock.
 func (f *FileStore) create(res zebra.Resource) error {
-	if _, err := os.Stat(f.resourcesFilePath(res)); err == nil {
+	if f.exists(res) {
 		return ErrFileExists
 	}
 
-	dir := f.resourcesFolderPath(res)
+	res.SetVersion(1)
+
+	return f.write(res)
+}
 
+// Write the resource to its file. Should not be called without holding the
+// write lock.
+func (f *FileStore) write(res zebra.Resource) error {
 	object, err := json.Marshal(res)
 	if err != nil {
 		return err
 	}
 
+	if f.cipher != nil {
+		object, _, err = zebra.MapNamedCredentialKeys(object, func(name string, value string) (string, error) {
+			return f.cipher.Encrypt(value, res.GetID(), name)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeFile(f.resourcesFolderPath(res), f.resourcesFilePath(res), object)
+}
+
+// Rewrap encrypts the data keys of all stored credential values under the
+// primary key of the store's cipher, and encrypts the values that are still
+// stored in plain text. Used to rotate keys once a new primary key is added.
+func (f *FileStore) Rewrap() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.cipher == nil {
+		return ErrCipherMissing
+	}
+
+	rootDir := f.filestoreResourcesPath()
+
+	dirs, err := os.ReadDir(rootDir)
+	if err != nil {
+		return err
+	}
+
+	for _, subdir := range dirs {
+		dir := path.Join(rootDir, subdir.Name())
+
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			filepath := path.Join(dir, file.Name())
+
+			contents, err := os.ReadFile(filepath)
+			if err != nil {
+				return err
+			}
+
+			id := subdir.Name() + file.Name()
+
+			contents, found, err := zebra.MapNamedCredentialKeys(contents, func(name string, value string) (string, error) {
+				return f.cipher.Rewrap(value, id, name)
+			})
+			if err != nil {
+				return err
+			}
+
+			if !found {
+				continue
+			}
+
+			if err := writeFile(dir, filepath, contents); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Return the contents of the resource with the given ID with the values of
+// credential keys decrypted. Should not be called without holding the lock.
+func (f *FileStore) decryptKeys(id string, contents []byte) ([]byte, error) {
+	if f.cipher != nil {
+		contents, _, err := zebra.MapNamedCredentialKeys(contents, func(name string, value string) (string, error) {
+			return f.cipher.Decrypt(value, id, name)
+		})
+
+		return contents, err
+	}
+
+	if !bytes.Contains(contents, []byte(sealedPrefix)) {
+		return contents, nil
+	}
+
+	_, _, err := zebra.MapCredentialKeys(contents, func(value string) (string, error) {
+		if IsSealed(value) {
+			return "", ErrCipherMissing
+		}
+
+		return value, nil
+	})
+
+	return contents, err
+}
+
+// Atomically replace the file at filepath, in the folder dir, with one
+// holding the given contents.
+func writeFile(dir string, filepath string, contents []byte) error {
 	file, err := ioutil.TempFile(dir, "temp_")
 	if err != nil {
 		return err
@@ -196,7 +325,7 @@ func (f *FileStore) create(res zebra.Resource) error {
 
 	defer file.Close()
 
-	if _, err := file.Write(object); err != nil {
+	if _, err := file.Write(contents); err != nil {
 		return err
 	}
 
@@ -204,38 +333,67 @@ func (f *FileStore) create(res zebra.Resource) error {
 		return err
 	}
 
-	return os.Rename(file.Name(), f.resourcesFilePath(res))
+	return os.Rename(file.Name(), filepath)
 }
 
 // Update existing object. If object does not exist, return error.
 func (f *FileStore) Update(res zebra.Resource) error {
-	if err := res.Validate(context.Background()); err != nil {
+	return f.UpdateIf(res, 0)
+}
+
+// UpdateIf updates the object if its stored version is the given version, or
+// whatever its version if version is 0, and moves it to the next version.
+// Otherwise it returns ErrVersionConflict.
+func (f *FileStore) UpdateIf(res zebra.Resource, version uint64) error {
+	if err := validate(res); err != nil {
 		return err
 	}
 
 	f.lock.Lock()
 	defer f.lock.Unlock()
 
-	filepath := f.resourcesFilePath(res)
-	if _, err := os.Stat(filepath); err == nil {
-		_ = f.delete(res)
+	stored, err := f.version(res)
+	if err != nil {
+		return err
+	}
 
-		return f.create(res)
+	if version != 0 && version != stored {
+		return ErrVersionConflict
 	}
 
-	return ErrFileDoesNotExist
+	res.SetVersion(stored + 1)
+
+	return f.write(res)
 }
 
 // Delete object given storage root path and UUID.
 // If object does not exist, do nothing.
 func (f *FileStore) Delete(res zebra.Resource) error {
-	if err := res.Validate(context.Background()); err != nil {
+	return f.DeleteIf(res, 0)
+}
+
+// DeleteIf deletes the object if its stored version is the given version, or
+// whatever its version if version is 0. Otherwise it returns
+// ErrVersionConflict.
+func (f *FileStore) DeleteIf(res zebra.Resource, version uint64) error {
+	if err := validate(res); err != nil {
 		return err
 	}
 
 	f.lock.Lock()
 	defer f.lock.Unlock()
 
+	if version != 0 {
+		stored, err := f.version(res)
+		if err != nil {
+			return err
+		}
+
+		if version != stored {
+			return ErrVersionConflict
+		}
+	}
+
 	return f.delete(res)
 }
 
@@ -250,6 +408,20 @@ func (f *FileStore) delete(res zebra.Resource) error {
 	return nil
 }
 
+// Validate the resource and make sure its ID cannot name a file outside the
+// store.
+func validate(res zebra.Resource) error {
+	if err := res.Validate(context.Background()); err != nil {
+		return err
+	}
+
+	if id := res.GetID(); strings.ContainsAny(id, "/\\") || strings.Contains(id, "..") {
+		return ErrIDInvalid
+	}
+
+	return nil
+}
+
 // Unpack storedRes.Resource into correct type of resource and return zebra.Resource
 // along with error if occurred.
 func (f *FileStore) unpackResource(contents []byte, resType string) (zebra.Resource, error) {
@@ -270,9 +442,47 @@ func (f *FileStore) unpackResource(contents []byte, resType string) (zebra.Resou
 		return nil, err
 	}
 
+	// Resources stored without a version are at version 1.
+	if res.GetVersion() == 0 {
+		res.SetVersion(1)
+	}
+
 	return res, nil
 }
 
+// Return the stored version of the resource. Should not be called without
+// holding the write lock.
+func (f *FileStore) version(res zebra.Resource) (uint64, error) {
+	contents, err := os.ReadFile(f.resourcesFilePath(res))
+	if os.IsNotExist(err) {
+		return 0, ErrFileDoesNotExist
+	} else if err != nil {
+		return 0, err
+	}
+
+	object := struct {
+		Version uint64 `json:"version"`
+	}{Version: 0}
+
+	if err := json.Unmarshal(contents, &object); err != nil {
+		return 0, err
+	}
+
+	if object.Version == 0 {
+		return 1, nil
+	}
+
+	return object.Version, nil
+}
+
+// Return true if the resource is stored. Should not be called without holding
+// the write lock.
+func (f *FileStore) exists(res zebra.Resource) bool {
+	_, err := os.Stat(f.resourcesFilePath(res))
+
+	return err == nil
+}
+
 // Return file path given resource.
 func (f *FileStore) resourcesFilePath(res zebra.Resource) string {
 	resID := res.GetID()
@@ -147,6 +147,55 @@ func TestLoad(t *testing.T) {
 	assert.True(list[0].GetType() == vlan)
 }
 
+func TestVersions(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	t.Cleanup(func() { os.RemoveAll("teststore10") })
+
+	resource := new(network.VLANPool)
+	resource.ID = "0100000001"
+	resource.Type = vlan
+	resource.RangeEnd = 10
+
+	types := zebra.Factory()
+	types.Add(vlan, func() zebra.Resource { return new(network.VLANPool) })
+
+	filestore := store.NewFileStore("teststore10", types)
+	assert.Nil(filestore.Initialize())
+
+	assert.Equal(store.ErrFileDoesNotExist, filestore.UpdateIf(resource, 1))
+
+	// Resources start at version 1 and move on with every update.
+	resource.Version = 7
+	assert.Nil(filestore.Create(resource))
+	assert.Equal(uint64(1), resource.Version)
+
+	assert.Nil(filestore.UpdateIf(resource, 1))
+	assert.Equal(uint64(2), resource.Version)
+
+	assert.Nil(filestore.Update(resource))
+	assert.Equal(uint64(3), resource.Version)
+
+	// Writes based on older versions fail.
+	resource.RangeEnd = 20
+	assert.Equal(store.ErrVersionConflict, filestore.UpdateIf(resource, 2))
+	assert.Equal(store.ErrVersionConflict, filestore.DeleteIf(resource, 2))
+
+	resources, err := filestore.Load()
+	assert.Nil(err)
+
+	stored, ok := resources.Resources[vlan].Resources[0].(*network.VLANPool)
+	assert.True(ok)
+	assert.Equal(uint64(3), stored.Version)
+	assert.Equal(uint16(10), stored.RangeEnd)
+
+	assert.Nil(filestore.DeleteIf(resource, 3))
+
+	_, err = os.Stat("teststore10/resources/01/00000001")
+	assert.True(os.IsNotExist(err))
+}
+
 func TestDelete(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
@@ -348,14 +397,22 @@ func TestBadCreate(t *testing.T) {
 
 	resource := &network.VLANPool{
 		BaseResource: zebra.BaseResource{
-			ID:     "01",
-			Type:   "VLANPool",
-			Labels: nil,
+			ID:      "01",
+			Type:    "VLANPool",
+			Labels:  nil,
+			Version: 0,
 		},
 		RangeStart: 0,
 		RangeEnd:   10,
 	}
 	assert.NotNil(filestore.Create(resource))
+
+	// IDs may not name files outside the store.
+	resource.ID = "01/../../escaped"
+	assert.Equal(store.ErrIDInvalid, filestore.Create(resource))
+
+	resource.ID = "..escaped"
+	assert.Equal(store.ErrIDInvalid, filestore.Create(resource))
 }
 
 func TestBadUpdate(t *testing.T) {
@@ -382,9 +439,10 @@ func TestBadDelete(t *testing.T) {
 
 	resource := &network.VLANPool{
 		BaseResource: zebra.BaseResource{
-			ID:     "010",
-			Type:   "VLANPool",
-			Labels: nil,
+			ID:      "010",
+			Type:    "VLANPool",
+			Labels:  nil,
+			Version: 0,
 		},
 		RangeStart: 0,
 		RangeEnd:   10,
@@ -393,3 +451,40 @@ func TestBadDelete(t *testing.T) {
 	assert.NotNil(filestore.Delete(new(network.VLANPool)))
 	assert.NotNil(filestore.Delete(resource))
 }
+
+func TestLoadUser(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	t.Cleanup(func() { os.RemoveAll("teststore7") })
+
+	user := new(zebra.User)
+	user.ID = "0100000001"
+	user.Type = "User"
+	user.Name = "aladdin"
+	user.Role = "developer"
+	assert.Nil(user.SetPassword("Riddle4theSphinx!"))
+
+	types := zebra.Factory()
+	types.Add("User", func() zebra.Resource { return new(zebra.User) })
+
+	filestore := store.NewFileStore("teststore7", types)
+	assert.Nil(filestore.Initialize())
+	assert.Nil(filestore.Create(user))
+
+	// The password is not stored, only its hash.
+	contents, err := os.ReadFile("teststore7/resources/01/00000001")
+	assert.Nil(err)
+	assert.NotContains(string(contents), "Riddle4theSphinx!")
+
+	resources, err := filestore.Load()
+	assert.Nil(err)
+
+	list := resources.Resources["User"].Resources
+	assert.Len(list, 1)
+
+	loaded, ok := list[0].(*zebra.User)
+	assert.True(ok)
+	assert.Equal("aladdin", loaded.Name)
+	assert.True(loaded.CheckPassword("Riddle4theSphinx!"))
+}
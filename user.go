@@ -0,0 +1,142 @@
+package zebra
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrRoleEmpty = errors.New("role is empty")
+
+var ErrPasswordHashEmpty = errors.New("password hash is empty")
+
+var ErrPasswordHashInvalid = errors.New("password hash is not in a known format")
+
+// Number of PBKDF2 iterations used for new password hashes. Stored hashes
+// record their own iteration count, so this can be raised over time.
+const passwordIterations = 100000
+
+const (
+	passwordScheme  = "pbkdf2-sha256"
+	passwordSaltLen = 16
+	passwordKeyLen  = sha256.Size
+)
+
+// A User represents a person who can authenticate to zebra and reserve
+// resources. The role determines what the user is allowed to do, and the
+// groups let usage be tracked across teams. Only a salted hash of the user's
+// password is stored, never the password itself.
+type User struct {
+	NamedResource
+	Role         string   `json:"role"`
+	Groups       []string `json:"groups,omitempty"`
+	PasswordHash string   `json:"passwordHash"`
+}
+
+// Validate returns an error if the given User object has incorrect values.
+// Else, it returns nil.
+func (u *User) Validate(ctx context.Context) error {
+	switch {
+	case u.Role == "":
+		return ErrRoleEmpty
+	case u.PasswordHash == "":
+		return ErrPasswordHashEmpty
+	}
+
+	if _, _, _, err := parsePasswordHash(u.PasswordHash); err != nil {
+		return err
+	}
+
+	return u.NamedResource.Validate(ctx)
+}
+
+// SetPassword checks that the password follows the rules of ValidatePassword
+// and, if so, replaces the user's password hash with a new salted hash of it.
+func (u *User) SetPassword(password string) error {
+	if err := ValidatePassword(password); err != nil {
+		return err
+	}
+
+	salt := make([]byte, passwordSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+
+	key := pbkdf2SHA256([]byte(password), salt, passwordIterations)
+
+	u.PasswordHash = fmt.Sprintf("%s$%d$%s$%s", passwordScheme, passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+
+	return nil
+}
+
+// CheckPassword returns true if the password matches the user's password hash.
+func (u *User) CheckPassword(password string) bool {
+	iterations, salt, key, err := parsePasswordHash(u.PasswordHash)
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(key, pbkdf2SHA256([]byte(password), salt, iterations)) == 1
+}
+
+// Split a password hash of the form "pbkdf2-sha256$iterations$salt$key" into
+// its iteration count, salt and key.
+func parsePasswordHash(hash string) (int, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != passwordScheme { //nolint:gomnd
+		return 0, nil, nil, ErrPasswordHashInvalid
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return 0, nil, nil, ErrPasswordHashInvalid
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil || len(salt) == 0 {
+		return 0, nil, nil, ErrPasswordHashInvalid
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) != passwordKeyLen {
+		return 0, nil, nil, ErrPasswordHashInvalid
+	}
+
+	return iterations, salt, key, nil
+}
+
+// PBKDF2 (RFC 8018) with HMAC-SHA256, deriving a single block of key.
+func pbkdf2SHA256(password []byte, salt []byte, iterations int) []byte {
+	prf := hmac.New(sha256.New, password)
+
+	block := make([]byte, 4) //nolint:gomnd
+	binary.BigEndian.PutUint32(block, 1)
+
+	prf.Write(salt)
+	prf.Write(block)
+	u := prf.Sum(nil)
+
+	key := make([]byte, len(u))
+	copy(key, u)
+
+	for i := 1; i < iterations; i++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+
+	return key
+}
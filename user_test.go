@@ -0,0 +1,66 @@
+package zebra_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestUser tests the *User Validate function with pass and fail cases.
+func TestUser(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	user := new(zebra.User)
+	assert.Equal(zebra.ErrRoleEmpty, user.Validate(ctx))
+
+	user.Role = "developer"
+	assert.Equal(zebra.ErrPasswordHashEmpty, user.Validate(ctx))
+
+	user.PasswordHash = "Riddle4theSphinx!"
+	assert.Equal(zebra.ErrPasswordHashInvalid, user.Validate(ctx))
+
+	user.PasswordHash = "pbkdf2-sha256$0$c2FsdA$c2FsdA"
+	assert.Equal(zebra.ErrPasswordHashInvalid, user.Validate(ctx))
+
+	assert.Nil(user.SetPassword("Riddle4theSphinx!"))
+	assert.Equal(zebra.ErrNameEmpty, user.Validate(ctx))
+
+	user.ID = "0100000001"
+	user.Type = "User"
+	user.Name = "aladdin"
+	user.Groups = []string{"agrabah"}
+	assert.Nil(user.Validate(ctx))
+}
+
+// TestUserPassword tests that only a salted hash of the password is stored and
+// that the password rules are enforced.
+func TestUserPassword(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	user := new(zebra.User)
+	assert.False(user.CheckPassword(""))
+
+	assert.Equal(zebra.ErrPassLen, user.SetPassword("short"))
+	assert.Equal(zebra.ErrPassSpecial, user.SetPassword("Riddle4theSphinx"))
+	assert.Empty(user.PasswordHash)
+
+	assert.Nil(user.SetPassword("Riddle4theSphinx!"))
+	assert.NotContains(user.PasswordHash, "Riddle4theSphinx!")
+	assert.True(user.CheckPassword("Riddle4theSphinx!"))
+	assert.False(user.CheckPassword("Riddle4theSphinx?"))
+
+	// The same password is salted differently each time it is set.
+	hash := user.PasswordHash
+	assert.Nil(user.SetPassword("Riddle4theSphinx!"))
+	assert.NotEqual(hash, user.PasswordHash)
+	assert.True(user.CheckPassword("Riddle4theSphinx!"))
+
+	// A failed change leaves the old password in place.
+	assert.Equal(zebra.ErrPassNum, user.SetPassword("RiddleForTheSphinx!"))
+	assert.True(user.CheckPassword("Riddle4theSphinx!"))
+}
@@ -0,0 +1,246 @@
+// Package watch fans out the changes made to the inventory to the clients
+// watching it, and keeps the latest changes so that clients can resume
+// watching where they stopped.
+package watch
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/project-safari/zebra"
+)
+
+// Actions of events.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Most events queued for a watcher that has not taken them yet. A watcher
+// falling further behind is dropped.
+const maxQueue = 1024
+
+var ErrRevisionExpired = errors.New("revision is older than the oldest event kept")
+
+var ErrRevisionInvalid = errors.New("revision is newer than the latest event")
+
+var ErrWatcherLagging = errors.New("watcher fell too far behind and was dropped")
+
+var ErrWatcherClosed = errors.New("watcher was closed")
+
+var ErrEventIDInvalid = errors.New("event id must be an epoch and a revision separated by -")
+
+var ErrEpochChanged = errors.New("event id is from before the server restarted")
+
+// An Event is a change to a resource. Revisions number events in the order
+// they were published, starting at 1. The resource of a delete event is the
+// resource as it was before it was deleted.
+type Event struct {
+	Revision uint64         `json:"revision"`
+	Action   string         `json:"action"`
+	Type     string         `json:"type"`
+	ID       string         `json:"id"`
+	Resource zebra.Resource `json:"resource"`
+}
+
+// A Hub publishes events to its watchers. It keeps the latest events, up to
+// its history size, for watchers that resume from a past revision. Revisions
+// are only kept in memory and start over with each hub, so each hub has its
+// own epoch, which the IDs of its events name along with their revision.
+type Hub struct {
+	lock     sync.Mutex
+	epoch    string
+	revision uint64
+	history  []Event
+	size     int
+	watchers map[*Watcher]bool
+}
+
+// NewHub returns a hub that keeps the given number of latest events.
+func NewHub(size int) *Hub {
+	return &Hub{
+		lock:     sync.Mutex{},
+		epoch:    strconv.FormatInt(time.Now().UnixNano(), 36),
+		revision: 0,
+		history:  []Event{},
+		size:     size,
+		watchers: map[*Watcher]bool{},
+	}
+}
+
+// Revision returns the revision of the latest event, or 0 if there is none.
+func (h *Hub) Revision() uint64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.revision
+}
+
+// EventID returns the ID of the hub's event with the given revision.
+func (h *Hub) EventID(revision uint64) string {
+	return h.epoch + "-" + strconv.FormatUint(revision, 10)
+}
+
+// ParseEventID returns the revision of the event with the given ID. It returns
+// ErrEpochChanged if the ID is from another hub, such as the one before the
+// server restarted, as its revisions mean nothing to this hub.
+func (h *Hub) ParseEventID(id string) (uint64, error) {
+	i := strings.LastIndex(id, "-")
+	if i < 0 {
+		return 0, ErrEventIDInvalid
+	}
+
+	revision, err := strconv.ParseUint(id[i+1:], 10, 64)
+	if err != nil {
+		return 0, ErrEventIDInvalid
+	}
+
+	if id[:i] != h.epoch {
+		return 0, ErrEpochChanged
+	}
+
+	return revision, nil
+}
+
+// Publish numbers an event for the action on the resource with the next
+// revision and queues it for every watcher that selects it. Revisions are
+// handed out in the order Publish is called, so writers must publish while
+// holding the lock that orders their writes for revisions to follow them.
+func (h *Hub) Publish(action string, res zebra.Resource) Event {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.revision++
+
+	e := Event{Revision: h.revision, Action: action, Type: res.GetType(), ID: res.GetID(), Resource: res}
+
+	h.history = append(h.history, e)
+	if len(h.history) > h.size {
+		h.history = h.history[len(h.history)-h.size:]
+	}
+
+	for w := range h.watchers {
+		w.push(e)
+	}
+
+	return e
+}
+
+// Watch returns a watcher of the events after the given revision for which
+// match returns true, starting with those that the hub kept. A nil match
+// selects every event. It returns
+// ErrRevisionExpired if events after the revision are no longer kept, and
+// ErrRevisionInvalid if the revision is yet to come.
+func (h *Hub) Watch(after uint64, match func(Event) bool) (*Watcher, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if after > h.revision {
+		return nil, ErrRevisionInvalid
+	}
+
+	if after < h.revision && (len(h.history) == 0 || h.history[0].Revision > after+1) {
+		return nil, ErrRevisionExpired
+	}
+
+	w := &Watcher{hub: h, match: match, queue: []Event{}, ready: make(chan struct{}, 1), err: nil}
+
+	for _, e := range h.history {
+		if e.Revision > after {
+			w.push(e)
+		}
+	}
+
+	if w.err == nil {
+		h.watchers[w] = true
+	}
+
+	return w, nil
+}
+
+// A Watcher receives the events that it selects from its hub.
+type Watcher struct {
+	hub   *Hub
+	match func(Event) bool
+	queue []Event
+	ready chan struct{}
+	err   error
+}
+
+// Next returns the next event, waiting for one to be published if there is
+// none yet. It returns an error if the context is done first or the watcher
+// was dropped or closed.
+func (w *Watcher) Next(ctx context.Context) (Event, error) {
+	for {
+		w.hub.lock.Lock()
+
+		if len(w.queue) > 0 {
+			e := w.queue[0]
+			w.queue = w.queue[1:]
+			w.hub.lock.Unlock()
+
+			return e, nil
+		}
+
+		err := w.err
+		w.hub.lock.Unlock()
+
+		if err != nil {
+			return Event{}, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return Event{}, ctx.Err()
+		case <-w.ready:
+		}
+	}
+}
+
+// Close stops the watcher from receiving events.
+func (w *Watcher) Close() {
+	w.hub.lock.Lock()
+	defer w.hub.lock.Unlock()
+
+	w.stop(ErrWatcherClosed)
+}
+
+// Queue the event if the watcher selects it, or drop the watcher if it has
+// fallen too far behind. Should not be called without holding the hub lock.
+func (w *Watcher) push(e Event) {
+	if w.err != nil || (w.match != nil && !w.match(e)) {
+		return
+	}
+
+	if len(w.queue) >= maxQueue {
+		w.stop(ErrWatcherLagging)
+
+		return
+	}
+
+	w.queue = append(w.queue, e)
+	w.wake()
+}
+
+// Should not be called without holding the hub lock.
+func (w *Watcher) stop(err error) {
+	if w.err == nil {
+		w.err = err
+		w.queue = nil
+	}
+
+	delete(w.hub.watchers, w)
+	w.wake()
+}
+
+func (w *Watcher) wake() {
+	select {
+	case w.ready <- struct{}{}:
+	default:
+	}
+}
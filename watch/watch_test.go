@@ -0,0 +1,129 @@
+package watch_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/watch"
+	"github.com/stretchr/testify/assert"
+)
+
+func pool(id string) zebra.Resource {
+	res := new(network.VLANPool)
+	res.ID = id
+	res.Type = "VLANPool"
+
+	return res
+}
+
+// Return the revisions of the next n events of the watcher.
+func revisions(t *testing.T, w *watch.Watcher, n int) []uint64 {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	revs := []uint64{}
+
+	for i := 0; i < n; i++ {
+		e, err := w.Next(ctx)
+		if !assert.Nil(t, err) {
+			break
+		}
+
+		revs = append(revs, e.Revision)
+	}
+
+	return revs
+}
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	hub := watch.NewHub(3)
+	assert.Equal(uint64(0), hub.Revision())
+
+	live, err := hub.Watch(0, nil)
+	assert.Nil(err)
+
+	selective, err := hub.Watch(0, func(e watch.Event) bool { return e.ID == "0100000002" })
+	assert.Nil(err)
+
+	e := hub.Publish(watch.ActionCreate, pool("0100000001"))
+	assert.Equal(watch.Event{
+		Revision: 1, Action: watch.ActionCreate, Type: "VLANPool", ID: "0100000001", Resource: pool("0100000001"),
+	}, e)
+
+	hub.Publish(watch.ActionCreate, pool("0100000002"))
+	hub.Publish(watch.ActionUpdate, pool("0100000001"))
+	hub.Publish(watch.ActionDelete, pool("0100000002"))
+	assert.Equal(uint64(4), hub.Revision())
+
+	assert.Equal([]uint64{1, 2, 3, 4}, revisions(t, live, 4))
+	assert.Equal([]uint64{2, 4}, revisions(t, selective, 2))
+
+	// Watchers resume from the events kept.
+	resumed, err := hub.Watch(1, nil)
+	assert.Nil(err)
+	assert.Equal([]uint64{2, 3, 4}, revisions(t, resumed, 3))
+
+	_, err = hub.Watch(0, nil)
+	assert.Equal(watch.ErrRevisionExpired, err)
+
+	_, err = hub.Watch(5, nil)
+	assert.Equal(watch.ErrRevisionInvalid, err)
+
+	// Watchers wait for the next event.
+	go hub.Publish(watch.ActionCreate, pool("0100000003"))
+
+	assert.Equal([]uint64{5}, revisions(t, resumed, 1))
+
+	// Event IDs resume only the hub that made them.
+	revision, err := hub.ParseEventID(hub.EventID(5))
+	assert.Nil(err)
+	assert.Equal(uint64(5), revision)
+
+	_, err = watch.NewHub(3).ParseEventID(hub.EventID(5))
+	assert.Equal(watch.ErrEpochChanged, err)
+
+	for _, id := range []string{"5", hub.EventID(5) + "x", ""} {
+		_, err = hub.ParseEventID(id)
+		assert.Equal(watch.ErrEventIDInvalid, err, id)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = live.Next(ctx)
+	assert.Nil(err)
+
+	_, err = live.Next(ctx)
+	assert.Equal(context.DeadlineExceeded, err)
+
+	live.Close()
+
+	_, err = live.Next(context.Background())
+	assert.Equal(watch.ErrWatcherClosed, err)
+}
+
+func TestLagging(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	hub := watch.NewHub(10)
+
+	w, err := hub.Watch(0, nil)
+	assert.Nil(err)
+
+	for i := 0; i < 2000; i++ {
+		hub.Publish(watch.ActionUpdate, pool("0100000001"))
+	}
+
+	// Watchers that fall behind are dropped rather than holding up writes.
+	_, err = w.Next(context.Background())
+	assert.Equal(watch.ErrWatcherLagging, err)
+}
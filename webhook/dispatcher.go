@@ -0,0 +1,404 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/query"
+	"github.com/project-safari/zebra/watch"
+)
+
+// Most deliveries waiting for a worker. Once as many wait, the dispatcher
+// waits for the workers before taking more events.
+const maxQueue = 1000
+
+var ErrDeliveryFailed = errors.New("webhook responded with an error status")
+
+var ErrWorkersInvalid = errors.New("webhook workers must be at least 1")
+
+var ErrAttemptsInvalid = errors.New("webhook attempts must be at least 1")
+
+var ErrTimeoutInvalid = errors.New("webhook timeout must be greater than 0")
+
+var ErrBackoffInvalid = errors.New("webhook backoff must be greater than 0")
+
+var ErrMaxBackoffInvalid = errors.New("webhook max backoff must not be less than the backoff")
+
+// Config holds the delivery settings. A delivery is attempted up to Attempts
+// times, waiting Backoff after the first failure and twice as long after each
+// further one, up to MaxBackoff. Each attempt times out after Timeout. Up to
+// Workers deliveries are sent at once.
+type Config struct {
+	Attempts   int            `json:"attempts"`
+	Backoff    zebra.Duration `json:"backoff"`
+	MaxBackoff zebra.Duration `json:"maxBackoff"`
+	Timeout    zebra.Duration `json:"timeout"`
+	Workers    int            `json:"workers"`
+}
+
+// DefaultConfig returns the settings used when none are configured: five
+// attempts, backing off from a second up to a minute, timing out after ten
+// seconds, with ten workers.
+func DefaultConfig() Config {
+	return Config{
+		Attempts:   5, //nolint:gomnd
+		Backoff:    zebra.Duration{Duration: time.Second},
+		MaxBackoff: zebra.Duration{Duration: time.Minute},
+		Timeout:    zebra.Duration{Duration: 10 * time.Second}, //nolint:gomnd
+		Workers:    10,                                         //nolint:gomnd
+	}
+}
+
+// Validate returns an error if the settings cannot be used.
+func (c Config) Validate() error {
+	switch {
+	case c.Attempts < 1:
+		return ErrAttemptsInvalid
+	case c.Timeout.Duration <= 0:
+		return ErrTimeoutInvalid
+	case c.Backoff.Duration <= 0:
+		return ErrBackoffInvalid
+	case c.MaxBackoff.Duration < c.Backoff.Duration:
+		return ErrMaxBackoffInvalid
+	case c.Workers < 1:
+		return ErrWorkersInvalid
+	}
+
+	return nil
+}
+
+// A Dispatcher delivers the events published to a hub to the webhooks stored
+// in a query store, and stores the deliveries that fail every attempt as dead
+// letters in a zebra.Store.
+type Dispatcher struct {
+	lock       sync.Mutex
+	hub        *watch.Hub
+	store      zebra.Store
+	queryStore *query.QueryStore
+	client     *http.Client
+	cfg        Config
+	after      uint64
+}
+
+// Return new Dispatcher pointer that delivers the events published to the
+// hub from now on, finds webhooks and leased resources in the query store, and stores
+// dead letters in the store.
+func NewDispatcher(hub *watch.Hub, store zebra.Store, queryStore *query.QueryStore) *Dispatcher {
+	return &Dispatcher{
+		lock:       sync.Mutex{},
+		hub:        hub,
+		store:      store,
+		queryStore: queryStore,
+		client:     &http.Client{}, //nolint:exhaustivestruct
+		cfg:        DefaultConfig(),
+		after:      hub.Revision(),
+	}
+}
+
+// Configure sets the delivery settings, or returns an error if they are not
+// valid. The number of workers is read when Run starts.
+func (d *Dispatcher) Configure(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.cfg = cfg
+
+	return nil
+}
+
+// A delivery is a payload to post to a webhook.
+type delivery struct {
+	webhook *Webhook
+	id      string
+	action  string
+	body    []byte
+}
+
+// Run delivers the events published since the dispatcher was created, until
+// the context is done. Deliveries are queued for a fixed number of workers,
+// so that slow webhooks hold up neither each other nor the events that follow
+// until every worker is busy and the queue is full, and then wait. If the
+// dispatcher falls behind, it resumes from the last event it delivered while the hub still
+// keeps the events after it, and from the latest one otherwise.
+func (d *Dispatcher) Run(ctx context.Context) {
+	log := logr.FromContextOrDiscard(ctx)
+	after := d.after
+
+	d.lock.Lock()
+	workers := d.cfg.Workers
+	d.lock.Unlock()
+
+	queue := make(chan delivery, maxQueue)
+	done := sync.WaitGroup{}
+
+	for i := 0; i < workers; i++ {
+		done.Add(1)
+
+		go func() {
+			defer done.Done()
+			d.work(ctx, queue)
+		}()
+	}
+
+	defer done.Wait()
+
+	for ctx.Err() == nil {
+		w, err := d.hub.Watch(after, nil)
+		if errors.Is(err, watch.ErrRevisionExpired) {
+			log.Info("webhooks missed events", "after", after)
+
+			after = d.hub.Revision()
+
+			continue
+		}
+
+		if err != nil {
+			log.Error(err, "failed to watch events for webhooks")
+
+			return
+		}
+
+		after = d.dispatch(ctx, w, queue, after)
+		w.Close()
+	}
+}
+
+// Queue the deliveries of the events of the watcher until it fails or the
+// context is done, and return the revision of the last event queued.
+func (d *Dispatcher) dispatch(ctx context.Context, w *watch.Watcher, queue chan<- delivery, after uint64) uint64 {
+	for {
+		e, err := w.Next(ctx)
+		if err != nil {
+			return after
+		}
+
+		for _, del := range d.deliveries(e) {
+			select {
+			case queue <- del:
+			case <-ctx.Done():
+				return after
+			}
+		}
+
+		after = e.Revision
+	}
+}
+
+// Send the queued deliveries, one at a time, until the context is done.
+func (d *Dispatcher) work(ctx context.Context, queue <-chan delivery) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case del := <-queue:
+			d.deliver(ctx, del)
+		}
+	}
+}
+
+// Return the deliveries of the event to the webhooks that select them.
+func (d *Dispatcher) deliveries(e watch.Event) []delivery {
+	// Deliveries about webhooks would spread their secrets, and deliveries
+	// about dead letters could cause more of them.
+	if e.Type == Type || e.Type == DeadLetterType {
+		return nil
+	}
+
+	webhooks := []*Webhook{}
+
+	if list := d.queryStore.QueryType([]string{Type}).Resources[Type]; list != nil {
+		for _, res := range list.Resources {
+			if h, ok := res.(*Webhook); ok {
+				webhooks = append(webhooks, h)
+			}
+		}
+	}
+
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	deliveries := []delivery{}
+
+	for _, p := range d.payloads(e) {
+		for _, h := range webhooks {
+			if !h.Match(p.action, p.res) {
+				continue
+			}
+
+			p.payload.ID = newID()
+
+			body, err := json.Marshal(p.payload)
+			if err != nil {
+				continue
+			}
+
+			deliveries = append(deliveries, delivery{webhook: h, id: p.payload.ID, action: p.action, body: body})
+		}
+	}
+
+	return deliveries
+}
+
+// A payload about a resource, along with the resource it is about.
+type resourcePayload struct {
+	action  string
+	res     zebra.Resource
+	payload Payload
+}
+
+// Return the payloads of the event: one about its resource and, for leases
+// acquired or released, one about each of their resources.
+func (d *Dispatcher) payloads(e watch.Event) []resourcePayload {
+	payloads := []resourcePayload{{action: e.Action, res: e.Resource, payload: newPayload(e, e.Action, e.Resource, nil)}}
+
+	l, ok := e.Resource.(*lease.Lease)
+	if !ok || e.Action == watch.ActionUpdate {
+		return payloads
+	}
+
+	action := ActionLease
+	if e.Action == watch.ActionDelete {
+		action = ActionRelease
+	}
+
+	for _, list := range d.queryStore.QueryUUID(l.Resources).Resources {
+		for _, res := range list.Resources {
+			payloads = append(payloads, resourcePayload{action: action, res: res, payload: newPayload(e, action, res, l)})
+		}
+	}
+
+	return payloads
+}
+
+// Return the payload of a delivery with the action about the resource, caused
+// by the event.
+func newPayload(e watch.Event, action string, res zebra.Resource, l *lease.Lease) Payload {
+	resource, _ := zebra.MarshalRedacted(res)
+
+	p := Payload{
+		ID:       "",
+		Revision: e.Revision,
+		Action:   action,
+		Type:     res.GetType(),
+		Resource: resource,
+		Lease:    nil,
+	}
+
+	if l != nil {
+		p.Lease, _ = zebra.MarshalRedacted(l)
+	}
+
+	return p
+}
+
+// Post the delivery until it succeeds or runs out of attempts, in which case
+// it is stored as a dead letter.
+func (d *Dispatcher) deliver(ctx context.Context, del delivery) {
+	d.lock.Lock()
+	cfg := d.cfg
+	d.lock.Unlock()
+
+	backoff := cfg.Backoff.Duration
+
+	for attempt := 1; ; attempt++ {
+		err := d.post(ctx, cfg.Timeout.Duration, del)
+		if err == nil {
+			return
+		}
+
+		if attempt >= cfg.Attempts {
+			d.deadLetter(ctx, del, attempt, err)
+
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > cfg.MaxBackoff.Duration {
+			backoff = cfg.MaxBackoff.Duration
+		}
+	}
+}
+
+// Post the delivery once.
+func (d *Dispatcher) post(ctx context.Context, timeout time.Duration, del delivery) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, del.webhook.URL, bytes.NewReader(del.body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Now().Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, del.webhook.Sign(timestamp, del.body))
+	req.Header.Set(DeliveryHeader, del.id)
+	req.Header.Set(ActionHeader, del.action)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %s", ErrDeliveryFailed, resp.Status)
+	}
+
+	return nil
+}
+
+// Store the failed delivery as a dead letter.
+func (d *Dispatcher) deadLetter(ctx context.Context, del delivery, attempts int, err error) {
+	letter := &DeadLetter{
+		BaseResource: zebra.BaseResource{ID: del.id, Type: DeadLetterType, Labels: nil, Version: 0},
+		Webhook:      del.webhook.ID,
+		URL:          del.webhook.URL,
+		Payload:      del.body,
+		Attempts:     attempts,
+		Error:        err.Error(),
+		Time:         time.Now(),
+	}
+
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("webhook delivery failed", "webhook", del.webhook.ID, "delivery", del.id, "error", err.Error())
+
+	if err := d.store.Create(letter); err != nil {
+		log.Error(err, "failed to store dead letter", "webhook", del.webhook.ID, "delivery", del.id)
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16) //nolint:gomnd
+
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
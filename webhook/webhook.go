@@ -0,0 +1,180 @@
+// Package webhook posts the changes made to the inventory, and the leasing
+// and release of resources, to the URLs that admins subscribe. Subscriptions
+// are stored as Webhook resources, and deliveries that keep failing are stored
+// as DeadLetter resources.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/query"
+	"github.com/project-safari/zebra/watch"
+)
+
+// Type is the resource type of a Webhook.
+const Type = "Webhook"
+
+// DeadLetterType is the resource type of a DeadLetter.
+const DeadLetterType = "DeadLetter"
+
+// SecretKey is the credential key that holds the secret of a webhook.
+const SecretKey = "secret"
+
+// Actions of deliveries about the resources of a lease, sent when the lease
+// is acquired and released. Changes to resources are delivered with the
+// actions of watch events.
+const (
+	ActionLease   = "lease"
+	ActionRelease = "release"
+)
+
+// Headers of deliveries. The timestamp is the Unix time, in seconds, at which
+// the delivery was sent, and the signature is "sha256=" followed by the hex
+// encoded HMAC-SHA256 of the timestamp, a ".", and the body, keyed with the
+// secret of the webhook.
+const (
+	SignatureHeader = "X-Zebra-Signature"
+	TimestampHeader = "X-Zebra-Timestamp"
+	DeliveryHeader  = "X-Zebra-Delivery"
+	ActionHeader    = "X-Zebra-Action"
+)
+
+var ErrURLInvalid = errors.New("webhook url must be an absolute http or https url")
+
+var ErrSecretMissing = errors.New("webhook secret is missing")
+
+var ErrActionInvalid = errors.New("webhook action is not known")
+
+// Actions that webhooks may subscribe to.
+var actions = map[string]bool{ //nolint:gochecknoglobals
+	watch.ActionCreate: true,
+	watch.ActionUpdate: true,
+	watch.ActionDelete: true,
+	ActionLease:        true,
+	ActionRelease:      true,
+}
+
+// A Webhook subscribes a URL to the deliveries that it selects: those with
+// one of its actions, about resources of one of its types that its label
+// selector selects. Empty actions, types or selector select all deliveries.
+// The secret that deliveries are signed with is kept in Keys, under
+// SecretKey, so that it is stored encrypted and never shown.
+type Webhook struct {
+	zebra.BaseResource
+	URL      string            `json:"url"`
+	Actions  []string          `json:"actions,omitempty"`
+	Types    []string          `json:"types,omitempty"`
+	Selector string            `json:"selector,omitempty"`
+	Keys     map[string]string `json:"Keys"`
+}
+
+// Validate returns an error if the given Webhook object has incorrect values.
+// Else, it returns nil.
+func (h *Webhook) Validate(ctx context.Context) error {
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrURLInvalid
+	}
+
+	if h.Keys[SecretKey] == "" {
+		return ErrSecretMissing
+	}
+
+	for _, action := range h.Actions {
+		if !actions[action] {
+			return ErrActionInvalid
+		}
+	}
+
+	if h.Selector != "" {
+		if _, err := query.ParseSelector(h.Selector, query.KindLabel); err != nil {
+			return err
+		}
+	}
+
+	return h.BaseResource.Validate(ctx)
+}
+
+// Match returns true if the webhook selects deliveries with the action about
+// the resource.
+func (h *Webhook) Match(action string, res zebra.Resource) bool {
+	if len(h.Actions) > 0 && !contains(h.Actions, action) {
+		return false
+	}
+
+	if len(h.Types) > 0 && !contains(h.Types, res.GetType()) {
+		return false
+	}
+
+	if h.Selector == "" {
+		return true
+	}
+
+	sel, err := query.ParseSelector(h.Selector, query.KindLabel)
+
+	return err == nil && sel.Match(res)
+}
+
+// Sign returns the signature of a delivery body sent at the given Unix time
+// for the webhook.
+func (h *Webhook) Sign(timestamp int64, body []byte) string {
+	return Sign(h.Keys[SecretKey], timestamp, body)
+}
+
+// Sign returns the signature of a delivery body sent at the given Unix time
+// for a webhook with the given secret. Subscribers check deliveries by
+// comparing the signature they compute from the TimestampHeader and the body
+// with the one in the SignatureHeader, using hmac.Equal, and reject replays
+// by rejecting deliveries whose timestamp is too old.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// A Payload is the body of a delivery. ID identifies the delivery and stays
+// the same across retries. Revision is that of the watch event that caused
+// the delivery. Lease is set for the lease and release actions, and names the
+// lease that the resource was leased or released with. Secrets are hidden as
+// by zebra.MarshalRedacted.
+type Payload struct {
+	ID       string          `json:"id"`
+	Revision uint64          `json:"revision"`
+	Action   string          `json:"action"`
+	Type     string          `json:"type"`
+	Resource json.RawMessage `json:"resource"`
+	Lease    json.RawMessage `json:"lease,omitempty"`
+}
+
+// A DeadLetter records a delivery that failed every attempt to send it. It is
+// kept until an admin deletes it.
+type DeadLetter struct {
+	zebra.BaseResource
+	Webhook  string          `json:"webhook"`
+	URL      string          `json:"url"`
+	Payload  json.RawMessage `json:"payload"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	Time     time.Time       `json:"time"`
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,384 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/compute"
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/query"
+	"github.com/project-safari/zebra/watch"
+	"github.com/project-safari/zebra/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+func newWebhook(id string, url string) *webhook.Webhook {
+	h := new(webhook.Webhook)
+	h.ID = id
+	h.Type = webhook.Type
+	h.URL = url
+	h.Keys = map[string]string{webhook.SecretKey: "s3cr3t"}
+
+	return h
+}
+
+func newServer() *compute.Server {
+	s := new(compute.Server)
+	s.ID = "0100000001"
+	s.Type = "Server"
+	s.Labels = zebra.Labels{"pool": "perf"}
+	s.Credentials.Keys = map[string]string{"password": "hunter2"}
+
+	return s
+}
+
+func newPool() *network.VLANPool {
+	p := new(network.VLANPool)
+	p.ID = "0200000001"
+	p.Type = "VLANPool"
+	p.Labels = zebra.Labels{"pool": "func"}
+
+	return p
+}
+
+func TestWebhook(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	h := newWebhook("0300000001", "ftp://example.com")
+	assert.Equal(webhook.ErrURLInvalid, h.Validate(ctx))
+
+	h.URL = "https://example.com/hooks/zebra"
+	h.Keys = nil
+	assert.Equal(webhook.ErrSecretMissing, h.Validate(ctx))
+
+	h.Keys = map[string]string{webhook.SecretKey: "s3cr3t"}
+	h.Actions = []string{webhook.ActionLease, "reboot"}
+	assert.Equal(webhook.ErrActionInvalid, h.Validate(ctx))
+
+	h.Actions = []string{webhook.ActionLease}
+	h.Selector = "pool ="
+	assert.NotNil(h.Validate(ctx))
+
+	h.Selector = "pool = perf"
+	h.Types = []string{"Server"}
+	assert.Nil(h.Validate(ctx))
+
+	assert.True(h.Match(webhook.ActionLease, newServer()))
+	assert.False(h.Match(webhook.ActionRelease, newServer()))
+	assert.False(h.Match(webhook.ActionLease, newPool()))
+
+	h.Types = nil
+	assert.False(h.Match(webhook.ActionLease, newPool()))
+
+	h.Selector = ""
+	assert.True(h.Match(webhook.ActionLease, newPool()))
+
+	// The signature is the HMAC-SHA256 of the timestamp and the body, keyed
+	// with the secret.
+	signature := "sha256=dd8508e44d9a9f82f2690fb7dff1da8a6ae99700d98a23a4e7e1c307af3cb6cb"
+	assert.Equal(signature, webhook.Sign("s3cr3t", 1700000000, []byte("{}")))
+	assert.Equal(signature, h.Sign(1700000000, []byte("{}")))
+	assert.NotEqual(signature, webhook.Sign("secret", 1700000000, []byte("{}")))
+	assert.NotEqual(signature, webhook.Sign("s3cr3t", 1700000001, []byte("{}")))
+}
+
+// A delivery as received by a test server.
+type received struct {
+	Action    string
+	Timestamp int64
+	Signature string
+	Body      []byte
+	Payload   webhook.Payload
+}
+
+// Return a server that answers deliveries with the status and sends them to
+// the channel.
+func newReceiver(t *testing.T, status int) (*httptest.Server, chan received) {
+	t.Helper()
+
+	deliveries := make(chan received, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r := received{
+			Action:    req.Header.Get(webhook.ActionHeader),
+			Timestamp: 0,
+			Signature: req.Header.Get(webhook.SignatureHeader),
+			Body:      body,
+			Payload:   webhook.Payload{ID: "", Revision: 0, Action: "", Type: "", Resource: nil, Lease: nil},
+		}
+		_ = json.Unmarshal(body, &r.Payload)
+		r.Timestamp, _ = strconv.ParseInt(req.Header.Get(webhook.TimestampHeader), 10, 64)
+		deliveries <- r
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, deliveries
+}
+
+// Return the next delivery, or fail after a second.
+func next(t *testing.T, deliveries chan received) received {
+	t.Helper()
+
+	select {
+	case r := <-deliveries:
+		return r
+	case <-time.After(time.Second):
+		t.Fatal("no delivery")
+	}
+
+	return received{}
+}
+
+func TestDispatcher(t *testing.T) { // nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	ok, delivered := newReceiver(t, http.StatusOK)
+	failing, failed := newReceiver(t, http.StatusInternalServerError)
+
+	leases := newWebhook("0300000001", ok.URL)
+	leases.Actions = []string{webhook.ActionLease, webhook.ActionRelease}
+	leases.Types = []string{"Server"}
+
+	pools := newWebhook("0300000002", failing.URL)
+	pools.Actions = []string{watch.ActionCreate}
+	pools.Types = []string{"VLANPool"}
+
+	resources := zebra.NewResourceMap(zebra.Factory())
+	resources.Add(newServer(), "Server")
+	resources.Add(leases, webhook.Type)
+	resources.Add(pools, webhook.Type)
+
+	qs := query.NewQueryStore(resources)
+	assert.Nil(qs.Initialize())
+
+	hub := watch.NewHub(10)
+	d := webhook.NewDispatcher(hub, qs, qs)
+	assert.Nil(d.Configure(webhook.Config{
+		Attempts:   3,
+		Backoff:    zebra.Duration{Duration: time.Millisecond},
+		MaxBackoff: zebra.Duration{Duration: 2 * time.Millisecond},
+		Timeout:    zebra.Duration{Duration: time.Second},
+		Workers:    2,
+	}))
+
+	// Events published before the dispatcher runs are delivered too.
+	l := lease.NewLease("shravya", []string{"0100000001"}, time.Hour)
+	hub.Publish(watch.ActionCreate, l)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	go d.Run(ctx)
+
+	r := next(t, delivered)
+	assert.Equal(webhook.ActionLease, r.Action)
+	assert.Equal(webhook.Sign("s3cr3t", r.Timestamp, r.Body), r.Signature)
+	assert.WithinDuration(time.Now(), time.Unix(r.Timestamp, 0), time.Minute)
+	assert.Equal(uint64(1), r.Payload.Revision)
+	assert.Equal(webhook.ActionLease, r.Payload.Action)
+	assert.Equal("Server", r.Payload.Type)
+	assert.Contains(string(r.Payload.Resource), `"password":"********"`)
+	assert.NotContains(string(r.Payload.Resource), "hunter2")
+	assert.Contains(string(r.Payload.Lease), l.ID)
+
+	// Changes to the webhooks themselves are never delivered.
+	hub.Publish(watch.ActionUpdate, newServer())
+	hub.Publish(watch.ActionCreate, newWebhook("0300000003", ok.URL))
+	hub.Publish(watch.ActionDelete, l)
+
+	r = next(t, delivered)
+	assert.Equal(webhook.ActionRelease, r.Action)
+	assert.Equal(uint64(4), r.Payload.Revision)
+
+	// Deliveries are retried, and stored as dead letters once every attempt
+	// fails.
+	hub.Publish(watch.ActionCreate, newPool())
+
+	first := next(t, failed)
+	assert.Equal(watch.ActionCreate, first.Action)
+	assert.Equal("VLANPool", first.Payload.Type)
+	assert.Equal(first.Body, next(t, failed).Body)
+	assert.Equal(first.Body, next(t, failed).Body)
+
+	var letter *webhook.DeadLetter
+
+	assert.Eventually(func() bool {
+		list := qs.QueryType([]string{webhook.DeadLetterType}).Resources[webhook.DeadLetterType]
+		if list == nil || len(list.Resources) == 0 {
+			return false
+		}
+
+		letter, _ = list.Resources[0].(*webhook.DeadLetter)
+
+		return true
+	}, time.Second, 10*time.Millisecond)
+
+	if assert.NotNil(letter) {
+		assert.Equal(first.Payload.ID, letter.ID)
+		assert.Equal(pools.ID, letter.Webhook)
+		assert.Equal(3, letter.Attempts)
+		assert.Contains(letter.Error, "500")
+		assert.JSONEq(string(first.Body), string(letter.Payload))
+	}
+
+	assert.Empty(delivered)
+	assert.Empty(failed)
+}
+
+func TestDispatcherUsers(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	ok, delivered := newReceiver(t, http.StatusOK)
+
+	resources := zebra.NewResourceMap(zebra.Factory())
+	resources.Add(newWebhook("0300000001", ok.URL), webhook.Type)
+
+	qs := query.NewQueryStore(resources)
+	assert.Nil(qs.Initialize())
+
+	hub := watch.NewHub(10)
+	d := webhook.NewDispatcher(hub, qs, qs)
+
+	user := new(zebra.User)
+	user.ID = "0400000001"
+	user.Type = "User"
+	user.Name = "shravya"
+	assert.Nil(user.SetPassword("Riddikulus!42"))
+	hub.Publish(watch.ActionCreate, user)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	go d.Run(ctx)
+
+	// Password hashes are never delivered.
+	r := next(t, delivered)
+	assert.Equal("User", r.Payload.Type)
+	assert.Contains(string(r.Payload.Resource), `"name":"shravya"`)
+	assert.NotContains(string(r.Body), "passwordHash")
+	assert.NotContains(string(r.Body), user.PasswordHash)
+}
+
+func TestConfig(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	cfg := webhook.DefaultConfig()
+	assert.Nil(cfg.Validate())
+
+	cfg.Attempts = 0
+	assert.Equal(webhook.ErrAttemptsInvalid, cfg.Validate())
+
+	cfg = webhook.DefaultConfig()
+	cfg.Timeout = zebra.Duration{Duration: 0}
+	assert.Equal(webhook.ErrTimeoutInvalid, cfg.Validate())
+
+	cfg = webhook.DefaultConfig()
+	cfg.Backoff = zebra.Duration{Duration: -time.Second}
+	assert.Equal(webhook.ErrBackoffInvalid, cfg.Validate())
+
+	cfg = webhook.DefaultConfig()
+	cfg.MaxBackoff = zebra.Duration{Duration: 0}
+	assert.Equal(webhook.ErrMaxBackoffInvalid, cfg.Validate())
+
+	cfg.Backoff = zebra.Duration{Duration: time.Minute}
+	cfg.MaxBackoff = zebra.Duration{Duration: time.Second}
+	assert.Equal(webhook.ErrMaxBackoffInvalid, cfg.Validate())
+
+	cfg.MaxBackoff = cfg.Backoff
+	assert.Nil(cfg.Validate())
+}
+
+func TestWorkers(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	// The receiver holds each delivery until told to answer it.
+	var lock sync.Mutex
+
+	busy, most := 0, 0
+	answer := make(chan struct{})
+	delivered := make(chan struct{}, 8)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		if busy++; busy > most {
+			most = busy
+		}
+		lock.Unlock()
+
+		<-answer
+
+		lock.Lock()
+		busy--
+		lock.Unlock()
+
+		delivered <- struct{}{}
+	}))
+	t.Cleanup(receiver.Close)
+
+	resources := zebra.NewResourceMap(zebra.Factory())
+	resources.Add(newWebhook("0300000001", receiver.URL), webhook.Type)
+
+	qs := query.NewQueryStore(resources)
+	assert.Nil(qs.Initialize())
+
+	hub := watch.NewHub(10)
+	d := webhook.NewDispatcher(hub, qs, qs)
+
+	cfg := webhook.DefaultConfig()
+	cfg.Workers = 0
+	assert.Equal(webhook.ErrWorkersInvalid, d.Configure(cfg))
+
+	cfg.Workers = 2
+	assert.Nil(d.Configure(cfg))
+
+	for i := 0; i < cap(delivered); i++ {
+		hub.Publish(watch.ActionCreate, newPool())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	go d.Run(ctx)
+
+	// Only as many deliveries as there are workers are sent at once.
+	assert.Eventually(func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+
+		return busy == 2
+	}, time.Second, time.Millisecond)
+
+	time.Sleep(50 * time.Millisecond)
+
+	for i := 0; i < cap(delivered); i++ {
+		answer <- struct{}{}
+
+		select {
+		case <-delivered:
+		case <-time.After(time.Second):
+			t.Fatal("no delivery")
+		}
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	assert.Equal(2, most)
+}